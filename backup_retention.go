@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupRetention limits how many backups are kept. Zero values disable a
+// limit. The newest backup of every post is always kept.
+type BackupRetention struct {
+	MaxAge        time.Duration
+	MaxPerPost    int
+	MaxTotalBytes int64
+}
+
+// PruneCandidate is a backup selected for deletion and why
+type PruneCandidate struct {
+	PostBackup
+	Reason string
+}
+
+// Enabled reports whether any limit is set
+func (r BackupRetention) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxPerPost > 0 || r.MaxTotalBytes > 0
+}
+
+// String describes the active limits
+func (r BackupRetention) String() string {
+	var parts []string
+	if r.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf("edad maxima %s", formatRetentionAge(r.MaxAge)))
+	}
+	if r.MaxPerPost > 0 {
+		parts = append(parts, fmt.Sprintf("maximo %d por post", r.MaxPerPost))
+	}
+	if r.MaxTotalBytes > 0 {
+		parts = append(parts, fmt.Sprintf("tamano total maximo %s", formatBytes(r.MaxTotalBytes)))
+	}
+	if len(parts) == 0 {
+		return "sin limites"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// backupRetentionFromEnv reads WP_BACKUP_MAX_AGE (days, or a duration like
+// 72h), WP_BACKUP_MAX_PER_POST and WP_BACKUP_MAX_TOTAL_SIZE (bytes, or with
+// KB/MB/GB suffix)
+func backupRetentionFromEnv() BackupRetention {
+	var r BackupRetention
+	if age, err := parseRetentionAge(os.Getenv("WP_BACKUP_MAX_AGE")); err == nil {
+		r.MaxAge = age
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("WP_BACKUP_MAX_PER_POST"))); err == nil && n > 0 {
+		r.MaxPerPost = n
+	}
+	if size, err := parseByteSize(os.Getenv("WP_BACKUP_MAX_TOTAL_SIZE")); err == nil {
+		r.MaxTotalBytes = size
+	}
+	return r
+}
+
+// parseRetentionAge accepts a number of days ("30", "30d") or a Go duration
+func parseRetentionAge(v string) (time.Duration, error) {
+	v = strings.TrimSpace(strings.ToLower(v))
+	if v == "" {
+		return 0, fmt.Errorf("vacio")
+	}
+	if days, err := strconv.ParseFloat(strings.TrimSuffix(v, "d"), 64); err == nil {
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(v)
+}
+
+// parseByteSize accepts "1048576", "500KB", "200MB" or "1GB"
+func parseByteSize(v string) (int64, error) {
+	v = strings.TrimSpace(strings.ToUpper(v))
+	if v == "" {
+		return 0, fmt.Errorf("vacio")
+	}
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, unit.suffix) {
+			multiplier = unit.size
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("tamano no valido: %s", v)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+func formatRetentionAge(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d dias", int(d/(24*time.Hour)))
+	}
+	return d.String()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// planBackupPrune selects the backups that exceed the policy. backups must be
+// sorted newest first. Limits are applied by age, then count per post, then
+// total size (oldest first); the newest backup of each post is never selected.
+func planBackupPrune(backups []PostBackup, policy BackupRetention, now time.Time) []PruneCandidate {
+	var candidates []PruneCandidate
+	selected := make(map[string]bool)
+	seenPerPost := make(map[int64]int)
+
+	for _, b := range backups {
+		seenPerPost[b.PostID]++
+		if seenPerPost[b.PostID] == 1 {
+			continue // Newest backup of the post
+		}
+		switch {
+		case policy.MaxAge > 0 && now.Sub(b.CreatedAt) > policy.MaxAge:
+			candidates = append(candidates, PruneCandidate{b, fmt.Sprintf("mas antiguo que %s", formatRetentionAge(policy.MaxAge))})
+			selected[b.Path] = true
+		case policy.MaxPerPost > 0 && seenPerPost[b.PostID] > policy.MaxPerPost:
+			candidates = append(candidates, PruneCandidate{b, fmt.Sprintf("supera %d backups del post", policy.MaxPerPost)})
+			selected[b.Path] = true
+		}
+	}
+
+	if policy.MaxTotalBytes > 0 {
+		var total int64
+		for _, b := range backups {
+			if !selected[b.Path] {
+				total += b.Size
+			}
+		}
+
+		newest := make(map[int64]string)
+		for _, b := range backups {
+			if _, ok := newest[b.PostID]; !ok {
+				newest[b.PostID] = b.Path
+			}
+		}
+
+		for i := len(backups) - 1; i >= 0 && total > policy.MaxTotalBytes; i-- {
+			b := backups[i]
+			if selected[b.Path] || newest[b.PostID] == b.Path {
+				continue
+			}
+			candidates = append(candidates, PruneCandidate{b, fmt.Sprintf("tamano total supera %s", formatBytes(policy.MaxTotalBytes))})
+			selected[b.Path] = true
+			total -= b.Size
+		}
+	}
+
+	return candidates
+}
+
+// PruneBackups deletes (or, with dryRun, only lists) the backups that exceed
+// the retention policy
+func (wp *WordPressDB) PruneBackups(policy BackupRetention, dryRun bool) ([]PruneCandidate, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+	backups, err := wp.ListAllBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := planBackupPrune(backups, policy, time.Now())
+	if dryRun {
+		return candidates, nil
+	}
+	for _, c := range candidates {
+		if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+			return candidates, fmt.Errorf("error borrando backup %s: %v", c.Name, err)
+		}
+	}
+	return candidates, nil
+}
+
+// applyBackupRetention prunes backups with the configured policy after a
+// successful save and returns a note for the save report
+func (s *MCPServer) applyBackupRetention(wpDB *WordPressDB) string {
+	policy := backupRetentionFromEnv()
+	if !policy.Enabled() {
+		return ""
+	}
+	deleted, err := wpDB.PruneBackups(policy, false)
+	if err != nil {
+		s.log("Error aplicando retencion de backups: %v", err)
+		return fmt.Sprintf("\n\nAVISO: error aplicando la retencion de backups: %v", err)
+	}
+	if len(deleted) == 0 {
+		return ""
+	}
+	s.log("Retencion de backups: %d archivos borrados", len(deleted))
+	return fmt.Sprintf("\n\nRetencion de backups (%s): %d backups antiguos borrados.", policy, len(deleted))
+}
+
+func (s *MCPServer) handlePruneBackups(req JSONRPCRequest, params CallToolParams) {
+	dryRun := true
+	if v, ok := params.Arguments["dryRun"].(bool); ok {
+		dryRun = v
+	}
+
+	policy := backupRetentionFromEnv()
+	if v, ok := params.Arguments["maxAgeDays"].(float64); ok {
+		policy.MaxAge = time.Duration(v * float64(24*time.Hour))
+	}
+	if v, ok := params.Arguments["maxPerPost"].(float64); ok {
+		policy.MaxPerPost = int(v)
+	}
+	if v, ok := params.Arguments["maxTotalSize"].(string); ok && v != "" {
+		size, err := parseByteSize(v)
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		policy.MaxTotalBytes = size
+	}
+
+	if !policy.Enabled() {
+		s.writeToolText(req, "No hay politica de retencion: configura WP_BACKUP_MAX_AGE, WP_BACKUP_MAX_PER_POST o WP_BACKUP_MAX_TOTAL_SIZE, o indica maxAgeDays, maxPerPost o maxTotalSize.", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	candidates, err := wpDB.PruneBackups(policy, dryRun)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	var freed int64
+	for _, c := range candidates {
+		freed += c.Size
+	}
+
+	var b strings.Builder
+	if dryRun {
+		b.WriteString("PODA DE BACKUPS (SIMULACION)\n============================\n")
+	} else {
+		b.WriteString("PODA DE BACKUPS\n===============\n")
+	}
+	b.WriteString(fmt.Sprintf("Directorio: %s\nPolitica: %s\n", wpDB.backupDir, policy))
+
+	if len(candidates) == 0 {
+		b.WriteString("\nNingun backup supera la politica de retencion.")
+		s.writeToolText(req, b.String(), false)
+		return
+	}
+
+	verb := "Se borrarian"
+	if !dryRun {
+		verb = "Borrados"
+	}
+	b.WriteString(fmt.Sprintf("%s: %d backups (%s)\n\n", verb, len(candidates), formatBytes(freed)))
+	for _, c := range candidates {
+		b.WriteString(fmt.Sprintf("- %s (%s, %s)\n", c.Name, formatBytes(c.Size), c.Reason))
+	}
+	if dryRun {
+		b.WriteString("\nEjecuta prune_backups con dryRun=false para borrarlos.")
+	}
+	s.writeToolText(req, b.String(), false)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanBackupPrune(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+	// backup is a backup of post made days ago; its path is "p<post>-<days>d"
+	backup := func(post int64, days int, size int64) PostBackup {
+		return PostBackup{
+			Path:      fmt.Sprintf("p%d-%dd", post, days),
+			PostID:    post,
+			CreatedAt: now.Add(-time.Duration(days) * day),
+			Size:      size,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		backups []PostBackup // Newest first
+		policy  BackupRetention
+		want    []string // "<path> <age|count|size>"
+	}{
+		{
+			name:    "no limits",
+			backups: []PostBackup{backup(1, 0, 10), backup(1, 400, 10)},
+			want:    nil,
+		},
+		{
+			name:    "age",
+			backups: []PostBackup{backup(1, 1, 10), backup(2, 3, 10), backup(1, 8, 10), backup(2, 30, 10)},
+			policy:  BackupRetention{MaxAge: 7 * day},
+			want:    []string{"p1-8d age", "p2-30d age"},
+		},
+		{
+			name:    "newest backup of a post is kept however old",
+			backups: []PostBackup{backup(1, 1, 10), backup(2, 90, 10), backup(2, 120, 10)},
+			policy:  BackupRetention{MaxAge: 7 * day, MaxPerPost: 1, MaxTotalBytes: 1},
+			want:    []string{"p2-120d age"},
+		},
+		{
+			name:    "count per post",
+			backups: []PostBackup{backup(1, 1, 10), backup(2, 1, 10), backup(1, 2, 10), backup(1, 3, 10), backup(2, 4, 10), backup(1, 5, 10)},
+			policy:  BackupRetention{MaxPerPost: 2},
+			want:    []string{"p1-3d count", "p1-5d count"},
+		},
+		{
+			name:    "age before count",
+			backups: []PostBackup{backup(1, 0, 10), backup(1, 2, 10), backup(1, 3, 10), backup(1, 10, 10)},
+			policy:  BackupRetention{MaxAge: 7 * day, MaxPerPost: 2},
+			want:    []string{"p1-3d count", "p1-10d age"},
+		},
+		{
+			name:    "aged out backups still count towards the limit",
+			backups: []PostBackup{backup(1, 0, 10), backup(1, 8, 10), backup(1, 9, 10), backup(1, 1, 10)},
+			policy:  BackupRetention{MaxAge: 7 * day, MaxPerPost: 2},
+			want:    []string{"p1-8d age", "p1-9d age", "p1-1d count"},
+		},
+		{
+			name:    "size from the oldest",
+			backups: []PostBackup{backup(1, 0, 100), backup(2, 1, 100), backup(1, 2, 100), backup(2, 3, 100), backup(1, 4, 100)},
+			policy:  BackupRetention{MaxTotalBytes: 300},
+			want:    []string{"p1-4d size", "p2-3d size"},
+		},
+		{
+			name:    "size skips the newest backup of each post",
+			backups: []PostBackup{backup(1, 0, 100), backup(1, 1, 100), backup(2, 5, 500)},
+			policy:  BackupRetention{MaxTotalBytes: 400},
+			want:    []string{"p1-1d size"},
+		},
+		{
+			name:    "size after age and count",
+			backups: []PostBackup{backup(1, 0, 100), backup(1, 1, 100), backup(1, 2, 100), backup(1, 3, 100), backup(1, 30, 1000)},
+			policy:  BackupRetention{MaxAge: 7 * day, MaxPerPost: 3, MaxTotalBytes: 250},
+			want:    []string{"p1-3d count", "p1-30d age", "p1-2d size"},
+		},
+		{
+			name:    "size within the limit",
+			backups: []PostBackup{backup(1, 0, 100), backup(1, 1, 100)},
+			policy:  BackupRetention{MaxTotalBytes: 200},
+			want:    nil,
+		},
+	}
+
+	reasons := map[string]string{"mas antiguo": "age", "supera": "count", "tamano": "size"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range planBackupPrune(tt.backups, tt.policy, now) {
+				kind := c.Reason
+				for prefix, k := range reasons {
+					if strings.HasPrefix(c.Reason, prefix) {
+						kind = k
+					}
+				}
+				got = append(got, c.Path+" "+kind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruned %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupTimestampLayout is the timestamp format used in backup file names
+const backupTimestampLayout = "20060102_150405"
+
+// Structured backup format identifiers
+const (
+	backupFormatName    = "scp-divi-translation/post-backup"
+	backupFormatVersion = 1
+)
+
+// maxDiffLines limits the lines compared per field when diffing a backup
+const maxDiffLines = 3000
+
+// PostBackup describes a backup file written by SaveBackup or SaveFullBackup
+type PostBackup struct {
+	Path      string
+	Name      string
+	PostID    int64
+	Lang      string
+	CreatedAt time.Time
+	Full      bool // Full backups include title, slug and excerpt
+	Legacy    bool // Text backups written before the JSON format
+	Seq       int  // Suffix of the backups made in the same second (1: none)
+	Size      int64
+}
+
+// BackupFile is the JSON document written by SaveFullBackup. ContentSHA256
+// covers post.content and is verified when the backup is read.
+type BackupFile struct {
+	Format        string        `json:"format"`
+	FormatVersion int           `json:"formatVersion"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	ServerVersion string        `json:"serverVersion"`
+	TablePrefix   string        `json:"tablePrefix"`
+	ExtractionID  string        `json:"extractionId,omitempty"`
+	SourceLang    string        `json:"sourceLang,omitempty"`
+	Lang          string        `json:"lang"`
+	Post          WordPressPost `json:"post"`
+	PostMeta      []PostMeta    `json:"postmeta"`
+	ContentSHA256 string        `json:"contentSha256"`
+}
+
+// contentChecksum returns the hex SHA-256 of a post content
+func contentChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// newBackupFile builds the backup document of a post
+func newBackupFile(post *WordPressPost, meta []PostMeta, sourceLang, lang, extractionID, tablePrefix string, now time.Time) *BackupFile {
+	if meta == nil {
+		meta = []PostMeta{}
+	}
+	return &BackupFile{
+		Format:        backupFormatName,
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     now,
+		ServerVersion: SERVER_VERSION,
+		TablePrefix:   tablePrefix,
+		ExtractionID:  extractionID,
+		SourceLang:    sourceLang,
+		Lang:          lang,
+		Post:          *post,
+		PostMeta:      meta,
+		ContentSHA256: contentChecksum(post.PostContent),
+	}
+}
+
+// encode serializes the backup as indented JSON
+func (f *BackupFile) encode() ([]byte, error) {
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// parseBackupFile decodes a JSON backup and verifies its checksum
+func parseBackupFile(data []byte) (*BackupFile, error) {
+	f := &BackupFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("backup JSON no valido: %v", err)
+	}
+	if f.Format != backupFormatName {
+		return nil, fmt.Errorf("formato de backup desconocido: %q", f.Format)
+	}
+	if f.FormatVersion > backupFormatVersion {
+		return nil, fmt.Errorf("version de backup %d no soportada (maxima %d)", f.FormatVersion, backupFormatVersion)
+	}
+	if sum := contentChecksum(f.Post.PostContent); sum != f.ContentSHA256 {
+		return nil, fmt.Errorf("el SHA-256 del contenido no coincide (backup corrupto): esperado %s, calculado %s", f.ContentSHA256, sum)
+	}
+	return f, nil
+}
+
+// parseLegacyBackup reads the text backups written before the JSON format:
+// the "=== POST_TITLE ===" layout of full backups, or raw content
+func parseLegacyBackup(data []byte, backup *PostBackup) (*BackupFile, error) {
+	f := &BackupFile{
+		CreatedAt: backup.CreatedAt,
+		Lang:      backup.Lang,
+		Post:      WordPressPost{ID: backup.PostID},
+	}
+	if !backup.Full {
+		f.Post.PostContent = string(data)
+		f.ContentSHA256 = contentChecksum(f.Post.PostContent)
+		return f, nil
+	}
+
+	text := string(data)
+	section := func(header, next string) (string, error) {
+		start := strings.Index(text, header+"\n")
+		if start < 0 {
+			return "", fmt.Errorf("backup sin seccion %s", header)
+		}
+		value := text[start+len(header)+1:]
+		if next == "" {
+			return strings.TrimSuffix(value, "\n"), nil
+		}
+		end := strings.Index(value, "\n\n"+next+"\n")
+		if end < 0 {
+			return "", fmt.Errorf("backup sin seccion %s", next)
+		}
+		return value[:end], nil
+	}
+
+	var err error
+	if f.Post.PostTitle, err = section("=== POST_TITLE ===", "=== POST_NAME (SLUG) ==="); err != nil {
+		return nil, err
+	}
+	if f.Post.PostName, err = section("=== POST_NAME (SLUG) ===", "=== POST_EXCERPT ==="); err != nil {
+		return nil, err
+	}
+	if f.Post.PostExcerpt, err = section("=== POST_EXCERPT ===", "=== POST_CONTENT ==="); err != nil {
+		return nil, err
+	}
+	if f.Post.PostContent, err = section("=== POST_CONTENT ===", ""); err != nil {
+		return nil, err
+	}
+	f.ContentSHA256 = contentChecksum(f.Post.PostContent)
+	return f, nil
+}
+
+// parseBackupTimestamp parses the timestamp at the end of a backup name
+func parseBackupTimestamp(rest string) (time.Time, bool) {
+	if len(rest) < len(backupTimestampLayout)+2 {
+		return time.Time{}, false
+	}
+	created, err := time.ParseInLocation(backupTimestampLayout, rest[len(rest)-len(backupTimestampLayout):], time.Local)
+	return created, err == nil
+}
+
+// parseBackupName extracts the post ID, language and date from a backup file
+// name: post_<id>_[full_]backup_<lang>_<YYYYMMDD_HHMMSS>[_<n>].json (or
+// legacy .txt), where _<n> tells apart the backups made in the same second
+func parseBackupName(name string) (*PostBackup, bool) {
+	ext := filepath.Ext(name)
+	if !strings.HasPrefix(name, "post_") || (ext != ".json" && ext != ".txt") {
+		return nil, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, "post_"), ext)
+
+	var id int64
+	var kind string
+	idEnd := strings.Index(rest, "_")
+	if idEnd < 0 {
+		return nil, false
+	}
+	if _, err := fmt.Sscanf(rest[:idEnd], "%d", &id); err != nil {
+		return nil, false
+	}
+	rest = rest[idEnd+1:]
+
+	switch {
+	case strings.HasPrefix(rest, "full_backup_"):
+		kind = "full"
+		rest = strings.TrimPrefix(rest, "full_backup_")
+	case strings.HasPrefix(rest, "backup_"):
+		kind = "content"
+		rest = strings.TrimPrefix(rest, "backup_")
+	default:
+		return nil, false
+	}
+
+	seq := 1
+	created, ok := parseBackupTimestamp(rest)
+	if !ok {
+		i := strings.LastIndex(rest, "_")
+		if i < 0 {
+			return nil, false
+		}
+		n, err := strconv.Atoi(rest[i+1:])
+		if err != nil || n < 2 {
+			return nil, false
+		}
+		rest, seq = rest[:i], n
+		if created, ok = parseBackupTimestamp(rest); !ok {
+			return nil, false
+		}
+	}
+
+	return &PostBackup{
+		Name:      name,
+		PostID:    id,
+		Lang:      strings.TrimSuffix(rest[:len(rest)-len(backupTimestampLayout)], "_"),
+		CreatedAt: created,
+		Full:      kind == "full" || ext == ".json",
+		Legacy:    ext == ".txt",
+		Seq:       seq,
+	}, true
+}
+
+// ListBackups returns the backups of a post, newest first
+func (wp *WordPressDB) ListBackups(postID int64) ([]PostBackup, error) {
+	all, err := wp.ListAllBackups()
+	if err != nil {
+		return nil, err
+	}
+	var backups []PostBackup
+	for _, backup := range all {
+		if backup.PostID == postID {
+			backups = append(backups, backup)
+		}
+	}
+	return backups, nil
+}
+
+// ListAllBackups returns the backups of every post, newest first
+func (wp *WordPressDB) ListAllBackups() ([]PostBackup, error) {
+	entries, err := os.ReadDir(wp.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error leyendo directorio de backup: %v", err)
+	}
+
+	var backups []PostBackup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		backup, ok := parseBackupName(entry.Name())
+		if !ok {
+			continue
+		}
+		backup.Path = filepath.Join(wp.backupDir, entry.Name())
+		if info, err := entry.Info(); err == nil {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, *backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].Seq > backups[j].Seq
+	})
+	return backups, nil
+}
+
+// backupPath resolves a backup file name inside the backup directory, so
+// tools cannot read arbitrary files
+func (wp *WordPressDB) backupPath(name string) (string, *PostBackup, error) {
+	base := filepath.Base(strings.TrimSpace(name))
+	backup, ok := parseBackupName(base)
+	if !ok {
+		return "", nil, fmt.Errorf("'%s' no es un archivo de backup valido", name)
+	}
+	path := filepath.Join(wp.backupDir, base)
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, fmt.Errorf("backup '%s' no encontrado en %s", base, wp.backupDir)
+	}
+	backup.Path = path
+	return path, backup, nil
+}
+
+// ReadBackup loads a backup file, JSON or legacy text. Content-only legacy
+// backups return just the post content.
+func (wp *WordPressDB) ReadBackup(name string) (*BackupFile, *PostBackup, error) {
+	path, backup, err := wp.backupPath(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error leyendo backup: %v", err)
+	}
+
+	var f *BackupFile
+	if backup.Legacy {
+		f, err = parseLegacyBackup(data, backup)
+	} else {
+		f, err = parseBackupFile(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Post.ID != backup.PostID {
+		return nil, nil, fmt.Errorf("el backup contiene el post %d pero su nombre indica %d", f.Post.ID, backup.PostID)
+	}
+	return f, backup, nil
+}
+
+// RestoreBackup writes a backup back into its post. The current state of the
+// post is saved first as a new full backup, whose path is returned.
+func (wp *WordPressDB) RestoreBackup(name string) (string, *PostBackup, error) {
+	saved, backup, err := wp.ReadBackup(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	current, err := wp.GetPost(backup.PostID)
+	if err != nil {
+		return "", nil, err
+	}
+	freshBackup, err := wp.SaveFullBackup(current, "", "prerestore", "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	post := saved.Post
+	if backup.Full {
+		// The SEO fields may have been translated with the post
+		meta := make(map[string]string)
+		for _, f := range wp.seoMetaFrom(saved.PostMeta, false) {
+			meta[f.Key] = f.Original
+		}
+		_, err = wp.UpdatePostFull(backup.PostID, post.PostTitle, post.PostName, post.PostExcerpt, post.PostContent, meta)
+	} else {
+		_, err = wp.UpdatePostContent(backup.PostID, post.PostContent)
+	}
+	if err != nil {
+		return freshBackup, nil, err
+	}
+	return freshBackup, backup, nil
+}
+
+// splitForDiff breaks text into lines, putting each Divi shortcode on its own
+// line so single-line post_content diffs stay readable
+func splitForDiff(text string) []string {
+	text = strings.ReplaceAll(text, "][", "]\n[")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// lineDiff returns the removed (-) and added (+) lines from old to cur, using
+// a longest common subsequence over lines. Empty if both are equal.
+func lineDiff(old, cur string) string {
+	if old == cur {
+		return ""
+	}
+	x, y := splitForDiff(old), splitForDiff(cur)
+	if len(x) > maxDiffLines || len(y) > maxDiffLines {
+		return fmt.Sprintf("  (demasiadas lineas para comparar: %d vs %d)\n", len(x), len(y))
+	}
+
+	// lcs[i][j] = length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			b.WriteString(fmt.Sprintf("- %4d| %s\n", i+1, x[i]))
+			i++
+		default:
+			b.WriteString(fmt.Sprintf("+ %4d| %s\n", j+1, y[j]))
+			j++
+		}
+	}
+	return b.String()
+}
+
+// diffPosts compares the saved fields with the current post; label names the
+// saved side in the headers ("backup", "extraccion")
+func diffPosts(saved, current *WordPressPost, full bool, label string) string {
+	type field struct {
+		name      string
+		old, cur  string
+		fullField bool
+	}
+	fields := []field{
+		{"TITULO", saved.PostTitle, current.PostTitle, true},
+		{"SLUG", saved.PostName, current.PostName, true},
+		{"EXCERPT", saved.PostExcerpt, current.PostExcerpt, true},
+		{"CONTENIDO", saved.PostContent, current.PostContent, false},
+	}
+
+	var b strings.Builder
+	for _, f := range fields {
+		if f.fullField && !full {
+			continue
+		}
+		diff := lineDiff(f.old, f.cur)
+		if diff == "" {
+			b.WriteString(fmt.Sprintf("--- %s: sin cambios\n", f.name))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("--- %s (- %s, + actual) ---\n%s", f.name, label, diff))
+	}
+	return b.String()
+}
+
+func (s *MCPServer) handleListBackups(req JSONRPCRequest, params CallToolParams) {
+	postIDFloat, _ := params.Arguments["postId"].(float64)
+	postID := int64(postIDFloat)
+	if postID == 0 {
+		s.writeToolText(req, "ERROR: postId es obligatorio", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	backups, err := wpDB.ListBackups(postID)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	if len(backups) == 0 {
+		s.writeToolText(req, fmt.Sprintf("No hay backups del post %d en %s.", postID, wpDB.backupDir), false)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("BACKUPS DEL POST %d (%d)\n========================\n", postID, len(backups)))
+	for _, backup := range backups {
+		kind := "completo"
+		if !backup.Full {
+			kind = "solo contenido"
+		}
+		if backup.Legacy {
+			kind += ", texto antiguo"
+		}
+		b.WriteString(fmt.Sprintf("- %s\n  %s | idioma %s | %s | %d bytes\n",
+			backup.Name, backup.CreatedAt.Format("2006-01-02 15:04:05"), backup.Lang, kind, backup.Size))
+	}
+	b.WriteString("\nUsa show_backup para ver o comparar un backup y restore_backup para restaurarlo.")
+	s.writeToolText(req, b.String(), false)
+}
+
+func (s *MCPServer) handleShowBackup(req JSONRPCRequest, params CallToolParams) {
+	name, _ := params.Arguments["backup"].(string)
+	diff, _ := params.Arguments["diff"].(bool)
+	if name == "" {
+		s.writeToolText(req, "ERROR: backup es obligatorio", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	saved, backup, err := wpDB.ReadBackup(name)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	header := fmt.Sprintf("BACKUP %s\n==============================\nPost ID: %d\nFecha: %s\nIdioma: %s\nSHA-256 contenido: %s\n",
+		backup.Name, backup.PostID, backup.CreatedAt.Format("2006-01-02 15:04:05"), backup.Lang, saved.ContentSHA256)
+	if saved.SourceLang != "" {
+		header += fmt.Sprintf("Idioma origen: %s\n", saved.SourceLang)
+	}
+	if backup.Legacy {
+		header += "Formato: texto antiguo (sin postmeta)\n"
+	} else {
+		header += fmt.Sprintf("Formato: %s v%d (servidor %s, prefijo %s)\nTipo/estado: %s / %s\nModificado (GMT): %s\nPostmeta: %d claves\n",
+			saved.Format, saved.FormatVersion, saved.ServerVersion, saved.TablePrefix,
+			saved.Post.PostType, saved.Post.PostStatus, saved.Post.PostModifiedGMT.Format("2006-01-02 15:04:05"), len(saved.PostMeta))
+		if saved.ExtractionID != "" {
+			header += fmt.Sprintf("extractionId: %s\n", saved.ExtractionID)
+		}
+	}
+
+	if diff {
+		current, err := wpDB.GetPost(backup.PostID)
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		s.writeToolText(req, header+"\nDIFERENCIAS CON EL POST ACTUAL:\n"+diffPosts(&saved.Post, current, backup.Full, "backup"), false)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	if backup.Full {
+		b.WriteString(fmt.Sprintf("\n=== TITULO ===\n%s\n\n=== SLUG ===\n%s\n\n=== EXCERPT ===\n%s\n", saved.Post.PostTitle, saved.Post.PostName, saved.Post.PostExcerpt))
+	}
+	b.WriteString(fmt.Sprintf("\n=== CONTENIDO (%d caracteres) ===\n%s", len(saved.Post.PostContent), saved.Post.PostContent))
+	s.writeToolText(req, b.String(), false)
+}
+
+func (s *MCPServer) handleRestoreBackup(req JSONRPCRequest, params CallToolParams) {
+	name, _ := params.Arguments["backup"].(string)
+	if name == "" {
+		s.writeToolText(req, "ERROR: backup es obligatorio", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	freshBackup, backup, err := wpDB.RestoreBackup(name)
+	if err != nil {
+		text := fmt.Sprintf("ERROR restaurando backup: %v", err)
+		if freshBackup != "" {
+			text += fmt.Sprintf("\nEl estado previo del post se guardo en: %s", freshBackup)
+		}
+		s.writeToolText(req, text, true)
+		return
+	}
+
+	fields := "titulo, slug, excerpt y contenido"
+	if !backup.Full {
+		fields = "contenido"
+	}
+	s.log("Backup restaurado: post %d desde %s", backup.PostID, backup.Name)
+	s.writeToolText(req, fmt.Sprintf(`BACKUP RESTAURADO
+=================
+Post ID: %d
+Backup: %s (%s)
+Campos restaurados: %s
+
+Estado anterior a la restauracion guardado en:
+%s%s`, backup.PostID, backup.Name, backup.CreatedAt.Format("2006-01-02 15:04:05"), fields, freshBackup,
+		formatSaveActions(wpDB.RunPostSaveHooks(backup.PostID))), false)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBackupPost() *WordPressPost {
+	return &WordPressPost{
+		ID:          42,
+		PostTitle:   "Mision",
+		PostName:    "mision",
+		PostExcerpt: "Quienes somos",
+		PostContent: "[et_pb_section][et_pb_text]<p>Hola</p>[/et_pb_text][/et_pb_section]",
+		PostStatus:  "publish",
+		PostType:    "page",
+	}
+}
+
+func TestParseBackupFile(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 30, 0, 0, time.UTC)
+	meta := []PostMeta{{Key: "_et_pb_use_builder", Value: "on"}}
+	data, err := newBackupFile(testBackupPost(), meta, "es", "en", "abc123", "wp_", now).encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parseBackupFile(data)
+	if err != nil {
+		t.Fatalf("valid backup: %v", err)
+	}
+	if f.Post.PostContent != testBackupPost().PostContent || f.Post.PostTitle != "Mision" || f.SourceLang != "es" || f.Lang != "en" || f.ExtractionID != "abc123" {
+		t.Errorf("decoded backup = %+v", f)
+	}
+	if len(f.PostMeta) != 1 || f.PostMeta[0].Key != "_et_pb_use_builder" || !f.CreatedAt.Equal(now) {
+		t.Errorf("decoded meta/date = %+v, %v", f.PostMeta, f.CreatedAt)
+	}
+
+	tests := []struct {
+		name  string
+		data  string
+		error string
+	}{
+		{"content edited", strings.Replace(string(data), "Hola", "Adios", 1), "SHA-256"},
+		{"checksum edited", strings.Replace(string(data), f.ContentSHA256, strings.Repeat("0", 64), 1), "SHA-256"},
+		{"unknown format", strings.Replace(string(data), backupFormatName, "otro/formato", 1), "formato de backup desconocido"},
+		{"newer version", strings.Replace(string(data), `"formatVersion": 1`, `"formatVersion": 99`, 1), "version de backup 99"},
+		{"not JSON", "=== WORDPRESS POST BACKUP ===", "JSON no valido"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBackupFile([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.error)
+			}
+		})
+	}
+}
+
+// legacyFullBackup is the text layout SaveFullBackup wrote before JSON backups
+const legacyFullBackup = `=== WORDPRESS POST BACKUP ===
+Post ID: 42
+Date: 20240115_093000
+Target Language: en
+
+=== POST_TITLE ===
+Mision
+
+=== POST_NAME (SLUG) ===
+mision
+
+=== POST_EXCERPT ===
+Linea 1
+
+Linea 2
+
+=== POST_CONTENT ===
+[et_pb_section][et_pb_text]<p>Hola</p>
+
+<p>Parrafo</p>[/et_pb_text][/et_pb_section]
+`
+
+func TestParseLegacyBackup(t *testing.T) {
+	created := time.Date(2024, 1, 15, 9, 30, 0, 0, time.Local)
+
+	full := &PostBackup{PostID: 42, Lang: "en", CreatedAt: created, Full: true, Legacy: true}
+	f, err := parseLegacyBackup([]byte(legacyFullBackup), full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WordPressPost{
+		ID:          42,
+		PostTitle:   "Mision",
+		PostName:    "mision",
+		PostExcerpt: "Linea 1\n\nLinea 2",
+		PostContent: "[et_pb_section][et_pb_text]<p>Hola</p>\n\n<p>Parrafo</p>[/et_pb_text][/et_pb_section]",
+	}
+	if f.Post != want {
+		t.Errorf("post = %+v\nwant %+v", f.Post, want)
+	}
+	if f.Lang != "en" || !f.CreatedAt.Equal(created) || f.ContentSHA256 != contentChecksum(want.PostContent) {
+		t.Errorf("backup = %+v", f)
+	}
+
+	// A section lost from the layout is an error, not an empty field
+	broken := strings.Replace(legacyFullBackup, "=== POST_EXCERPT ===\n", "", 1)
+	if _, err := parseLegacyBackup([]byte(broken), full); err == nil || !strings.Contains(err.Error(), "POST_EXCERPT") {
+		t.Errorf("missing section: err = %v", err)
+	}
+
+	// Content-only backups are the raw post content
+	content := "[et_pb_section]\n=== POST_TITLE ===\n[/et_pb_section]\n"
+	f, err = parseLegacyBackup([]byte(content), &PostBackup{PostID: 7, Lang: "fr", CreatedAt: created, Legacy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Post.ID != 7 || f.Post.PostContent != content || f.Post.PostTitle != "" || f.Lang != "fr" {
+		t.Errorf("content-only backup = %+v", f)
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.ParseInLocation(backupTimestampLayout, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		name string
+		want *PostBackup
+	}{
+		{"post_42_full_backup_es_to_en_20250301_103000.json", &PostBackup{PostID: 42, Lang: "es_to_en", CreatedAt: at("20250301_103000"), Full: true, Seq: 1}},
+		{"post_42_full_backup_en_20250301_103000_2.json", &PostBackup{PostID: 42, Lang: "en", CreatedAt: at("20250301_103000"), Full: true, Seq: 2}},
+		{"post_42_full_backup_en_20250301_103000_12.json", &PostBackup{PostID: 42, Lang: "en", CreatedAt: at("20250301_103000"), Full: true, Seq: 12}},
+		{"post_7_full_backup_prerestore_20240115_093000.json", &PostBackup{PostID: 7, Lang: "prerestore", CreatedAt: at("20240115_093000"), Full: true, Seq: 1}},
+		{"post_42_full_backup_en_20240115_093000.txt", &PostBackup{PostID: 42, Lang: "en", CreatedAt: at("20240115_093000"), Full: true, Legacy: true, Seq: 1}},
+		{"post_42_backup_en_20240115_093000.txt", &PostBackup{PostID: 42, Lang: "en", CreatedAt: at("20240115_093000"), Legacy: true, Seq: 1}},
+		{"post_42_full_backup_en_20250301_103000_1.json", nil},
+		{"post_42_full_backup_en_20250301_103000_x.json", nil},
+		{"post_42_full_backup_en_2025.json", nil},
+		{"post_x_full_backup_en_20250301_103000.json", nil},
+		{"post_42_copy_en_20250301_103000.json", nil},
+		{"post_42_full_backup_en_20250301_103000.bak", nil},
+		{"extraction_abc.json", nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseBackupName(tt.name)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("%s: parsed as %+v, want rejected", tt.name, got)
+			}
+			continue
+		}
+		tt.want.Name = tt.name
+		if !ok || *got != *tt.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListAllBackupsOrdersSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"post_1_full_backup_en_20250301_103000.json",
+		"post_1_full_backup_en_20250301_103000_10.json",
+		"post_1_full_backup_en_20250301_103000_2.json",
+		"post_1_full_backup_en_20250301_103001.json",
+		"notas.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := (&WordPressDB{backupDir: dir}).ListAllBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	want := "post_1_full_backup_en_20250301_103001.json post_1_full_backup_en_20250301_103000_10.json post_1_full_backup_en_20250301_103000_2.json post_1_full_backup_en_20250301_103000.json"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("order:\n got %s\nwant %s", got, want)
+	}
+}
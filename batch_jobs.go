@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batch item states
+const (
+	batchPending    = "pending"
+	batchInProgress = "in_progress"
+	batchDone       = "done"
+	batchFailed     = "failed"
+	batchSkipped    = "skipped"
+)
+
+// BatchJob tracks the translation of several WordPress posts, one extraction at a time
+type BatchJob struct {
+	ID          string
+	TargetLang  string
+	SourceLang  string // Empty: detected for each post
+	Selection   string // Human-readable description of how posts were selected
+	CreateCopy  bool   // Save each translation as a new post
+	CopyStatus  string // post_status of the new posts
+	Owner       string // HTTP client session that created it (empty for stdio)
+	Items       []*BatchItem
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time
+
+	mu sync.Mutex // Guards Items and the timestamps
+}
+
+// BatchItem is the progress record of one post in a batch job
+type BatchItem struct {
+	PostID       int64
+	Title        string
+	Status       string
+	ExtractionID string
+	NewPostID    int64  // Translated copy, when the job creates new posts
+	Message      string // Error or skip reason
+}
+
+// Global storage for batch jobs
+var (
+	batchJobs      = make(map[string]*BatchJob)
+	batchJobsMutex sync.Mutex
+)
+
+// batchJobStateVersion is the format version of persisted batch job files
+const batchJobStateVersion = 1
+
+// persistedBatchJob is the on-disk form of a batch job
+type persistedBatchJob struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"savedAt"`
+	Job     *BatchJob `json:"job"`
+}
+
+// batchJobFile returns the state file of a batch job
+func batchJobFile(dir, jobID string) string {
+	return filepath.Join(dir, "batch_"+sanitizeFilename(jobID)+".json")
+}
+
+// batchJobExists reports whether a batch job is loaded
+func batchJobExists(jobID string) bool {
+	batchJobsMutex.Lock()
+	defer batchJobsMutex.Unlock()
+	_, ok := batchJobs[jobID]
+	return ok
+}
+
+// persistBatchJob writes the job to the state directory of the extractions,
+// so the extractions restored after a restart still find their job. Errors
+// are only logged. job.mu must be held.
+func (s *MCPServer) persistBatchJob(job *BatchJob) {
+	dir := sessionStateDir()
+	if dir == "" {
+		return
+	}
+	data, err := json.Marshal(persistedBatchJob{
+		Version: batchJobStateVersion,
+		SavedAt: time.Now(),
+		Job:     job,
+	})
+	if err != nil {
+		s.log("Error serializando lote %s: %v", job.ID, err)
+		return
+	}
+	if err := writeStateFile(batchJobFile(dir, job.ID), data); err != nil {
+		s.log("Error guardando lote %s: %v", job.ID, err)
+	}
+}
+
+// restoreBatchJobs reloads the persisted batch jobs of the state directory,
+// deleting the ones untouched for longer than maxAge or unreadable
+func (s *MCPServer) restoreBatchJobs(dir string, entries []os.DirEntry, maxAge time.Duration) {
+	restored, expired := 0, 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "batch_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		var state persistedBatchJob
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+		if err == nil && (state.Version != batchJobStateVersion || state.Job == nil || state.Job.ID == "") {
+			err = fmt.Errorf("version de lote %d no soportada", state.Version)
+		}
+		if err != nil {
+			s.log("Descartando lote %s: %v", name, err)
+			os.Remove(path)
+			continue
+		}
+		if time.Since(state.Job.UpdatedAt) > maxAge {
+			expired++
+			os.Remove(path)
+			continue
+		}
+
+		batchJobsMutex.Lock()
+		if _, exists := batchJobs[state.Job.ID]; !exists {
+			batchJobs[state.Job.ID] = state.Job
+			restored++
+		}
+		batchJobsMutex.Unlock()
+	}
+
+	if restored > 0 || expired > 0 {
+		s.log("Lotes restaurados: %d (caducados: %d) desde %s", restored, expired, dir)
+	}
+}
+
+// counts returns the number of items per status
+func (j *BatchJob) counts() map[string]int {
+	counts := make(map[string]int)
+	for _, it := range j.Items {
+		counts[it.Status]++
+	}
+	return counts
+}
+
+// finished reports whether no item is pending or in progress
+func (j *BatchJob) finished() bool {
+	c := j.counts()
+	return c[batchPending] == 0 && c[batchInProgress] == 0
+}
+
+// progressLine summarizes the job in one line
+func (j *BatchJob) progressLine() string {
+	c := j.counts()
+	return fmt.Sprintf("Lote %s: %d/%d procesados (%d ok, %d fallidos, %d omitidos, %d pendientes)",
+		j.ID, c[batchDone]+c[batchFailed]+c[batchSkipped], len(j.Items),
+		c[batchDone], c[batchFailed], c[batchSkipped], c[batchPending]+c[batchInProgress])
+}
+
+// summary lists every item with its final state
+func (j *BatchJob) summary() string {
+	var b strings.Builder
+	state := "EN CURSO"
+	if j.finished() {
+		state = "FINALIZADO"
+	}
+	sourceLang := j.SourceLang
+	if sourceLang == "" {
+		sourceLang = "se detecta en cada post"
+	}
+	b.WriteString(fmt.Sprintf(`LOTE DE TRADUCCION %s
+==============================
+jobId: %s
+Idioma origen: %s
+Idioma destino: %s
+Seleccion: %s
+Creado: %s
+%s
+`, state, j.ID, sourceLang, j.TargetLang, j.Selection, j.CreatedAt.Format("2006-01-02 15:04:05"), j.progressLine()))
+
+	for _, status := range []string{batchDone, batchFailed, batchSkipped, batchInProgress, batchPending} {
+		var lines []string
+		for _, it := range j.Items {
+			if it.Status != status {
+				continue
+			}
+			line := fmt.Sprintf("- Post %d: %s", it.PostID, truncateForDisplay(it.Title, 60))
+			if it.NewPostID != 0 {
+				line += fmt.Sprintf(" -> post nuevo %d", it.NewPostID)
+			}
+			if it.ExtractionID != "" {
+				line += fmt.Sprintf(" [extractionId %s]", it.ExtractionID)
+			}
+			if it.Message != "" {
+				line += " - " + it.Message
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			b.WriteString(fmt.Sprintf("\n%s (%d):\n%s\n", strings.ToUpper(status), len(lines), strings.Join(lines, "\n")))
+		}
+	}
+	return b.String()
+}
+
+// parsePostIDs reads a JSON array of post IDs from tool arguments
+func parsePostIDs(v interface{}) []int64 {
+	list, _ := v.([]interface{})
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, item := range list {
+		var id int64
+		switch n := item.(type) {
+		case float64:
+			id = int64(n)
+		case string:
+			fmt.Sscanf(n, "%d", &id)
+		}
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *MCPServer) handleCreateBatchJob(req JSONRPCRequest, params CallToolParams) {
+	targetLang, _ := params.Arguments["targetLang"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
+	postIDs := parsePostIDs(params.Arguments["postIds"])
+
+	query := PostQuery{}
+	query.PostType, _ = params.Arguments["postType"].(string)
+	query.PostType = expandPostTypeAlias(query.PostType)
+	query.Status, _ = params.Arguments["status"].(string)
+	query.Category, _ = params.Arguments["category"].(string)
+	query.DateFrom, _ = params.Arguments["dateFrom"].(string)
+	query.DateTo, _ = params.Arguments["dateTo"].(string)
+	query.ModifiedSince, _ = params.Arguments["modifiedSince"].(string)
+	if limit, ok := params.Arguments["limit"].(float64); ok {
+		query.Limit = int(limit)
+	}
+
+	if targetLang == "" {
+		s.writeToolText(req, "ERROR: targetLang es obligatorio", true)
+		return
+	}
+	if err := checkLanguagePair(sourceLang, targetLang); err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	job := &BatchJob{
+		ID:         generateExtractionID(),
+		TargetLang: targetLang,
+		SourceLang: sourceLang,
+		Owner:      s.owner,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	job.CreateCopy, _ = params.Arguments["createCopy"].(bool)
+	job.CopyStatus, _ = params.Arguments["copyStatus"].(string)
+
+	if len(postIDs) > 0 {
+		job.Selection = fmt.Sprintf("%d IDs explicitos", len(postIDs))
+		for _, id := range postIDs {
+			item := &BatchItem{PostID: id, Status: batchPending}
+			if post, err := wpDB.GetPost(id); err != nil {
+				item.Status = batchFailed
+				item.Message = err.Error()
+			} else {
+				item.Title = post.PostTitle
+			}
+			job.Items = append(job.Items, item)
+		}
+	} else {
+		posts, err := wpDB.FindPosts(query)
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		job.Selection = describePostQuery(query)
+		for _, post := range posts {
+			job.Items = append(job.Items, &BatchItem{PostID: post.ID, Title: post.PostTitle, Status: batchPending})
+		}
+	}
+
+	if len(job.Items) == 0 {
+		s.writeToolText(req, fmt.Sprintf("No hay posts que cumplan la seleccion (%s).", job.Selection), true)
+		return
+	}
+
+	s.persistBatchJob(job)
+	batchJobsMutex.Lock()
+	batchJobs[job.ID] = job
+	batchJobsMutex.Unlock()
+
+	s.log("Lote creado: jobId=%s, %d posts, idioma %s", job.ID, len(job.Items), targetLang)
+
+	s.writeToolText(req, job.summary()+fmt.Sprintf(`
+Usa "batch_next_extraction" con jobId="%s" para obtener la siguiente extraccion.
+Tras cada submit_bulk_translation, vuelve a llamar a batch_next_extraction hasta que el lote finalice.`, job.ID), false)
+}
+
+// describePostQuery renders the query filters for the job summary
+func describePostQuery(q PostQuery) string {
+	var parts []string
+	postType := q.PostType
+	if postType == "" {
+		postType = "post,page"
+	}
+	parts = append(parts, "tipo="+postType)
+	status := q.Status
+	if status == "" {
+		status = "publish"
+	}
+	parts = append(parts, "estado="+status)
+	if q.Category != "" {
+		parts = append(parts, "categoria="+q.Category)
+	}
+	if q.DateFrom != "" {
+		parts = append(parts, "desde="+q.DateFrom)
+	}
+	if q.DateTo != "" {
+		parts = append(parts, "hasta="+q.DateTo)
+	}
+	if q.ModifiedSince != "" {
+		parts = append(parts, "modificado desde="+q.ModifiedSince)
+	}
+	if q.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("limite=%d", q.Limit))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *MCPServer) handleBatchNextExtraction(req JSONRPCRequest, params CallToolParams) {
+	jobID, _ := params.Arguments["jobId"].(string)
+	skipCurrent, _ := params.Arguments["skipCurrent"].(bool)
+
+	job := s.lookupBatchJob(jobID, true)
+	if job == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: jobId '%s' no encontrado. Usa create_batch_job primero.", jobID), true)
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	session, item, resent, err := s.advanceBatchJob(req.Context(), job, skipCurrent)
+	if err != nil {
+		s.writeToolText(req, err.Error(), true)
+		return
+	}
+	if session == nil {
+		s.writeToolText(req, job.summary(), false)
+		return
+	}
+
+	response := s.generateBulkExtractResponseWithID(session)
+	session.mu.Unlock()
+	if resent {
+		s.writeToolText(req, fmt.Sprintf("%s\nPost %d en curso (reenvio):\n\n%s", job.progressLine(), item.PostID, response), false)
+		return
+	}
+	s.writeToolText(req, fmt.Sprintf("%s\nPost %d: %s\n\n%s", job.progressLine(), item.PostID, item.Title, response), false)
+}
+
+// lookupBatchJob returns a batch job this client may use, or nil. With adopt,
+// jobs whose HTTP session no longer exists are taken over.
+func (s *MCPServer) lookupBatchJob(jobID string, adopt bool) *BatchJob {
+	batchJobsMutex.Lock()
+	defer batchJobsMutex.Unlock()
+	job, exists := batchJobs[jobID]
+	if !exists {
+		return nil
+	}
+	if adopt && s.mayAdopt(job.Owner) {
+		s.log("Lote %s adoptado por la sesion '%s'", jobID, s.owner)
+		job.mu.Lock()
+		job.Owner = s.owner
+		s.persistBatchJob(job)
+		job.mu.Unlock()
+	}
+	if !s.mayAccess(job.Owner) {
+		return nil
+	}
+	return job
+}
+
+// advanceBatchJob returns the session of the item in progress (resent=true)
+// or extracts the next pending post. The session is returned locked; it is nil
+// when the job has nothing left. job.mu must be held.
+func (s *MCPServer) advanceBatchJob(ctx context.Context, job *BatchJob, skipCurrent bool) (*BulkTranslationSession, *BatchItem, bool, error) {
+	defer s.persistBatchJob(job)
+
+	// An item already in progress is sent again unless the client skips it
+	for _, item := range job.Items {
+		if item.Status != batchInProgress {
+			continue
+		}
+		extractionsMutex.RLock()
+		session, active := activeExtractions[item.ExtractionID]
+		extractionsMutex.RUnlock()
+
+		// A submit holding the session finishes the item itself (and needs
+		// the job lock to do so), so it is never waited for here
+		if active && !session.mu.TryLock() {
+			return nil, item, false, fmt.Errorf("La extraccion %s del post %d se esta procesando en otra llamada. Vuelve a intentarlo cuando termine.", item.ExtractionID, item.PostID)
+		}
+
+		if skipCurrent || !active {
+			if active {
+				s.forgetSession(item.ExtractionID)
+				session.mu.Unlock()
+			}
+			item.Status = batchSkipped
+			item.Message = "omitido por el cliente"
+			if !active {
+				item.Message = "la extraccion ya no esta activa"
+			}
+			continue
+		}
+		// The extraction follows its job when this client adopted it
+		if session.Owner != s.owner {
+			s.adoptSession(session)
+		}
+		return session, item, true, nil
+	}
+
+	for _, item := range job.Items {
+		if item.Status != batchPending {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, false, fmt.Errorf("Extraccion del lote cancelada")
+		}
+
+		session, err := s.extractWordPressPost(item.PostID, job.SourceLang, job.TargetLang)
+		if err == errNoTranslatableText {
+			item.Status = batchSkipped
+			item.Message = "sin texto Divi para traducir"
+			continue
+		}
+		if err != nil {
+			item.Status = batchFailed
+			item.Message = err.Error()
+			continue
+		}
+
+		session.mu.Lock()
+		session.BatchJobID = job.ID
+		session.CreateCopy = job.CreateCopy
+		session.CopyStatus = job.CopyStatus
+		s.persistSession(session)
+		item.Status = batchInProgress
+		item.ExtractionID = session.ExtractionID
+		job.UpdatedAt = time.Now()
+
+		s.log("Lote %s: extraccion %s para post %d", job.ID, session.ExtractionID, item.PostID)
+		return session, item, false, nil
+	}
+
+	// Nothing left: the job is done
+	if job.CompletedAt.IsZero() {
+		job.CompletedAt = time.Now()
+	}
+	return nil, nil, false, nil
+}
+
+func (s *MCPServer) handleBatchStatus(req JSONRPCRequest, params CallToolParams) {
+	jobID, _ := params.Arguments["jobId"].(string)
+
+	batchJobsMutex.Lock()
+	defer batchJobsMutex.Unlock()
+
+	if jobID != "" {
+		job, exists := batchJobs[jobID]
+		if !exists || !s.mayAccess(job.Owner) {
+			s.writeToolText(req, fmt.Sprintf("ERROR: jobId '%s' no encontrado", jobID), true)
+			return
+		}
+		job.mu.Lock()
+		summary := job.summary()
+		job.mu.Unlock()
+		s.writeToolText(req, summary, false)
+		return
+	}
+
+	var jobs []*BatchJob
+	for _, job := range batchJobs {
+		if job.Owner == s.owner {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		s.writeToolText(req, "No hay lotes de traduccion.", false)
+		return
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	var b strings.Builder
+	b.WriteString("LOTES DE TRADUCCION\n===================\n")
+	for _, job := range jobs {
+		job.mu.Lock()
+		b.WriteString(fmt.Sprintf("- [%s] %s\n", job.TargetLang, job.progressLine()))
+		job.mu.Unlock()
+	}
+	s.writeToolText(req, b.String(), false)
+}
+
+// completeBatchItem records the save result of a session that belongs to a
+// batch job and returns a progress note for the submit response
+func (s *MCPServer) completeBatchItem(session *BulkTranslationSession, result string) string {
+	if session.BatchJobID == "" {
+		return ""
+	}
+
+	batchJobsMutex.Lock()
+	job, exists := batchJobs[session.BatchJobID]
+	batchJobsMutex.Unlock()
+	if !exists {
+		return ""
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for _, item := range job.Items {
+		if item.ExtractionID != session.ExtractionID {
+			continue
+		}
+		if strings.HasPrefix(result, "ERROR") {
+			item.Status = batchFailed
+			item.Message = truncateForDisplay(result, 200)
+		} else {
+			item.Status = batchDone
+			item.NewPostID = session.NewPostID
+		}
+	}
+	job.UpdatedAt = time.Now()
+	s.persistBatchJob(job)
+
+	if job.finished() {
+		return fmt.Sprintf("\n\n%s\nLote finalizado. Usa batch_status con jobId=\"%s\" para ver el resumen.", job.progressLine(), job.ID)
+	}
+	return fmt.Sprintf("\n\n%s\nUsa batch_next_extraction con jobId=\"%s\" para continuar.", job.progressLine(), job.ID)
+}
+
+// cancelBatchItem marks the batch item of a cancelled extraction as skipped
+func (s *MCPServer) cancelBatchItem(session *BulkTranslationSession) {
+	if session.BatchJobID == "" {
+		return
+	}
+
+	batchJobsMutex.Lock()
+	job, exists := batchJobs[session.BatchJobID]
+	batchJobsMutex.Unlock()
+	if !exists {
+		return
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for _, item := range job.Items {
+		if item.ExtractionID == session.ExtractionID && item.Status == batchInProgress {
+			item.Status = batchSkipped
+			item.Message = "extraccion cancelada"
+		}
+	}
+	job.UpdatedAt = time.Now()
+	s.persistBatchJob(job)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// simulateRestart drops the batch job and the extraction from memory and
+// reloads the state directory, as a new process would
+func simulateRestart(s *MCPServer, jobID, extractionID string) {
+	batchJobsMutex.Lock()
+	delete(batchJobs, jobID)
+	batchJobsMutex.Unlock()
+	extractionsMutex.Lock()
+	delete(activeExtractions, extractionID)
+	extractionsMutex.Unlock()
+	s.restoreSessions()
+}
+
+func forgetBatchJob(t *testing.T, jobID string) {
+	t.Cleanup(func() {
+		batchJobsMutex.Lock()
+		delete(batchJobs, jobID)
+		batchJobsMutex.Unlock()
+	})
+}
+
+func TestBatchJobSurvivesRestart(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("SESSION_STATE_DIR", stateDir)
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+	forgetBatchJob(t, "lote-persistido")
+
+	session := newTestFileSession(t, s, `[et_pb_section][et_pb_text]<p>Hola mundo</p>[/et_pb_text][/et_pb_section]`, filepath.Join(t.TempDir(), "out.txt"))
+	session.BatchJobID = "lote-persistido"
+	s.persistSession(session)
+
+	job := &BatchJob{
+		ID:         "lote-persistido",
+		TargetLang: "en",
+		Selection:  "3 IDs explicitos",
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		Items: []*BatchItem{
+			{PostID: 10, Status: batchDone},
+			{PostID: 11, Status: batchInProgress, ExtractionID: session.ExtractionID},
+			{PostID: 12, Status: batchPending},
+		},
+	}
+	job.mu.Lock()
+	s.persistBatchJob(job)
+	job.mu.Unlock()
+
+	simulateRestart(s, job.ID, session.ExtractionID)
+
+	restored := s.lookupBatchJob(job.ID, false)
+	if restored == nil {
+		t.Fatal("batch job not restored")
+	}
+	if restored.TargetLang != "en" || restored.Selection != job.Selection || len(restored.Items) != 3 {
+		t.Fatalf("restored job = %+v", restored)
+	}
+	for i, want := range []string{batchDone, batchInProgress, batchPending} {
+		if restored.Items[i].Status != want {
+			t.Errorf("item %d: status %q, want %q", i, restored.Items[i].Status, want)
+		}
+	}
+
+	restoredSession := lockExtraction(session.ExtractionID)
+	if restoredSession == nil {
+		t.Fatal("extraction not restored")
+	}
+	defer restoredSession.mu.Unlock()
+	if restoredSession.BatchJobID != job.ID {
+		t.Fatalf("BatchJobID = %q, want %q", restoredSession.BatchJobID, job.ID)
+	}
+
+	// Completing the restored extraction updates its job, on disk too
+	if note := s.completeBatchItem(restoredSession, "TRADUCCION BULK COMPLETADA"); note == "" {
+		t.Error("completeBatchItem did not find the restored job")
+	}
+	simulateRestart(s, job.ID, "")
+	if again := s.lookupBatchJob(job.ID, false); again == nil || again.Items[1].Status != batchDone {
+		t.Errorf("completed item not persisted: %+v", again)
+	}
+}
+
+func TestRestoreClearsMissingBatchJob(t *testing.T) {
+	t.Setenv("SESSION_STATE_DIR", t.TempDir())
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+
+	session := newTestFileSession(t, s, `[et_pb_section][et_pb_text]<p>Hola mundo</p>[/et_pb_text][/et_pb_section]`, filepath.Join(t.TempDir(), "out.txt"))
+	session.BatchJobID = "lote-perdido"
+	s.persistSession(session)
+
+	simulateRestart(s, "lote-perdido", session.ExtractionID)
+
+	restored := lockExtraction(session.ExtractionID)
+	if restored == nil {
+		t.Fatal("extraction not restored")
+	}
+	defer restored.mu.Unlock()
+	if restored.BatchJobID != "" {
+		t.Errorf("BatchJobID = %q, want it cleared", restored.BatchJobID)
+	}
+}
+
+func TestRestoreBatchJobsDropsExpiredAndInvalid(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("SESSION_STATE_DIR", stateDir)
+	t.Setenv("SESSION_MAX_AGE", "1")
+	s := &MCPServer{stderr: io.Discard}
+	forgetBatchJob(t, "lote-viejo")
+
+	old := &BatchJob{ID: "lote-viejo", TargetLang: "en", UpdatedAt: time.Now().Add(-48 * time.Hour)}
+	old.mu.Lock()
+	s.persistBatchJob(old)
+	old.mu.Unlock()
+	invalid := batchJobFile(stateDir, "lote-roto")
+	if err := os.WriteFile(invalid, []byte("{no json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s.restoreSessions()
+
+	if batchJobExists("lote-viejo") || batchJobExists("lote-roto") {
+		t.Error("expired or invalid batch job restored")
+	}
+	for _, path := range []string{batchJobFile(stateDir, "lote-viejo"), invalid} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not deleted: %v", filepath.Base(path), err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxConflictDiffChars bounds the diff included in a save conflict report
+const maxConflictDiffChars = 8000
+
+// keptTranslations maps the chunks of a new version of a document to the
+// translations of the session by source text, so unchanged chunks keep their
+// translation wherever they moved. Repeated texts are matched in order.
+func keptTranslations(session *BulkTranslationSession, tokens []Token, chunkIndices []int) ([]string, []bool, int) {
+	previous := make(map[string][]string)
+	for i, idx := range session.ChunkIndices {
+		if session.Translations[i] == "" {
+			continue
+		}
+		source := tokenText(session.Tokens[idx])
+		previous[source] = append(previous[source], session.Translations[i])
+	}
+
+	translations := make([]string, len(chunkIndices))
+	kept := make([]bool, len(chunkIndices))
+	count := 0
+	for i, idx := range chunkIndices {
+		source := tokenText(tokens[idx])
+		if queue := previous[source]; len(queue) > 0 {
+			translations[i] = queue[0]
+			previous[source] = queue[1:]
+			kept[i] = true
+			count++
+		}
+	}
+	return translations, kept, count
+}
+
+// formatSaveConflict reports a post modified after extraction, with the diff
+// of what changed and how many chunks refresh_extraction would keep
+func (s *MCPServer) formatSaveConflict(session *BulkTranslationSession, current *WordPressPost) string {
+	tokens := parseShortcodeDocument(current.PostContent).Tokens()
+	chunkIndices, _ := translatableChunks(tokens, session.SkipGlobalModules, session.PostID)
+	_, _, kept := keptTranslations(session, tokens, chunkIndices)
+
+	original := &WordPressPost{
+		PostTitle:   session.OriginalTitle,
+		PostName:    session.OriginalSlug,
+		PostExcerpt: session.OriginalExcerpt,
+		PostContent: session.Document.Source,
+	}
+	diff := diffPosts(original, current, true, "extraccion")
+	if len(diff) > maxConflictDiffChars {
+		diff = diff[:maxConflictDiffChars] + "\n... (diferencias truncadas; usa show_backup con diff=true para verlas todas)\n"
+	}
+
+	s.log("Conflicto al guardar %s: el post %d cambio desde la extraccion", session.ExtractionID, session.PostID)
+
+	return fmt.Sprintf(`CONFLICTO: EL POST HA CAMBIADO DESDE LA EXTRACCION
+==================================================
+extractionId: %s
+Post ID: %d
+Modificado al extraer (GMT): %s
+Modificado ahora (GMT): %s
+
+No se ha guardado nada: la traduccion sobrescribiria los cambios hechos en el
+post despues de la extraccion.
+
+Contenido actual: %d bloques (%d sin cambios, %d nuevos o modificados)
+
+OPCIONES:
+- refresh_extraction con extractionId="%s": vuelve a extraer el post actual
+  conservando la traduccion de los bloques sin cambios. Solo habra que traducir
+  los bloques nuevos o modificados.
+- cancel_extraction con extractionId="%s": descarta esta traduccion.
+
+DIFERENCIAS (- extraccion, + actual):
+%s`, session.ExtractionID, session.PostID,
+		session.OriginalVersion.ModifiedGMT.Format("2006-01-02 15:04:05"),
+		current.PostModifiedGMT.Format("2006-01-02 15:04:05"),
+		len(chunkIndices), kept, len(chunkIndices)-kept,
+		session.ExtractionID, session.ExtractionID, diff)
+}
+
+// recordSibling stores the existing translation of the session's post in the
+// target language and its current version, so a copy save that overwrites it
+// can detect edits made after the extraction
+func recordSibling(wpDB *WordPressDB, session *BulkTranslationSession) error {
+	siblingID, err := wpDB.FindTranslation(session.PostID, session.TargetLang)
+	if err != nil {
+		return fmt.Errorf("error buscando traducciones existentes: %v", err)
+	}
+	var version PostVersion
+	if siblingID != 0 {
+		sibling, err := wpDB.GetPost(siblingID)
+		if err != nil {
+			return fmt.Errorf("error leyendo traduccion existente: %v", err)
+		}
+		version = VersionOf(sibling)
+	}
+	session.SiblingID = siblingID
+	session.SiblingVersion = version
+	session.SiblingChecked = true
+	return nil
+}
+
+// formatSiblingConflict reports that the existing translation a copy save
+// would overwrite changed, or was linked, after the extraction
+func (s *MCPServer) formatSiblingConflict(session *BulkTranslationSession, current *WordPressPost) string {
+	atExtraction := "no existia"
+	if session.SiblingID == current.ID {
+		atExtraction = session.SiblingVersion.ModifiedGMT.Format("2006-01-02 15:04:05")
+	}
+
+	s.log("Conflicto al guardar %s: la traduccion %d del post %d cambio desde la extraccion", session.ExtractionID, current.ID, session.PostID)
+
+	return fmt.Sprintf(`CONFLICTO: LA TRADUCCION EXISTENTE HA CAMBIADO DESDE LA EXTRACCION
+==================================================
+extractionId: %s
+Post original: %d
+Traduccion existente (%s): post %d
+Modificada al extraer (GMT): %s
+Modificada ahora (GMT): %s
+
+No se ha guardado nada: la traduccion sobrescribiria los cambios hechos en la
+traduccion existente despues de la extraccion.
+
+OPCIONES:
+- refresh_extraction con extractionId="%s": vuelve a leer el post y la
+  traduccion existente, conservando los bloques ya traducidos. Al guardar se
+  sobrescribira la version actual de la traduccion existente.
+- cancel_extraction con extractionId="%s": descarta esta traduccion.
+`, session.ExtractionID, session.PostID, session.TargetLang, current.ID,
+		atExtraction, current.PostModifiedGMT.Format("2006-01-02 15:04:05"),
+		session.ExtractionID, session.ExtractionID)
+}
+
+// rebaseSession moves a session onto the current version of its post: chunks
+// whose source text did not change keep their translation, the rest go
+// through the translation memory and are sent again from the first part
+func (s *MCPServer) rebaseSession(session *BulkTranslationSession, post *WordPressPost) error {
+	doc := parseShortcodeDocument(post.PostContent)
+	tokens := doc.Tokens()
+	chunkIndices, globalModules := translatableChunks(tokens, session.SkipGlobalModules, session.PostID)
+	if len(chunkIndices) == 0 {
+		return errNoTranslatableText
+	}
+
+	translations, prefilled, tmHits := s.prefillFromTranslationMemory(tokens, chunkIndices, session.SourceLang, session.TargetLang)
+	kept, keptMask, keptCount := keptTranslations(session, tokens, chunkIndices)
+	for i := range chunkIndices {
+		if keptMask[i] {
+			if prefilled[i] {
+				tmHits--
+			}
+			translations[i] = kept[i]
+			prefilled[i] = true
+		}
+	}
+
+	session.Document = doc
+	session.Tokens = tokens
+	session.ChunkIndices = chunkIndices
+	session.TotalChunks = len(chunkIndices)
+	session.Parts, session.PartRanges = splitIntoParts(tokens, chunkIndices, prefilled)
+	session.CurrentPart = 0
+	session.Translations = translations
+	session.Prefilled = prefilled
+	session.TMHits = tmHits
+	session.KeptChunks = keptCount
+	session.GlobalModules = globalModules
+	session.FuzzyHits = 0
+	session.PartGlossaryIssues = nil
+	session.ValidationIssues = nil
+	s.suggestFromTranslationMemory(session)
+
+	// Metadata edited in the meantime must be translated again
+	if post.PostTitle != session.OriginalTitle {
+		session.TranslatedTitle = ""
+	}
+	if post.PostName != session.OriginalSlug {
+		session.TranslatedSlug = ""
+	}
+	if post.PostExcerpt != session.OriginalExcerpt {
+		session.TranslatedExcerpt = ""
+	}
+	session.OriginalTitle = post.PostTitle
+	session.OriginalSlug = post.PostName
+	session.OriginalExcerpt = post.PostExcerpt
+	session.OriginalVersion = VersionOf(post)
+	session.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MCPServer) handleRefreshExtraction(req JSONRPCRequest, params CallToolParams) {
+	extractionID, _ := params.Arguments["extractionId"].(string)
+	if extractionID == "" {
+		s.writeToolText(req, "ERROR: extractionId es obligatorio", true)
+		return
+	}
+
+	session := s.lockOwnExtraction(extractionID)
+	if session == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: extractionId '%s' no encontrado, cancelado o caducado", extractionID), true)
+		return
+	}
+	defer session.mu.Unlock()
+
+	if session.SourceType != "wordpress" {
+		s.writeToolText(req, "ERROR: refresh_extraction solo esta disponible para extracciones de WordPress", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+	post, err := wpDB.GetPost(session.PostID)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	// The new state of the post is what the translation will replace
+	backupPath, err := wpDB.SaveFullBackup(post, session.SourceLang, session.TargetLang, session.ExtractionID)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR creando backup: %v", err), true)
+		return
+	}
+
+	seoMeta, err := wpDB.GetSEOMeta(session.PostID)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	if err := s.rebaseSession(session, post); err != nil {
+		s.writeToolText(req, extractErrorText(err), true)
+		return
+	}
+	// Refreshing also accepts the current state of the existing translation
+	if err := recordSibling(wpDB, session); err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	session.SEOMeta = rebaseSEOMeta(session.SEOMeta, seoMeta)
+	session.BackupPath = backupPath
+	s.persistSession(session)
+
+	pending := 0
+	for p := 0; p < session.Parts; p++ {
+		pending += session.pendingInPart(p)
+	}
+	s.log("Extraccion %s actualizada: %d bloques conservados, %d por traducir", session.ExtractionID, session.KeptChunks, pending)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`EXTRACCION ACTUALIZADA CON EL CONTENIDO ACTUAL DEL POST
+=======================================================
+Bloques con traduccion conservada: %d de %d
+Bloques a traducir: %d
+Nuevo backup: %s
+
+`, session.KeptChunks, session.TotalChunks, pending, backupPath))
+	b.WriteString(s.generateBulkExtractResponseWithID(session))
+	s.writeToolText(req, b.String(), false)
+}
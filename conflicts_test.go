@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// textModules builds a Divi section with one text module per paragraph
+func textModules(paragraphs ...string) string {
+	var b strings.Builder
+	b.WriteString("[et_pb_section]")
+	for _, p := range paragraphs {
+		b.WriteString("[et_pb_text]<p>" + p + "</p>[/et_pb_text]")
+	}
+	b.WriteString("[/et_pb_section]")
+	return b.String()
+}
+
+// translatedSession extracts source and answers every chunk with its
+// translation in translations, keyed by paragraph; missing ones stay pending
+func translatedSession(t *testing.T, s *MCPServer, source string, translations map[string]string) *BulkTranslationSession {
+	t.Helper()
+	session := s.initBulkSessionWithID(source, "es", "en", "wordpress", "", "", 42, "")
+	if session == nil {
+		t.Fatal("no translatable text")
+	}
+	for i, idx := range session.ChunkIndices {
+		text := tokenText(session.Tokens[idx])
+		if tr, ok := translations[strings.TrimSuffix(strings.TrimPrefix(text, "<p>"), "</p>")]; ok {
+			session.Translations[i] = "<p>" + tr + "</p>"
+		}
+	}
+	return session
+}
+
+func TestKeptTranslations(t *testing.T) {
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+
+	// Hola is repeated with two different translations; Gracias is pending
+	session := translatedSession(t, s, textModules("Hola", "Adios", "Hola", "Gracias"), nil)
+	session.Translations = []string{"<p>Hello</p>", "<p>Bye</p>", "<p>Hi</p>", ""}
+
+	tests := []struct {
+		name       string
+		paragraphs []string
+		want       []string
+		count      int
+	}{
+		{"unchanged", []string{"Hola", "Adios", "Hola", "Gracias"}, []string{"<p>Hello</p>", "<p>Bye</p>", "<p>Hi</p>", ""}, 3},
+		{"moved", []string{"Adios", "Hola", "Gracias", "Hola"}, []string{"<p>Bye</p>", "<p>Hello</p>", "", "<p>Hi</p>"}, 3},
+		{"edited", []string{"Hola", "Adios amigos", "Hola"}, []string{"<p>Hello</p>", "", "<p>Hi</p>"}, 2},
+		{"repeated more often", []string{"Hola", "Hola", "Hola"}, []string{"<p>Hello</p>", "<p>Hi</p>", ""}, 2},
+		{"repeated less often", []string{"Nuevo", "Hola"}, []string{"", "<p>Hello</p>"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := parseShortcodeDocument(textModules(tt.paragraphs...)).Tokens()
+			chunkIndices, _ := translatableChunks(tokens, true, 42)
+			translations, kept, count := keptTranslations(session, tokens, chunkIndices)
+			if !reflect.DeepEqual(translations, tt.want) {
+				t.Errorf("translations = %q, want %q", translations, tt.want)
+			}
+			for i := range kept {
+				if kept[i] != (tt.want[i] != "") {
+					t.Errorf("kept[%d] = %v for %q", i, kept[i], translations[i])
+				}
+			}
+			if count != tt.count {
+				t.Errorf("count = %d, want %d", count, tt.count)
+			}
+		})
+	}
+}
+
+func TestRebaseSession(t *testing.T) {
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+
+	session := translatedSession(t, s, textModules("Hola", "Adios", "Gracias"), map[string]string{
+		"Hola": "Hello", "Adios": "Bye", "Gracias": "Thanks",
+	})
+	session.OriginalTitle, session.TranslatedTitle = "Inicio", "Home"
+	session.OriginalSlug, session.TranslatedSlug = "inicio", "home"
+	session.OriginalExcerpt, session.TranslatedExcerpt = "Resumen", "Summary"
+	session.CurrentPart = session.Parts - 1
+	session.ValidationIssues = []ValidationIssue{{Chunk: 1, Check: "html"}}
+
+	// The post was edited: Adios changed, Hola moved after a new paragraph
+	// and the title changed
+	post := &WordPressPost{
+		ID:              42,
+		PostTitle:       "Portada",
+		PostName:        "inicio",
+		PostExcerpt:     "Resumen",
+		PostContent:     textModules("Nuevo", "Hola", "Adios amigos", "Gracias"),
+		PostModifiedGMT: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	if err := s.rebaseSession(session, post); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "<p>Hello</p>", "", "<p>Thanks</p>"}
+	if !reflect.DeepEqual(session.Translations, want) {
+		t.Errorf("translations = %q, want %q", session.Translations, want)
+	}
+	if !reflect.DeepEqual(session.Prefilled, []bool{false, true, false, true}) {
+		t.Errorf("prefilled = %v", session.Prefilled)
+	}
+	if session.TotalChunks != 4 || session.KeptChunks != 2 || session.TMHits != 0 {
+		t.Errorf("total %d, kept %d, TM hits %d; want 4, 2, 0", session.TotalChunks, session.KeptChunks, session.TMHits)
+	}
+	pending := 0
+	for p := 0; p < session.Parts; p++ {
+		pending += session.pendingInPart(p)
+	}
+	if session.CurrentPart != 0 || pending != 2 {
+		t.Errorf("current part %d with %d chunks pending; want 0 and 2", session.CurrentPart, pending)
+	}
+	if session.ValidationIssues != nil {
+		t.Errorf("validation issues of the old version kept: %v", session.ValidationIssues)
+	}
+	if session.Document.Source != post.PostContent || session.OriginalVersion != VersionOf(post) {
+		t.Errorf("session still points at the old version: %+v", session.OriginalVersion)
+	}
+
+	// Only the metadata that changed is translated again
+	if session.TranslatedTitle != "" || session.OriginalTitle != "Portada" {
+		t.Errorf("title = %q -> %q, want the retitled post untranslated", session.OriginalTitle, session.TranslatedTitle)
+	}
+	if session.TranslatedSlug != "home" || session.TranslatedExcerpt != "Summary" {
+		t.Errorf("unchanged slug/excerpt lost their translation: %q, %q", session.TranslatedSlug, session.TranslatedExcerpt)
+	}
+
+	// A post emptied since the extraction leaves the session untouched
+	empty := &WordPressPost{ID: 42, PostContent: "[et_pb_section][/et_pb_section]"}
+	if err := s.rebaseSession(session, empty); !errors.Is(err, errNoTranslatableText) {
+		t.Errorf("empty post: err = %v", err)
+	}
+	if session.Document.Source != post.PostContent {
+		t.Error("a failed rebase changed the session")
+	}
+}
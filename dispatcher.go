@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxConcurrentCalls bounds the tool calls running at the same time
+const defaultMaxConcurrentCalls = 8
+
+// defaultShutdownTimeout is how long shutdown waits for calls in progress
+const defaultShutdownTimeout = 30 * time.Second
+
+// inflightCall is a tool call that can still be cancelled by the client
+type inflightCall struct {
+	cancel    context.CancelFunc
+	cancelled bool // The response must not be sent
+}
+
+// CancelledParams are the params of notifications/cancelled
+type CancelledParams struct {
+	RequestID interface{} `json:"requestId"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// maxConcurrentCalls reads MCP_MAX_CONCURRENCY
+func maxConcurrentCalls() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MCP_MAX_CONCURRENCY"))); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxConcurrentCalls
+}
+
+// shutdownTimeout reads MCP_SHUTDOWN_TIMEOUT (seconds, or a duration like 1m)
+func shutdownTimeout() time.Duration {
+	v := strings.TrimSpace(os.Getenv("MCP_SHUTDOWN_TIMEOUT"))
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d
+	}
+	return defaultShutdownTimeout
+}
+
+// requestKey identifies a request ID; the type is kept so "1" and 1 differ
+func requestKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// isCancelled reports whether the client cancelled the request with this ID
+func (s *MCPServer) isCancelled(id interface{}) bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	call, ok := s.inflight[requestKey(id)]
+	return ok && call.cancelled
+}
+
+// dispatchToolCall runs a tools/call request in its own goroutine with a
+// cancellable context. Requests over MCP_MAX_CONCURRENCY wait for a free slot.
+func (s *MCPServer) dispatchToolCall(req JSONRPCRequest) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req.ctx = ctx
+
+	var key string
+	if req.ID != nil {
+		key = requestKey(req.ID)
+	}
+
+	// The call is registered under inflightMu so a shutdown either sees it
+	// in calls or rejects it, never both
+	s.inflightMu.Lock()
+	if s.inflight == nil {
+		s.inflight = make(map[string]*inflightCall)
+	}
+	var reject string
+	if s.stopping {
+		reject = "Invalid Request: server is shutting down"
+	} else if _, busy := s.inflight[key]; busy && key != "" {
+		reject = fmt.Sprintf("Invalid Request: request ID %v is already in progress", req.ID)
+	}
+	if reject != "" {
+		s.inflightMu.Unlock()
+		cancel()
+		if req.ID != nil {
+			s.writeResponse(JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error:   &RPCError{Code: -32600, Message: reject},
+			})
+		}
+		return
+	}
+	if key != "" {
+		s.inflight[key] = &inflightCall{cancel: cancel}
+	}
+	s.calls.Add(1)
+	s.inflightMu.Unlock()
+
+	slots := s.slots()
+
+	go func() {
+		defer s.calls.Done()
+		defer func() {
+			cancel()
+			if key != "" {
+				s.inflightMu.Lock()
+				delete(s.inflight, key)
+				s.inflightMu.Unlock()
+			}
+		}()
+		defer s.recoverToolCall(req)
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return // Cancelled while waiting: nothing was done
+		}
+		// select picks at random when the slot frees as the call is cancelled
+		if ctx.Err() != nil {
+			return
+		}
+		s.handleCallTool(req)
+	}()
+}
+
+// slots returns the semaphore of concurrent tool calls. HTTP client servers
+// use their parent's, so MCP_MAX_CONCURRENCY is a limit for the whole process.
+func (s *MCPServer) slots() chan struct{} {
+	if s.parent != nil {
+		return s.parent.slots()
+	}
+	s.slotsOnce.Do(func() {
+		if s.callSlots == nil {
+			s.callSlots = make(chan struct{}, maxConcurrentCalls())
+		}
+	})
+	return s.callSlots
+}
+
+// recoverToolCall turns a panic in a tool into an internal error response
+// instead of taking down the server and every other call in progress
+func (s *MCPServer) recoverToolCall(req JSONRPCRequest) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	s.log("Panic en tools/call %v: %v\n%s", req.ID, r, debug.Stack())
+	s.writeResponse(JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: &RPCError{
+			Code:    -32603,
+			Message: fmt.Sprintf("Internal error: %v", r),
+		},
+	})
+}
+
+// handleCancelled cancels a request in progress. Unknown or finished requests
+// are ignored, as the notification may cross with the response.
+func (s *MCPServer) handleCancelled(req JSONRPCRequest) {
+	var params CancelledParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == nil {
+		s.log("notifications/cancelled sin requestId valido")
+		return
+	}
+
+	s.inflightMu.Lock()
+	call, ok := s.inflight[requestKey(params.RequestID)]
+	if ok {
+		call.cancelled = true
+		call.cancel()
+	}
+	s.inflightMu.Unlock()
+
+	if ok {
+		s.log("Peticion %v cancelada por el cliente: %s", params.RequestID, params.Reason)
+	}
+}
+
+// stopAccepting marks the server as shutting down, so new tool calls are
+// rejected. It reports false if it already was.
+func (s *MCPServer) stopAccepting() bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.stopping = true
+	return true
+}
+
+// cancelAllCalls cancels every call in progress
+func (s *MCPServer) cancelAllCalls() int {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	for _, call := range s.inflight {
+		call.cancel()
+	}
+	return len(s.inflight)
+}
+
+// drainCalls waits for the tool calls in progress. After MCP_SHUTDOWN_TIMEOUT
+// the remaining calls are cancelled and given a short grace period.
+func (s *MCPServer) drainCalls() {
+	done := make(chan struct{})
+	go func() {
+		s.calls.Wait()
+		close(done)
+	}()
+
+	timeout := shutdownTimeout()
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	s.log("%d llamadas siguen en curso tras %s: cancelando", s.cancelAllCalls(), timeout)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.log("Cerrando con llamadas aun en curso")
+	}
+}
+
+// closeResources closes the WordPress connection and the translation memory
+func (s *MCPServer) closeResources() {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.wpDB != nil {
+		s.wpDB.Close()
+		s.wpDB = nil
+	}
+	if s.tm != nil {
+		s.tm.Close()
+		s.tm = nil
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of tool calls
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// responses decodes the JSON-RPC responses written so far, by ID. Server
+// notifications are skipped.
+func (b *syncBuffer) responses(t *testing.T) map[float64]JSONRPCResponse {
+	t.Helper()
+	out := make(map[float64]JSONRPCResponse)
+	scanner := bufio.NewScanner(strings.NewReader(b.String()))
+	for scanner.Scan() {
+		var msg struct {
+			JSONRPCResponse
+			Method string
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid response %q: %v", scanner.Text(), err)
+		}
+		if msg.Method != "" {
+			continue
+		}
+		id, _ := msg.ID.(float64)
+		out[id] = msg.JSONRPCResponse
+	}
+	return out
+}
+
+// blockingMT is a LibreTranslate mock whose requests wait for a token on
+// release (or for the client to give up) before answering. "Texto" is
+// translated as "Text", so the result passes validation.
+type blockingMT struct {
+	started   chan struct{} // One value per request received
+	release   chan struct{} // One token lets one request answer
+	cancelled chan struct{} // One value per request abandoned by the client
+}
+
+func newBlockingMT(t *testing.T) *blockingMT {
+	t.Helper()
+	mt := &blockingMT{
+		started:   make(chan struct{}, 16),
+		release:   make(chan struct{}, 16),
+		cancelled: make(chan struct{}, 16),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Q []string `json:"q"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mt.started <- struct{}{}
+		select {
+		case <-mt.release:
+		case <-r.Context().Done():
+			mt.cancelled <- struct{}{}
+			return
+		}
+		for i, q := range body.Q {
+			body.Q[i] = strings.ReplaceAll(q, "Texto", "Text")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"translatedText": body.Q})
+	}))
+	t.Cleanup(func() {
+		close(mt.release)
+		srv.Close()
+	})
+	t.Setenv("MT_PROVIDER", "libretranslate")
+	t.Setenv("LIBRETRANSLATE_URL", srv.URL)
+	return mt
+}
+
+// wait receives n values from ch or fails after a few seconds
+func wait(t *testing.T, ch chan struct{}, n int, what string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: got %d of %d", what, i, n)
+		}
+	}
+}
+
+// idle fails if ch receives a value within a short delay
+func idle(t *testing.T, ch chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatalf("unexpected %s", what)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// newDispatchTestServer returns a stdio server writing to a buffer
+func newDispatchTestServer(t *testing.T) (*MCPServer, *syncBuffer) {
+	t.Helper()
+	t.Setenv("SESSION_STATE_DIR", t.TempDir())
+	t.Setenv("TM_ENABLED", "false")
+	out := &syncBuffer{}
+	return &MCPServer{stdout: out, stderr: io.Discard}, out
+}
+
+// machineTranslateLine is a tools/call of machine_translate on a new extraction
+func machineTranslateLine(t *testing.T, s *MCPServer, id int) string {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "out.txt")
+	session := newTestFileSession(t, s, fmt.Sprintf(`[et_pb_section][et_pb_text]<p>Texto %d</p>[/et_pb_text][/et_pb_section]`, id), output)
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"machine_translate","arguments":{"extractionId":%q}}}`, id, session.ExtractionID)
+}
+
+// toolFailed reports whether a tools/call response is an error or has isError
+func toolFailed(resp JSONRPCResponse) bool {
+	result, _ := resp.Result.(map[string]interface{})
+	return resp.Error != nil || result == nil || result["isError"] == true
+}
+
+// handleLine routes a JSON-RPC message as the stdio reader does
+func handleLine(t *testing.T, s *MCPServer, line string) {
+	t.Helper()
+	var req JSONRPCRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		t.Fatal(err)
+	}
+	s.handleRequest(req)
+}
+
+func cancelledLine(id int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":%d,"reason":"test"}}`, id)
+}
+
+func TestDispatchRunsCallsConcurrently(t *testing.T) {
+	t.Setenv("MCP_MAX_CONCURRENCY", "4")
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+
+	for id := 1; id <= 3; id++ {
+		handleLine(t, s, machineTranslateLine(t, s, id))
+	}
+	// The three calls are blocked in the backend at the same time
+	wait(t, mt.started, 3, "concurrent calls")
+
+	// ping is answered while they run
+	handleLine(t, s, `{"jsonrpc":"2.0","id":9,"method":"ping"}`)
+	if resp, ok := out.responses(t)[9]; !ok || resp.Error != nil {
+		t.Fatalf("ping while calls run: %+v (%v)", resp, ok)
+	}
+
+	for i := 0; i < 3; i++ {
+		mt.release <- struct{}{}
+	}
+	s.calls.Wait()
+	responses := out.responses(t)
+	for id := 1; id <= 3; id++ {
+		resp, ok := responses[float64(id)]
+		if !ok || toolFailed(resp) {
+			t.Errorf("call %d: %+v (%v)", id, resp, ok)
+		}
+	}
+}
+
+func TestDispatchRejectsDuplicateID(t *testing.T) {
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+
+	line := machineTranslateLine(t, s, 1)
+	handleLine(t, s, line)
+	wait(t, mt.started, 1, "first call")
+	handleLine(t, s, line)
+
+	resp, ok := out.responses(t)[1]
+	if !ok || resp.Error == nil || resp.Error.Code != -32600 {
+		t.Errorf("duplicate ID: %+v (%v)", resp, ok)
+	}
+	mt.release <- struct{}{}
+	s.calls.Wait()
+}
+
+func TestDispatchSemaphore(t *testing.T) {
+	t.Setenv("MCP_MAX_CONCURRENCY", "2")
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+
+	handleLine(t, s, machineTranslateLine(t, s, 1))
+	handleLine(t, s, machineTranslateLine(t, s, 2))
+	wait(t, mt.started, 2, "calls within the limit")
+	handleLine(t, s, machineTranslateLine(t, s, 3))
+	handleLine(t, s, machineTranslateLine(t, s, 4))
+	idle(t, mt.started, "call over MCP_MAX_CONCURRENCY")
+
+	// A call waiting for a slot is cancelled without ever running
+	handleLine(t, s, cancelledLine(4))
+
+	// Finishing one call lets the next waiting one start
+	mt.release <- struct{}{}
+	wait(t, mt.started, 1, "call after a slot was freed")
+	idle(t, mt.started, "cancelled call started")
+
+	mt.release <- struct{}{}
+	mt.release <- struct{}{}
+	s.calls.Wait()
+	responses := out.responses(t)
+	if len(responses) != 3 {
+		t.Errorf("got %d responses, want 3: %s", len(responses), out.String())
+	}
+	if _, ok := responses[4]; ok {
+		t.Error("response sent for a cancelled call")
+	}
+}
+
+func TestCancelledNotification(t *testing.T) {
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+
+	handleLine(t, s, machineTranslateLine(t, s, 1))
+	handleLine(t, s, machineTranslateLine(t, s, 2))
+	wait(t, mt.started, 2, "calls")
+
+	handleLine(t, s, cancelledLine(1))
+	wait(t, mt.cancelled, 1, "backend request cancelled")
+
+	// Unknown and finished requests are ignored
+	handleLine(t, s, cancelledLine(99))
+	handleLine(t, s, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{}}`)
+
+	mt.release <- struct{}{}
+	s.calls.Wait()
+	responses := out.responses(t)
+	if _, ok := responses[1]; ok {
+		t.Error("response sent for the cancelled call")
+	}
+	if resp, ok := responses[2]; !ok || toolFailed(resp) {
+		t.Errorf("call 2: %+v (%v)", resp, ok)
+	}
+	if len(s.inflight) != 0 {
+		t.Errorf("%d calls left in flight", len(s.inflight))
+	}
+}
+
+func TestDrainCallsCancelsAfterTimeout(t *testing.T) {
+	t.Setenv("MCP_SHUTDOWN_TIMEOUT", "0")
+	s, _ := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+
+	handleLine(t, s, machineTranslateLine(t, s, 1))
+	wait(t, mt.started, 1, "call")
+
+	done := make(chan struct{})
+	go func() {
+		s.drainCalls()
+		close(done)
+	}()
+	wait(t, mt.cancelled, 1, "backend request cancelled by the drain")
+	wait(t, done, 1, "drain")
+}
+
+// runPipe runs s on a pipe and returns its writer and a channel closed when
+// Run returns
+func runPipe(t *testing.T, s *MCPServer) (io.Writer, chan struct{}) {
+	t.Helper()
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	s.stdin = r
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+	return w, done
+}
+
+func TestShutdownWaitsForCalls(t *testing.T) {
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+	stdin, done := runPipe(t, s)
+
+	fmt.Fprintln(stdin, machineTranslateLine(t, s, 1))
+	wait(t, mt.started, 1, "call")
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+	idle(t, done, "return from Run before the call finished")
+
+	// New calls are rejected while shutting down
+	fmt.Fprintln(stdin, machineTranslateLine(t, s, 3))
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":4,"method":"ping"}`)
+	for {
+		if _, ok := out.responses(t)[4]; ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp := out.responses(t)[3]; resp.Error == nil || !strings.Contains(resp.Error.Message, "shutting down") {
+		t.Errorf("call during shutdown: %+v", resp)
+	}
+
+	mt.release <- struct{}{}
+	wait(t, done, 1, "Run after shutdown")
+
+	responses := out.responses(t)
+	if resp, ok := responses[1]; !ok || toolFailed(resp) {
+		t.Errorf("call in progress: %+v (%v)", resp, ok)
+	}
+	if resp, ok := responses[2]; !ok || resp.Error != nil {
+		t.Errorf("shutdown: %+v (%v)", resp, ok)
+	}
+	if strings.Index(out.String(), `"id":1`) > strings.Index(out.String(), `"id":2`) {
+		t.Errorf("shutdown answered before the call in progress:\n%s", out.String())
+	}
+}
+
+func TestShutdownReadsCancellations(t *testing.T) {
+	t.Setenv("MCP_SHUTDOWN_TIMEOUT", "1m")
+	s, out := newDispatchTestServer(t)
+	mt := newBlockingMT(t)
+	stdin, done := runPipe(t, s)
+
+	fmt.Fprintln(stdin, machineTranslateLine(t, s, 1))
+	wait(t, mt.started, 1, "call")
+	fmt.Fprintln(stdin, `{"jsonrpc":"2.0","id":2,"method":"shutdown"}`)
+
+	// The cancellation is read during the drain and ends it long before the timeout
+	fmt.Fprintln(stdin, cancelledLine(1))
+	wait(t, mt.cancelled, 1, "backend request cancelled")
+	wait(t, done, 1, "Run after shutdown")
+
+	responses := out.responses(t)
+	if _, ok := responses[1]; ok {
+		t.Error("response sent for the cancelled call")
+	}
+	if resp, ok := responses[2]; !ok || resp.Error != nil {
+		t.Errorf("shutdown: %+v (%v)", resp, ok)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Post types of the Divi Theme Builder and the Divi Library
+const (
+	postTypeTemplate     = "et_template"
+	postTypeHeaderLayout = "et_header_layout"
+	postTypeBodyLayout   = "et_body_layout"
+	postTypeFooterLayout = "et_footer_layout"
+	postTypeLibrary      = "et_pb_layout"
+)
+
+// diviLayoutsAlias selects every translatable Divi layout in create_batch_job
+const diviLayoutsAlias = "divi_layouts"
+
+var diviLayoutPostTypes = []string{postTypeHeaderLayout, postTypeBodyLayout, postTypeFooterLayout, postTypeLibrary}
+
+// expandPostTypeAlias replaces the divi_layouts alias in a comma-separated
+// list of post types
+func expandPostTypeAlias(postTypes string) string {
+	var out []string
+	for _, t := range strings.Split(postTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == diviLayoutsAlias {
+			out = append(out, diviLayoutPostTypes...)
+		} else if t != "" {
+			out = append(out, t)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// globalModuleID returns the global_module attribute of the nearest shortcode
+// containing n (n included), or 0 if n is not part of a global module
+func globalModuleID(n *ShortcodeNode) int64 {
+	for cur := n; cur != nil; cur = cur.Parent {
+		if cur.Kind != "shortcode" {
+			continue
+		}
+		if v, ok := cur.Attr("global_module"); ok {
+			if id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil && id > 0 {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// translatableChunks returns the indices of the translatable tokens. With
+// skipGlobal, the text of global modules is left out, as Divi renders it from
+// the library item: it is translated once there. Their chunks are counted per
+// module ID. selfID is the post being extracted, whose own content is never
+// skipped (a library item may reference itself).
+func translatableChunks(tokens []Token, skipGlobal bool, selfID int64) ([]int, map[int64]int) {
+	var chunkIndices []int
+	var globals map[int64]int
+	for i, t := range tokens {
+		if !isTranslatableToken(t) {
+			continue
+		}
+		if skipGlobal {
+			if id := globalModuleID(t.node); id != 0 && id != selfID {
+				if globals == nil {
+					globals = make(map[int64]int)
+				}
+				globals[id]++
+				continue
+			}
+		}
+		chunkIndices = append(chunkIndices, i)
+	}
+	return chunkIndices, globals
+}
+
+// formatGlobalModules lists the global modules left out of an extraction
+func formatGlobalModules(globals map[int64]int) string {
+	if len(globals) == 0 {
+		return ""
+	}
+	ids := make([]int64, 0, len(globals))
+	for id := range globals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var b strings.Builder
+	b.WriteString("\nMODULOS GLOBALES (no incluidos: Divi los muestra desde la Biblioteca, se traducen una vez alli):\n")
+	for _, id := range ids {
+		b.WriteString(fmt.Sprintf("- global_module %d: %d bloques -> extract_wordpress_text con postId=%d\n", id, globals[id], id))
+	}
+	return b.String()
+}
+
+// globalModuleAttrPattern matches the reference to a Divi Library item
+var globalModuleAttrPattern = regexp.MustCompile(`global_module="(\d+)"`)
+
+// remapGlobalModules points the global modules of a translated copy to the
+// lang translation of their library item, so Divi renders the translated
+// module. Modules whose library item has no translation keep the original
+// reference and are returned as missing. selfID, the post being translated,
+// is left as is.
+func (wp *WordPressDB) remapGlobalModules(content, lang string, selfID int64) (string, map[int64]int64, []int64, error) {
+	remapped := make(map[int64]int64)
+	var missing []int64
+	for _, m := range globalModuleAttrPattern.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || id == selfID {
+			continue
+		}
+		if _, done := remapped[id]; done {
+			continue
+		}
+		translatedID, err := wp.FindTranslation(id, lang)
+		if err != nil {
+			return content, nil, nil, fmt.Errorf("error buscando la traduccion del modulo global %d: %v", id, err)
+		}
+		remapped[id] = translatedID
+		if translatedID == 0 {
+			missing = append(missing, id)
+		}
+	}
+
+	content = globalModuleAttrPattern.ReplaceAllStringFunc(content, func(attr string) string {
+		id, _ := strconv.ParseInt(globalModuleAttrPattern.FindStringSubmatch(attr)[1], 10, 64)
+		if translatedID := remapped[id]; translatedID != 0 {
+			return fmt.Sprintf(`global_module="%d"`, translatedID)
+		}
+		return attr
+	})
+	for id, translatedID := range remapped {
+		if translatedID == 0 {
+			delete(remapped, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return content, remapped, missing, nil
+}
+
+// formatGlobalModuleRemap reports the global modules of a translated copy:
+// the ones now pointing to a translated library item and the ones that will
+// render in the source language until their library item is translated
+func formatGlobalModuleRemap(remapped map[int64]int64, missing []int64, globals map[int64]int, lang string) string {
+	if len(remapped) == 0 && len(missing) == 0 {
+		return ""
+	}
+	ids := make([]int64, 0, len(remapped))
+	for id := range remapped {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var b strings.Builder
+	b.WriteString("\n\nMODULOS GLOBALES:")
+	for _, id := range ids {
+		b.WriteString(fmt.Sprintf("\n- global_module %d -> %d (traduccion '%s' de la Biblioteca)", id, remapped[id], lang))
+	}
+	if len(missing) > 0 {
+		b.WriteString(fmt.Sprintf("\nAVISO: sin traduccion '%s' en la Biblioteca, se muestran sin traducir:", lang))
+		for _, id := range missing {
+			blocks := ""
+			if n := globals[id]; n > 0 {
+				blocks = fmt.Sprintf(" (%d bloques)", n)
+			}
+			b.WriteString(fmt.Sprintf("\n- global_module %d%s -> extract_wordpress_text con postId=%d y createCopy=true, y guarda de nuevo esta traduccion", id, blocks, id))
+		}
+	}
+	return b.String()
+}
+
+// ThemeBuilderTemplate is an et_template post with the layouts it uses
+type ThemeBuilderTemplate struct {
+	ID          int64
+	Title       string
+	Default     bool // Applies to the whole site unless another template matches
+	Enabled     bool
+	UseOn       []string // Conditions, e.g. "singular:post_type:page:all"
+	ExcludeFrom []string
+	Layouts     []ThemeBuilderLayout
+}
+
+// ThemeBuilderLayout is the header, body or footer of a template
+type ThemeBuilderLayout struct {
+	Area    string // header, body or footer
+	ID      int64
+	Title   string
+	Enabled bool
+}
+
+// LibraryLayout is an item of the Divi Library
+type LibraryLayout struct {
+	ID         int64
+	Title      string
+	LayoutType string // layout, section, row or module
+	Scope      string // global or non_global
+	UsedBy     int    // Posts that reference a global item
+}
+
+// ListThemeBuilderTemplates returns the published Theme Builder templates
+// with their header, body and footer layouts
+func (wp *WordPressDB) ListThemeBuilderTemplates() ([]ThemeBuilderTemplate, error) {
+	query := fmt.Sprintf(`
+		SELECT p.ID, p.post_title, m.meta_key, m.meta_value
+		FROM %[1]sposts p
+		LEFT JOIN %[1]spostmeta m ON m.post_id = p.ID AND m.meta_key IN (
+			'_et_default', '_et_enabled', '_et_use_on', '_et_exclude_from',
+			'_et_header_layout_id', '_et_body_layout_id', '_et_footer_layout_id',
+			'_et_header_layout_enabled', '_et_body_layout_enabled', '_et_footer_layout_enabled')
+		WHERE p.post_type = ? AND p.post_status = 'publish'
+		ORDER BY p.ID, m.meta_id`,
+		wp.tablePrefix)
+	rows, err := wp.db.Query(query, postTypeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo plantillas del Theme Builder: %v", err)
+	}
+	defer rows.Close()
+
+	type templateMeta struct {
+		template *ThemeBuilderTemplate
+		meta     map[string]string
+	}
+	var order []*templateMeta
+	byID := make(map[int64]*templateMeta)
+	for rows.Next() {
+		var id int64
+		var title string
+		var key, value sql.NullString
+		if err := rows.Scan(&id, &title, &key, &value); err != nil {
+			return nil, fmt.Errorf("error leyendo plantillas del Theme Builder: %v", err)
+		}
+		tm := byID[id]
+		if tm == nil {
+			tm = &templateMeta{template: &ThemeBuilderTemplate{ID: id, Title: title, Enabled: true}, meta: make(map[string]string)}
+			byID[id] = tm
+			order = append(order, tm)
+		}
+		switch key.String {
+		case "_et_use_on":
+			tm.template.UseOn = append(tm.template.UseOn, value.String)
+		case "_et_exclude_from":
+			tm.template.ExcludeFrom = append(tm.template.ExcludeFrom, value.String)
+		case "":
+		default:
+			tm.meta[key.String] = value.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Layout titles in one query
+	var layoutIDs []int64
+	for _, tm := range order {
+		for _, area := range []string{"header", "body", "footer"} {
+			if id, _ := strconv.ParseInt(tm.meta["_et_"+area+"_layout_id"], 10, 64); id > 0 {
+				layoutIDs = append(layoutIDs, id)
+			}
+		}
+	}
+	titles, err := wp.postTitles(layoutIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]ThemeBuilderTemplate, 0, len(order))
+	for _, tm := range order {
+		t := tm.template
+		t.Default = tm.meta["_et_default"] == "1"
+		if v, ok := tm.meta["_et_enabled"]; ok {
+			t.Enabled = v == "1"
+		}
+		for _, area := range []string{"header", "body", "footer"} {
+			id, _ := strconv.ParseInt(tm.meta["_et_"+area+"_layout_id"], 10, 64)
+			if id <= 0 {
+				continue
+			}
+			enabled := true
+			if v, ok := tm.meta["_et_"+area+"_layout_enabled"]; ok {
+				enabled = v == "1"
+			}
+			t.Layouts = append(t.Layouts, ThemeBuilderLayout{Area: area, ID: id, Title: titles[id], Enabled: enabled})
+		}
+		templates = append(templates, *t)
+	}
+	return templates, nil
+}
+
+// postTitles returns the titles of the given posts
+func (wp *WordPressDB) postTitles(ids []int64) (map[int64]string, error) {
+	titles := make(map[int64]string)
+	if len(ids) == 0 {
+		return titles, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := fmt.Sprintf(`SELECT ID, post_title FROM %sposts WHERE ID IN (%s)`, wp.tablePrefix, placeholders)
+	rows, err := wp.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo titulos: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, fmt.Errorf("error leyendo titulos: %v", err)
+		}
+		titles[id] = title
+	}
+	return titles, rows.Err()
+}
+
+// ListLibraryLayouts returns the published Divi Library items with their
+// layout type and scope. For global items, UsedBy counts the posts whose
+// content references them.
+func (wp *WordPressDB) ListLibraryLayouts() ([]LibraryLayout, error) {
+	query := fmt.Sprintf(`
+		SELECT p.ID, p.post_title,
+		       COALESCE(MAX(CASE WHEN tt.taxonomy = 'layout_type' THEN t.slug END), ''),
+		       COALESCE(MAX(CASE WHEN tt.taxonomy = 'scope' THEN t.slug END), '')
+		FROM %[1]sposts p
+		LEFT JOIN %[1]sterm_relationships tr ON tr.object_id = p.ID
+		LEFT JOIN %[1]sterm_taxonomy tt ON tt.term_taxonomy_id = tr.term_taxonomy_id AND tt.taxonomy IN ('layout_type', 'scope')
+		LEFT JOIN %[1]sterms t ON t.term_id = tt.term_id
+		WHERE p.post_type = ? AND p.post_status = 'publish'
+		GROUP BY p.ID, p.post_title
+		ORDER BY p.ID`,
+		wp.tablePrefix)
+	rows, err := wp.db.Query(query, postTypeLibrary)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la Biblioteca de Divi: %v", err)
+	}
+	var layouts []LibraryLayout
+	for rows.Next() {
+		var l LibraryLayout
+		if err := rows.Scan(&l.ID, &l.Title, &l.LayoutType, &l.Scope); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error leyendo la Biblioteca de Divi: %v", err)
+		}
+		layouts = append(layouts, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range layouts {
+		if layouts[i].Scope != "global" {
+			continue
+		}
+		if layouts[i].UsedBy, err = wp.CountGlobalModuleUses(layouts[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return layouts, nil
+}
+
+// CountGlobalModuleUses counts the posts (revisions and the library item
+// itself excluded) whose content references a global module
+func (wp *WordPressDB) CountGlobalModuleUses(id int64) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %sposts
+		WHERE ID != ? AND post_type != 'revision' AND post_status != 'trash'
+		  AND post_content LIKE ?`,
+		wp.tablePrefix)
+	var count int
+	if err := wp.db.QueryRow(query, id, fmt.Sprintf(`%%global_module="%d"%%`, id)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error contando usos del modulo global %d: %v", id, err)
+	}
+	return count, nil
+}
+
+// GlobalModuleUsers returns the IDs of the posts counted by
+// CountGlobalModuleUses
+func (wp *WordPressDB) GlobalModuleUsers(id int64) ([]int64, error) {
+	query := fmt.Sprintf(`
+		SELECT ID FROM %sposts
+		WHERE ID != ? AND post_type != 'revision' AND post_status != 'trash'
+		  AND post_content LIKE ?
+		ORDER BY ID`,
+		wp.tablePrefix)
+	rows, err := wp.db.Query(query, id, fmt.Sprintf(`%%global_module="%d"%%`, id))
+	if err != nil {
+		return nil, fmt.Errorf("error buscando usos del modulo global %d: %v", id, err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var postID int64
+		if err := rows.Scan(&postID); err != nil {
+			return nil, fmt.Errorf("error leyendo usos del modulo global %d: %v", id, err)
+		}
+		ids = append(ids, postID)
+	}
+	return ids, rows.Err()
+}
+
+func (s *MCPServer) handleListDiviLayouts(req JSONRPCRequest, params CallToolParams) {
+	kind, _ := params.Arguments["type"].(string)
+	if kind == "" {
+		kind = "all"
+	}
+	if kind != "all" && kind != "theme_builder" && kind != "library" {
+		s.writeToolText(req, "ERROR: type debe ser all, theme_builder o library", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	var b strings.Builder
+	if kind != "library" {
+		templates, err := wpDB.ListThemeBuilderTemplates()
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		b.WriteString(fmt.Sprintf("THEME BUILDER (%d plantillas)\n============================\n", len(templates)))
+		for _, t := range templates {
+			state := ""
+			if t.Default {
+				state += " (plantilla por defecto)"
+			}
+			if !t.Enabled {
+				state += " (desactivada)"
+			}
+			b.WriteString(fmt.Sprintf("- Plantilla %d \"%s\"%s\n", t.ID, t.Title, state))
+			if len(t.UseOn) > 0 {
+				b.WriteString(fmt.Sprintf("  Se usa en: %s\n", strings.Join(t.UseOn, ", ")))
+			}
+			if len(t.ExcludeFrom) > 0 {
+				b.WriteString(fmt.Sprintf("  Excepto: %s\n", strings.Join(t.ExcludeFrom, ", ")))
+			}
+			if len(t.Layouts) == 0 {
+				b.WriteString("  (usa el header, body y footer del tema)\n")
+			}
+			for _, l := range t.Layouts {
+				disabled := ""
+				if !l.Enabled {
+					disabled = " (oculto)"
+				}
+				b.WriteString(fmt.Sprintf("  %s: post %d \"%s\"%s\n", l.Area, l.ID, l.Title, disabled))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if kind != "theme_builder" {
+		layouts, err := wpDB.ListLibraryLayouts()
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		b.WriteString(fmt.Sprintf("BIBLIOTECA DE DIVI (%d elementos)\n=================================\n", len(layouts)))
+		for _, l := range layouts {
+			layoutType := l.LayoutType
+			if layoutType == "" {
+				layoutType = "layout"
+			}
+			if l.Scope == "global" {
+				b.WriteString(fmt.Sprintf("- %d \"%s\" [%s, GLOBAL, usado en %d posts]\n", l.ID, l.Title, layoutType, l.UsedBy))
+			} else {
+				b.WriteString(fmt.Sprintf("- %d \"%s\" [%s]\n", l.ID, l.Title, layoutType))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(`Para traducir un layout usa extract_wordpress_text con su postId (el del
+header/body/footer, no el de la plantilla). Para todos a la vez usa
+create_batch_job con postType="divi_layouts".
+Los modulos GLOBALES se traducen una sola vez aqui: las extracciones de paginas
+no incluyen su texto.`)
+	s.writeToolText(req, b.String(), false)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// globalModulesPage has a global section (100) holding a nested global text
+// module (110), a global button (300) in a regular row and global_module
+// values that are not library references
+const globalModulesPage = `[et_pb_section global_module="100"][et_pb_row][et_pb_column type="4_4"]` +
+	`[et_pb_text]<p>Seccion global</p>[/et_pb_text]` +
+	`[et_pb_text global_module="110"]<p>Texto anidado</p>[/et_pb_text]` +
+	`[/et_pb_column][/et_pb_row][/et_pb_section]` +
+	`[et_pb_section][et_pb_row][et_pb_column type="4_4"]` +
+	`[et_pb_text]<p>Texto propio</p>[/et_pb_text]` +
+	`[et_pb_button button_text="Ver mas" global_module="300"][/et_pb_button]` +
+	`[et_pb_text global_module=" 200 "]<p>Texto global</p>[/et_pb_text]` +
+	`[et_pb_text global_module="0"]<p>Modulo cero</p>[/et_pb_text]` +
+	`[et_pb_text global_module="abc"]<p>Modulo roto</p>[/et_pb_text]` +
+	`[/et_pb_column][/et_pb_row][/et_pb_section]`
+
+func TestGlobalModuleID(t *testing.T) {
+	want := map[string]int64{
+		"<p>Seccion global</p>": 100,
+		"<p>Texto anidado</p>":  110, // The innermost reference wins
+		"<p>Texto propio</p>":   0,
+		"Ver mas":               300,
+		"<p>Texto global</p>":   200,
+		"<p>Modulo cero</p>":    0,
+		"<p>Modulo roto</p>":    0,
+	}
+	got := make(map[string]int64)
+	for _, token := range parseShortcodeDocument(globalModulesPage).Tokens() {
+		if isTranslatableToken(token) {
+			got[tokenText(token)] = globalModuleID(token.node)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("global module IDs = %v, want %v", got, want)
+	}
+}
+
+func TestTranslatableChunksSkipsGlobalModules(t *testing.T) {
+	all := []string{"<p>Seccion global</p>", "<p>Texto anidado</p>", "<p>Texto propio</p>", "Ver mas", "<p>Texto global</p>", "<p>Modulo cero</p>", "<p>Modulo roto</p>"}
+	tests := []struct {
+		name       string
+		skipGlobal bool
+		selfID     int64
+		want       []string
+		globals    map[int64]int
+	}{
+		{"not skipped", false, 0, all, nil},
+		{"skipped", true, 0,
+			[]string{"<p>Texto propio</p>", "<p>Modulo cero</p>", "<p>Modulo roto</p>"},
+			map[int64]int{100: 1, 110: 1, 200: 1, 300: 1}},
+		{"library item referencing itself", true, 100,
+			[]string{"<p>Seccion global</p>", "<p>Texto propio</p>", "<p>Modulo cero</p>", "<p>Modulo roto</p>"},
+			map[int64]int{110: 1, 200: 1, 300: 1}},
+	}
+	tokens := parseShortcodeDocument(globalModulesPage).Tokens()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunkIndices, globals := translatableChunks(tokens, tt.skipGlobal, tt.selfID)
+			var got []string
+			for _, idx := range chunkIndices {
+				got = append(got, tokenText(tokens[idx]))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(globals, tt.globals) {
+				t.Errorf("global modules = %v, want %v", globals, tt.globals)
+			}
+		})
+	}
+}
+
+func TestFormatGlobalModuleRemap(t *testing.T) {
+	if got := formatGlobalModuleRemap(nil, nil, nil, "en"); got != "" {
+		t.Errorf("no global modules: got %q", got)
+	}
+
+	got := formatGlobalModuleRemap(map[int64]int64{40: 41, 30: 31}, []int64{50}, map[int64]int{50: 3}, "en")
+	for _, want := range []string{
+		"global_module 30 -> 31",
+		"global_module 40 -> 41",
+		"sin traduccion 'en'",
+		"global_module 50 (3 bloques) -> extract_wordpress_text con postId=50",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "global_module 30") > strings.Index(got, "global_module 40") {
+		t.Errorf("modules not sorted by ID:\n%s", got)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GlossaryEntry fixes how a term is translated for a language pair.
+// DoNotTranslate terms must appear unchanged in the translation.
+type GlossaryEntry struct {
+	SourceLang     string `json:"sourceLang"`
+	TargetLang     string `json:"targetLang"`
+	Term           string `json:"term"`
+	Translation    string `json:"translation,omitempty"`
+	DoNotTranslate bool   `json:"doNotTranslate,omitempty"`
+	CaseSensitive  bool   `json:"caseSensitive,omitempty"`
+	Note           string `json:"note,omitempty"`
+}
+
+// Glossary is the terminology store, persisted as a JSON file
+type Glossary struct {
+	mu      sync.RWMutex
+	path    string
+	Entries []GlossaryEntry `json:"entries"`
+}
+
+// NewGlossary loads the glossary from GLOSSARY_PATH (default glossary.json
+// next to the executable). A missing file yields an empty glossary.
+func NewGlossary() (*Glossary, error) {
+	path := os.Getenv("GLOSSARY_PATH")
+	if path == "" {
+		exePath, _ := os.Executable()
+		path = filepath.Join(filepath.Dir(exePath), "glossary.json")
+	}
+
+	g := &Glossary{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo glosario %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("error parseando glosario %s: %v", path, err)
+	}
+	return g, nil
+}
+
+// Path returns the glossary file location
+func (g *Glossary) Path() string {
+	return g.path
+}
+
+// save writes the glossary to disk; callers hold the write lock
+func (g *Glossary) save() error {
+	if err := os.MkdirAll(filepath.Dir(g.path), 0755); err != nil {
+		return fmt.Errorf("error creando directorio del glosario: %v", err)
+	}
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(g.path, data, 0644); err != nil {
+		return fmt.Errorf("error guardando glosario: %v", err)
+	}
+	return nil
+}
+
+// langMatches treats an empty or "*" language on either side as a wildcard
+func langMatches(entryLang, lang string) bool {
+	return entryLang == "" || entryLang == "*" || lang == "" || strings.EqualFold(entryLang, lang)
+}
+
+// Add inserts or replaces entries (same pair and term) and saves the file
+func (g *Glossary) Add(entries []GlossaryEntry) (added, replaced int, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, e := range entries {
+		e.Term = strings.TrimSpace(e.Term)
+		e.Translation = strings.TrimSpace(e.Translation)
+		e.SourceLang = strings.ToLower(strings.TrimSpace(e.SourceLang))
+		e.TargetLang = strings.ToLower(strings.TrimSpace(e.TargetLang))
+		if e.Term == "" {
+			continue
+		}
+		if e.Translation == "" || e.Translation == e.Term {
+			e.DoNotTranslate = true
+			e.Translation = ""
+		}
+
+		found := false
+		for i, existing := range g.Entries {
+			if existing.SourceLang == e.SourceLang && existing.TargetLang == e.TargetLang && strings.EqualFold(existing.Term, e.Term) {
+				g.Entries[i] = e
+				found = true
+				replaced++
+				break
+			}
+		}
+		if !found {
+			g.Entries = append(g.Entries, e)
+			added++
+		}
+	}
+
+	sort.SliceStable(g.Entries, func(i, j int) bool {
+		a, b := g.Entries[i], g.Entries[j]
+		if a.SourceLang+a.TargetLang != b.SourceLang+b.TargetLang {
+			return a.SourceLang+a.TargetLang < b.SourceLang+b.TargetLang
+		}
+		return strings.ToLower(a.Term) < strings.ToLower(b.Term)
+	})
+	return added, replaced, g.save()
+}
+
+// Remove deletes the entries of a term for the given pair (empty langs match all)
+func (g *Glossary) Remove(term, sourceLang, targetLang string) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	kept := g.Entries[:0]
+	removed := 0
+	for _, e := range g.Entries {
+		if strings.EqualFold(e.Term, term) &&
+			(sourceLang == "" || strings.EqualFold(e.SourceLang, sourceLang)) &&
+			(targetLang == "" || strings.EqualFold(e.TargetLang, targetLang)) {
+			removed++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	g.Entries = kept
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, g.save()
+}
+
+// ForPair returns the entries that apply to a source->target language pair
+func (g *Glossary) ForPair(sourceLang, targetLang string) []GlossaryEntry {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var entries []GlossaryEntry
+	for _, e := range g.Entries {
+		if langMatches(e.SourceLang, sourceLang) && langMatches(e.TargetLang, targetLang) && targetLang != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// containsTerm reports whether term occurs in text as a whole word
+func containsTerm(text, term string, caseSensitive bool) bool {
+	if term == "" {
+		return false
+	}
+	if !caseSensitive {
+		text = strings.ToLower(text)
+		term = strings.ToLower(term)
+	}
+	for offset := 0; offset < len(text); {
+		idx := strings.Index(text[offset:], term)
+		if idx == -1 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(term)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// TermsIn returns the entries whose term occurs in any of the texts
+func TermsIn(entries []GlossaryEntry, texts ...string) []GlossaryEntry {
+	var found []GlossaryEntry
+	for _, e := range entries {
+		for _, text := range texts {
+			if containsTerm(text, e.Term, e.CaseSensitive) {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// checkGlossary reports where a required translation is missing or a
+// do-not-translate term was altered
+func checkGlossary(report *ValidationReport, chunk int, entries []GlossaryEntry, source, translated string) {
+	for _, e := range TermsIn(entries, source) {
+		if e.DoNotTranslate {
+			if !containsTerm(translated, e.Term, true) {
+				report.add(chunk, "glosario", false, "el termino no traducible %q ha sido alterado o eliminado", e.Term)
+			}
+			continue
+		}
+		if !containsTerm(translated, e.Translation, e.CaseSensitive) {
+			report.add(chunk, "glosario", false, "falta la traduccion obligatoria %q de %q", e.Translation, e.Term)
+		}
+	}
+}
+
+// formatGlossaryInstructions lists the terms to enforce in a prompt
+func formatGlossaryInstructions(entries []GlossaryEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\nGLOSARIO OBLIGATORIO (terminos presentes en este texto):\n")
+	for _, e := range entries {
+		if e.DoNotTranslate {
+			b.WriteString(fmt.Sprintf("- %q -> NO TRADUCIR (dejar exactamente igual)", e.Term))
+		} else {
+			b.WriteString(fmt.Sprintf("- %q -> %q", e.Term, e.Translation))
+		}
+		if e.Note != "" {
+			b.WriteString(fmt.Sprintf(" (%s)", e.Note))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// parseGlossaryCSV reads "term,translation[,note]" rows. An optional header
+// may name the columns (term/source, translation/target, dnt, note); an empty
+// translation marks the term as do-not-translate.
+func parseGlossaryCSV(r io.Reader, sourceLang, targetLang string) ([]GlossaryEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	cols := map[string]int{"term": 0, "translation": 1, "note": 2, "dnt": -1}
+	header := map[string]string{
+		"term": "term", "source": "term", "termino": "term", "origen": "term",
+		"translation": "translation", "target": "translation", "traduccion": "translation", "destino": "translation",
+		"note": "note", "nota": "note", "dnt": "dnt", "do_not_translate": "dnt", "no_traducir": "dnt",
+	}
+	if _, ok := header[strings.ToLower(strings.TrimSpace(rows[0][0]))]; ok {
+		cols = map[string]int{"term": -1, "translation": -1, "note": -1, "dnt": -1}
+		for i, name := range rows[0] {
+			if key, ok := header[strings.ToLower(strings.TrimSpace(name))]; ok {
+				cols[key] = i
+			}
+		}
+		rows = rows[1:]
+	}
+
+	field := func(row []string, col string) string {
+		if i := cols[col]; i >= 0 && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var entries []GlossaryEntry
+	for _, row := range rows {
+		term := field(row, "term")
+		if term == "" || strings.HasPrefix(term, "#") {
+			continue
+		}
+		dnt := strings.ToLower(field(row, "dnt"))
+		entries = append(entries, GlossaryEntry{
+			SourceLang:     sourceLang,
+			TargetLang:     targetLang,
+			Term:           term,
+			Translation:    field(row, "translation"),
+			DoNotTranslate: dnt == "1" || dnt == "true" || dnt == "yes" || dnt == "si",
+			Note:           field(row, "note"),
+		})
+	}
+	return entries, nil
+}
+
+// TBX (TermBase eXchange) structures, covering TBX-Basic tig and ntig layouts
+type tbxDocument struct {
+	Entries []struct {
+		LangSets []struct {
+			Lang  string   `xml:"lang,attr"`
+			Terms []string `xml:"tig>term"`
+			NTerm []string `xml:"ntig>termGrp>term"`
+		} `xml:"langSet"`
+		Notes []string `xml:"descrip"`
+	} `xml:"text>body>termEntry"`
+}
+
+// parseGlossaryTBX extracts sourceLang->targetLang pairs from a TBX file.
+// Entries without a term in either language are skipped: a missing target
+// term must not turn the entry into a do-not-translate term.
+func parseGlossaryTBX(r io.Reader, sourceLang, targetLang string) ([]GlossaryEntry, error) {
+	if sourceLang == "" || targetLang == "" {
+		return nil, fmt.Errorf("sourceLang y targetLang son obligatorios para importar TBX")
+	}
+	var doc tbxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error leyendo TBX: %v", err)
+	}
+
+	primary := func(lang string) string {
+		lang = strings.ToLower(lang)
+		if i := strings.IndexAny(lang, "-_"); i > 0 {
+			lang = lang[:i]
+		}
+		return lang
+	}
+
+	var entries []GlossaryEntry
+	for _, te := range doc.Entries {
+		terms := make(map[string]string)
+		for _, ls := range te.LangSets {
+			all := append(ls.Terms, ls.NTerm...)
+			if len(all) > 0 {
+				terms[primary(ls.Lang)] = strings.TrimSpace(all[0])
+			}
+		}
+		src, ok := terms[primary(sourceLang)]
+		if !ok || src == "" {
+			continue
+		}
+		dst, ok := terms[primary(targetLang)]
+		if !ok || dst == "" {
+			continue
+		}
+		note := ""
+		if len(te.Notes) > 0 {
+			note = strings.TrimSpace(te.Notes[0])
+		}
+		entries = append(entries, GlossaryEntry{
+			SourceLang: sourceLang, TargetLang: targetLang,
+			Term: src, Translation: dst, Note: note,
+		})
+	}
+	return entries, nil
+}
+
+// getGlossary returns the glossary, loading it if needed
+func (s *MCPServer) getGlossary() (*Glossary, error) {
+	if s.parent != nil {
+		return s.parent.getGlossary()
+	}
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.glossary != nil {
+		return s.glossary, nil
+	}
+	g, err := NewGlossary()
+	if err != nil {
+		return nil, err
+	}
+	s.glossary = g
+	return s.glossary, nil
+}
+
+// glossaryForSession returns the glossary entries for the session language pair
+func (s *MCPServer) glossaryForSession(session *BulkTranslationSession) []GlossaryEntry {
+	g, err := s.getGlossary()
+	if err != nil {
+		s.log("Glosario no disponible: %v", err)
+		return nil
+	}
+	return g.ForPair(session.SourceLang, session.TargetLang)
+}
+
+// glossaryTermsForPart returns the glossary entries that occur in the chunks
+// sent for the current part (and in the post metadata on the first part)
+func (s *MCPServer) glossaryTermsForPart(session *BulkTranslationSession) []GlossaryEntry {
+	entries := s.glossaryForSession(session)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var texts []string
+	partRange := session.PartRanges[session.CurrentPart]
+	for i := partRange[0]; i < partRange[1]; i++ {
+		if !session.isPrefilled(i) {
+			texts = append(texts, tokenText(session.Tokens[session.ChunkIndices[i]]))
+		}
+	}
+	if session.SourceType == "wordpress" && session.CurrentPart == 0 {
+		texts = append(texts, session.OriginalTitle, session.OriginalExcerpt)
+		for _, f := range session.SEOMeta {
+			texts = append(texts, f.Original)
+		}
+	}
+	return TermsIn(entries, texts...)
+}
+
+func (s *MCPServer) handleGlossaryImport(req JSONRPCRequest, params CallToolParams) {
+	path, _ := params.Arguments["path"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
+	targetLang, _ := params.Arguments["targetLang"].(string)
+
+	if path == "" || targetLang == "" {
+		s.writeToolText(req, "ERROR: path y targetLang son obligatorios", true)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR abriendo archivo: %v", err), true)
+		return
+	}
+	defer f.Close()
+
+	var entries []GlossaryEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tbx", ".xml":
+		entries, err = parseGlossaryTBX(f, sourceLang, targetLang)
+	default:
+		entries, err = parseGlossaryCSV(f, sourceLang, targetLang)
+	}
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	g, err := s.getGlossary()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	added, replaced, err := g.Add(entries)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	s.writeToolText(req, fmt.Sprintf(`GLOSARIO IMPORTADO
+==================
+Archivo: %s
+Par de idiomas: %s -> %s
+Terminos leidos: %d
+Nuevos: %d
+Reemplazados: %d
+Glosario: %s`, path, displayLang(sourceLang), targetLang, len(entries), added, replaced, g.Path()), false)
+}
+
+func (s *MCPServer) handleGlossaryAdd(req JSONRPCRequest, params CallToolParams) {
+	entry := GlossaryEntry{}
+	entry.Term, _ = params.Arguments["term"].(string)
+	entry.Translation, _ = params.Arguments["translation"].(string)
+	entry.SourceLang, _ = params.Arguments["sourceLang"].(string)
+	entry.TargetLang, _ = params.Arguments["targetLang"].(string)
+	entry.DoNotTranslate, _ = params.Arguments["doNotTranslate"].(bool)
+	entry.CaseSensitive, _ = params.Arguments["caseSensitive"].(bool)
+	entry.Note, _ = params.Arguments["note"].(string)
+
+	if entry.Term == "" || entry.TargetLang == "" {
+		s.writeToolText(req, "ERROR: term y targetLang son obligatorios", true)
+		return
+	}
+
+	g, err := s.getGlossary()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	if _, _, err := g.Add([]GlossaryEntry{entry}); err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	s.writeToolText(req, fmt.Sprintf("TERMINO GUARDADO\n================\n%s", formatGlossaryInstructions(g.ForPair(entry.SourceLang, entry.TargetLang))), false)
+}
+
+func (s *MCPServer) handleGlossaryRemove(req JSONRPCRequest, params CallToolParams) {
+	term, _ := params.Arguments["term"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
+	targetLang, _ := params.Arguments["targetLang"].(string)
+
+	if term == "" {
+		s.writeToolText(req, "ERROR: term es obligatorio", true)
+		return
+	}
+
+	g, err := s.getGlossary()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	removed, err := g.Remove(term, sourceLang, targetLang)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	s.writeToolText(req, fmt.Sprintf("Terminos eliminados: %d", removed), false)
+}
+
+func (s *MCPServer) handleGlossaryList(req JSONRPCRequest, params CallToolParams) {
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
+	targetLang, _ := params.Arguments["targetLang"].(string)
+
+	g, err := s.getGlossary()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	g.mu.RLock()
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("GLOSARIO\n========\nArchivo: %s\n\n", g.Path()))
+	shown := 0
+	for _, e := range g.Entries {
+		if (sourceLang != "" && !strings.EqualFold(e.SourceLang, sourceLang)) ||
+			(targetLang != "" && !strings.EqualFold(e.TargetLang, targetLang)) {
+			continue
+		}
+		translation := e.Translation
+		if e.DoNotTranslate {
+			translation = "NO TRADUCIR"
+		}
+		b.WriteString(fmt.Sprintf("[%s -> %s] %s = %s", displayLang(e.SourceLang), e.TargetLang, e.Term, translation))
+		if e.Note != "" {
+			b.WriteString(" (" + e.Note + ")")
+		}
+		b.WriteString("\n")
+		shown++
+	}
+	g.mu.RUnlock()
+	b.WriteString(fmt.Sprintf("\nTerminos: %d", shown))
+
+	s.writeToolText(req, b.String(), false)
+}
+
+// displayLang shows "*" for an unspecified language
+func displayLang(lang string) string {
+	if lang == "" {
+		return "*"
+	}
+	return lang
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGlossaryCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []GlossaryEntry
+	}{
+		{"empty", "", nil},
+		{
+			"no header",
+			"presupuesto,quote,comercial\n# comentario,x\nDivi,\n\n",
+			[]GlossaryEntry{
+				{SourceLang: "es", TargetLang: "en", Term: "presupuesto", Translation: "quote", Note: "comercial"},
+				{SourceLang: "es", TargetLang: "en", Term: "Divi"},
+			},
+		},
+		{
+			"header only",
+			"nota,destino,origen,no_traducir\n",
+			nil,
+		},
+		{
+			"header with dnt column",
+			"traduccion,termino,no_traducir,nota\n\"quote, estimate\",presupuesto,,\nElegant Themes,Elegant Themes,si,marca\n",
+			[]GlossaryEntry{
+				{SourceLang: "es", TargetLang: "en", Term: "presupuesto", Translation: "quote, estimate"},
+				{SourceLang: "es", TargetLang: "en", Term: "Elegant Themes", Translation: "Elegant Themes", DoNotTranslate: true, Note: "marca"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGlossaryCSV(strings.NewReader(tt.input), "es", "en")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseGlossaryCSV(strings.NewReader("a,\"b\n"), "es", "en"); err == nil {
+		t.Error("unterminated quote: expected an error")
+	}
+}
+
+const testTBX = `<?xml version="1.0" encoding="UTF-8"?>
+<martif type="TBX-Basic" xml:lang="es">
+  <text><body>
+    <termEntry id="1">
+      <descrip type="definition">Documento con el precio</descrip>
+      <langSet xml:lang="es-ES"><tig><term> presupuesto </term></tig></langSet>
+      <langSet xml:lang="en"><tig><term>quote</term></tig></langSet>
+      <langSet xml:lang="fr"><tig><term>devis</term></tig></langSet>
+    </termEntry>
+    <termEntry id="2">
+      <langSet xml:lang="es"><ntig><termGrp><term>copia de seguridad</term></termGrp></ntig></langSet>
+      <langSet xml:lang="en_GB"><ntig><termGrp><term>backup</term></termGrp></ntig></langSet>
+    </termEntry>
+    <termEntry id="3">
+      <langSet xml:lang="es"><tig><term>factura</term></tig></langSet>
+      <langSet xml:lang="fr"><tig><term>facture</term></tig></langSet>
+    </termEntry>
+    <termEntry id="4">
+      <langSet xml:lang="en"><tig><term>invoice</term></tig></langSet>
+    </termEntry>
+    <termEntry id="5">
+      <langSet xml:lang="es"><tig><term>Divi</term></tig></langSet>
+      <langSet xml:lang="en"><tig><term>Divi</term></tig></langSet>
+    </termEntry>
+  </body></text>
+</martif>`
+
+func TestParseGlossaryTBX(t *testing.T) {
+	got, err := parseGlossaryTBX(strings.NewReader(testTBX), "es", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GlossaryEntry{
+		{SourceLang: "es", TargetLang: "en", Term: "presupuesto", Translation: "quote", Note: "Documento con el precio"},
+		{SourceLang: "es", TargetLang: "en", Term: "copia de seguridad", Translation: "backup"},
+		{SourceLang: "es", TargetLang: "en", Term: "Divi", Translation: "Divi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+
+	// Entry 3 has no English term: it is skipped, not imported as do-not-translate
+	g := &Glossary{path: t.TempDir() + "/glossary.json"}
+	if _, _, err := g.Add(got); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range g.Entries {
+		if e.DoNotTranslate != (e.Term == "Divi") {
+			t.Errorf("%q: DoNotTranslate = %v", e.Term, e.DoNotTranslate)
+		}
+	}
+
+	if _, err := parseGlossaryTBX(strings.NewReader(testTBX), "", "en"); err == nil {
+		t.Error("missing sourceLang: expected an error")
+	}
+	if _, err := parseGlossaryTBX(strings.NewReader("<martif><text>"), "es", "en"); err == nil {
+		t.Error("truncated XML: expected an error")
+	}
+}
+
+func TestContainsTerm(t *testing.T) {
+	tests := []struct {
+		text, term    string
+		caseSensitive bool
+		want          bool
+	}{
+		{"Pide tu presupuesto hoy", "presupuesto", false, true},
+		{"Pide tu Presupuesto hoy", "presupuesto", false, true},
+		{"Pide tu Presupuesto hoy", "presupuesto", true, false},
+		{"presupuestos anuales", "presupuesto", false, false},
+		{"los presupuestos y el presupuesto", "presupuesto", false, true},
+		{"<strong>Divi</strong>", "Divi", true, true},
+		{"DiviBuilder", "Divi", true, false},
+		{"Camión rápido", "camión", false, true},
+		{"acamión", "camión", false, false},
+		{"copia de seguridad diaria", "copia de seguridad", false, true},
+		{"texto", "", false, false},
+	}
+	for _, tt := range tests {
+		if got := containsTerm(tt.text, tt.term, tt.caseSensitive); got != tt.want {
+			t.Errorf("containsTerm(%q, %q, %v) = %v, want %v", tt.text, tt.term, tt.caseSensitive, got, tt.want)
+		}
+	}
+}
+
+func TestCheckGlossary(t *testing.T) {
+	entries := []GlossaryEntry{
+		{Term: "presupuesto", Translation: "quote"},
+		{Term: "Divi", DoNotTranslate: true},
+		{Term: "factura", Translation: "invoice"},
+	}
+	tests := []struct {
+		name               string
+		source, translated string
+		checks             int
+	}{
+		{"all respected", "Tu presupuesto Divi", "Your Divi quote", 0},
+		{"missing translation", "Tu presupuesto", "Your estimate", 1},
+		{"altered dnt term", "Tema Divi", "The divi theme", 1},
+		{"terms not in source", "Hola", "Hello", 0},
+		{"both", "Presupuesto Divi", "Estimate DIVI", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &ValidationReport{}
+			checkGlossary(report, 3, entries, tt.source, tt.translated)
+			if len(report.Issues) != tt.checks {
+				t.Fatalf("got %d issues, want %d: %s", len(report.Issues), tt.checks, report.String())
+			}
+			for _, issue := range report.Issues {
+				if issue.Fatal || issue.Check != "glosario" || issue.Chunk != 3 {
+					t.Errorf("unexpected issue %+v", issue)
+				}
+			}
+		})
+	}
+}
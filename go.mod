@@ -7,6 +7,10 @@ toolchain go1.24.6
 require (
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.3.10
 )
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+)
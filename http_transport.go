@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Streamable HTTP transport headers
+const (
+	httpSessionHeader  = "Mcp-Session-Id"
+	httpProtocolHeader = "MCP-Protocol-Version"
+)
+
+// httpSessionIdleTimeout is how long an HTTP client session is kept unused
+const httpSessionIdleTimeout = 24 * time.Hour
+
+// sseKeepAliveInterval keeps proxies from closing a stream during long calls
+const sseKeepAliveInterval = 15 * time.Second
+
+// httpEventBuffer is how many server notifications are kept for a client
+// while it has no GET stream open; older ones are dropped when it fills up
+const httpEventBuffer = 64
+
+// supportedProtocolVersions are accepted in the MCP-Protocol-Version header
+var supportedProtocolVersions = []string{MCP_PROTOCOL_VERSION, "2025-06-18", "2025-03-26"}
+
+// HTTPConfig configures the streamable HTTP transport
+type HTTPConfig struct {
+	Addr           string   // Listen address (MCP_HTTP_ADDR)
+	Path           string   // MCP endpoint (MCP_HTTP_PATH)
+	Token          string   // Bearer token clients must send (MCP_HTTP_TOKEN)
+	AllowedOrigins []string // Browser origins allowed (MCP_HTTP_ALLOWED_ORIGINS)
+}
+
+// httpConfigFromEnv reads the HTTP transport settings
+func httpConfigFromEnv() HTTPConfig {
+	config := HTTPConfig{
+		Addr:  os.Getenv("MCP_HTTP_ADDR"),
+		Path:  os.Getenv("MCP_HTTP_PATH"),
+		Token: strings.TrimSpace(os.Getenv("MCP_HTTP_TOKEN")),
+	}
+	if config.Addr == "" {
+		config.Addr = "127.0.0.1:8080"
+	}
+	if config.Path == "" {
+		config.Path = "/mcp"
+	}
+	for _, origin := range strings.Split(os.Getenv("MCP_HTTP_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.AllowedOrigins = append(config.AllowedOrigins, origin)
+		}
+	}
+	return config
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local connections
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpClient is an MCP session of the HTTP transport. Each one has its own
+// server, so extractions, batch jobs and the legacy session stay isolated.
+type httpClient struct {
+	id       string
+	server   *MCPServer
+	mu       sync.Mutex
+	pending  map[string]chan JSONRPCResponse // Requests waiting for their response
+	events   chan JSONRPCNotification        // Server notifications for the GET streams
+	closed   chan struct{}                   // Closed when the session ends
+	close    sync.Once
+	lastSeen time.Time
+}
+
+// Registry of HTTP client sessions
+var (
+	httpSessions      = make(map[string]*httpClient)
+	httpSessionsMutex sync.Mutex
+)
+
+// httpSessionActive reports whether an HTTP client session exists
+func httpSessionActive(id string) bool {
+	if id == "" {
+		return false
+	}
+	httpSessionsMutex.Lock()
+	defer httpSessionsMutex.Unlock()
+	_, ok := httpSessions[id]
+	return ok
+}
+
+// newHTTPSessionID returns a random, visible-ASCII session ID
+func newHTTPSessionID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// newHTTPClient registers a client session whose server shares the
+// resources (database, translation memory, glossary) of s
+func (s *MCPServer) newHTTPClient() *httpClient {
+	c := &httpClient{
+		id:       newHTTPSessionID(),
+		pending:  make(map[string]chan JSONRPCResponse),
+		events:   make(chan JSONRPCNotification, httpEventBuffer),
+		closed:   make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+	c.server = &MCPServer{
+		stderr:    s.stderr,
+		parent:    s,
+		owner:     c.id,
+		callSlots: s.slots(),
+	}
+	c.server.sink = c.deliver
+	c.server.notify = c.push
+
+	httpSessionsMutex.Lock()
+	httpSessions[c.id] = c
+	httpSessionsMutex.Unlock()
+	return c
+}
+
+// lookupHTTPClient returns a client session and marks it as used
+func lookupHTTPClient(id string) *httpClient {
+	httpSessionsMutex.Lock()
+	defer httpSessionsMutex.Unlock()
+	c := httpSessions[id]
+	if c != nil {
+		c.mu.Lock()
+		c.lastSeen = time.Now()
+		c.mu.Unlock()
+	}
+	return c
+}
+
+// removeHTTPClient ends a client session, cancelling its calls in progress.
+// Its extractions and batch jobs can be adopted by another client with
+// resume_extraction or batch_next_extraction.
+func removeHTTPClient(id string) {
+	httpSessionsMutex.Lock()
+	c := httpSessions[id]
+	delete(httpSessions, id)
+	httpSessionsMutex.Unlock()
+	if c != nil {
+		c.end()
+		c.server.cancelAllCalls()
+	}
+}
+
+// end closes the GET streams of the session
+func (c *httpClient) end() {
+	c.close.Do(func() { close(c.closed) })
+}
+
+// expect registers a request waiting for its response. It fails if a request
+// with the same ID is already pending.
+func (c *httpClient) expect(id interface{}) (chan JSONRPCResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := requestKey(id)
+	if _, busy := c.pending[key]; busy {
+		return nil, false
+	}
+	ch := make(chan JSONRPCResponse, 1)
+	c.pending[key] = ch
+	return ch, true
+}
+
+// forget stops waiting for a response (the HTTP request went away)
+func (c *httpClient) forget(id interface{}) {
+	c.mu.Lock()
+	delete(c.pending, requestKey(id))
+	c.mu.Unlock()
+}
+
+// deliver is the response sink of the client's server
+func (c *httpClient) deliver(resp JSONRPCResponse) {
+	c.mu.Lock()
+	key := requestKey(resp.ID)
+	ch := c.pending[key]
+	delete(c.pending, key)
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+
+	if ch == nil {
+		c.server.log("Respuesta %v descartada: el cliente HTTP ya no la espera", resp.ID)
+		return
+	}
+	ch <- resp
+}
+
+// push queues a server notification for the GET streams. Each one is sent on
+// a single stream; without a stream open the oldest are dropped when full.
+func (c *httpClient) push(n JSONRPCNotification) {
+	for {
+		select {
+		case c.events <- n:
+			return
+		default:
+		}
+		select {
+		case <-c.events:
+		default:
+		}
+	}
+}
+
+// idle reports whether the session has been unused for longer than maxIdle
+func (c *httpClient) idle(maxIdle time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending) == 0 && time.Since(c.lastSeen) > maxIdle
+}
+
+// RunHTTP serves MCP over streamable HTTP until SIGINT or SIGTERM
+func (s *MCPServer) RunHTTP(config HTTPConfig) error {
+	if config.Token == "" && !isLoopbackAddr(config.Addr) {
+		return fmt.Errorf("MCP_HTTP_TOKEN es obligatorio para escuchar en %s (solo se permite sin token en localhost)", config.Addr)
+	}
+
+	s.restoreSessions()
+
+	stopReaper := make(chan struct{})
+	defer close(stopReaper)
+	go s.reapSessions(stopReaper)
+	go s.reapHTTPClients(stopReaper)
+
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, s.httpHandler(config))
+	srv := &http.Server{
+		Addr:              config.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// GET streams never end by themselves: close them so Shutdown can finish
+	srv.RegisterOnShutdown(func() {
+		httpSessionsMutex.Lock()
+		defer httpSessionsMutex.Unlock()
+		for _, c := range httpSessions {
+			c.end()
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	s.log("Transporte HTTP escuchando en http://%s%s (token: %v)", config.Addr, config.Path, config.Token != "")
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("error en el servidor HTTP: %v", err)
+		}
+	case <-ctx.Done():
+		s.log("Cerrando transporte HTTP...")
+	}
+
+	// Stop accepting requests and let the calls in progress finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		s.log("Error cerrando servidor HTTP: %v", err)
+	}
+
+	httpSessionsMutex.Lock()
+	var clients []*httpClient
+	for id, c := range httpSessions {
+		clients = append(clients, c)
+		delete(httpSessions, id)
+	}
+	httpSessionsMutex.Unlock()
+	for _, c := range clients {
+		c.server.drainCalls()
+	}
+
+	s.closeResources()
+	return nil
+}
+
+// reapHTTPClients ends client sessions idle for longer than httpSessionIdleTimeout
+func (s *MCPServer) reapHTTPClients(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			httpSessionsMutex.Lock()
+			var idle []string
+			for id, c := range httpSessions {
+				if c.idle(httpSessionIdleTimeout) {
+					idle = append(idle, id)
+				}
+			}
+			httpSessionsMutex.Unlock()
+
+			for _, id := range idle {
+				removeHTTPClient(id)
+			}
+			if len(idle) > 0 {
+				s.log("Sesiones HTTP caducadas: %d", len(idle))
+			}
+		}
+	}
+}
+
+// httpHandler checks origin, token and protocol version, then serves the MCP
+// endpoint: POST carries client messages, GET opens a stream of server
+// notifications and DELETE ends the session.
+func (s *MCPServer) httpHandler(config HTTPConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Browsers always send Origin: reject unknown ones (DNS rebinding)
+		if origin := r.Header.Get("Origin"); origin != "" && !containsString(config.AllowedOrigins, origin) {
+			http.Error(w, "Forbidden: origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if config.Token != "" {
+			auth := r.Header.Get("Authorization")
+			token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(config.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scp-divi-translation"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if v := r.Header.Get(httpProtocolHeader); v != "" && !containsString(supportedProtocolVersions, v) {
+			http.Error(w, fmt.Sprintf("Bad Request: unsupported protocol version %s", v), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			s.handleHTTPPost(w, r)
+		case http.MethodGet:
+			s.handleHTTPGet(w, r)
+		case http.MethodDelete:
+			id := r.Header.Get(httpSessionHeader)
+			if id == "" || !httpSessionActive(id) {
+				http.Error(w, "Not Found: unknown session", http.StatusNotFound)
+				return
+			}
+			removeHTTPClient(id)
+			s.log("Sesion HTTP %s cerrada por el cliente", id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeHTTPError answers a message that could not be handled with a JSON-RPC error
+func writeHTTPError(w http.ResponseWriter, status int, id interface{}, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &RPCError{Code: code, Message: message},
+	})
+}
+
+func (s *MCPServer) handleHTTPPost(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if limit := maxMessageSize(); limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, nil, -32600,
+				fmt.Sprintf("Invalid Request: message exceeds the %d byte limit (MCP_MAX_MESSAGE_SIZE)", tooLarge.Limit))
+			return
+		}
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var req JSONRPCRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, nil, -32700, fmt.Sprintf("Parse error: %v", err))
+		return
+	}
+	if req.ID != nil && !isValidRequestID(req.ID) {
+		writeHTTPError(w, http.StatusBadRequest, nil, -32600, "Invalid Request: ID must be a string or integer, not null or other types")
+		return
+	}
+
+	// Responses from the client: the server sends no requests, nothing to do
+	if req.Method == "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var client *httpClient
+	sessionID := r.Header.Get(httpSessionHeader)
+	if req.Method == "initialize" {
+		if sessionID != "" {
+			writeHTTPError(w, http.StatusBadRequest, req.ID, -32600, "Invalid Request: session already initialized")
+			return
+		}
+		client = s.newHTTPClient()
+		w.Header().Set(httpSessionHeader, client.id)
+		s.log("Sesion HTTP %s iniciada desde %s", client.id, r.RemoteAddr)
+	} else {
+		if sessionID == "" {
+			writeHTTPError(w, http.StatusBadRequest, req.ID, -32600, fmt.Sprintf("Invalid Request: %s header is required", httpSessionHeader))
+			return
+		}
+		if client = lookupHTTPClient(sessionID); client == nil {
+			writeHTTPError(w, http.StatusNotFound, req.ID, -32001, "Session not found")
+			return
+		}
+	}
+
+	client.server.log("Received method: %s (sesion HTTP %s)", req.Method, client.id)
+
+	// Notifications get no response
+	if req.ID == nil {
+		client.server.handleRequest(req)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	ch, ok := client.expect(req.ID)
+	if !ok {
+		writeHTTPError(w, http.StatusConflict, req.ID, -32600, fmt.Sprintf("Invalid Request: request ID %v is already in progress", req.ID))
+		return
+	}
+	client.server.handleRequest(req)
+
+	// Tool calls may take minutes: stream them so the connection stays alive
+	if req.Method == "tools/call" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamHTTPResponse(w, r, client, req.ID, ch)
+	} else {
+		select {
+		case resp := <-ch:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		case <-r.Context().Done():
+			// Disconnection is not a cancellation: the call goes on
+			client.forget(req.ID)
+		}
+	}
+
+	if req.Method == "shutdown" {
+		removeHTTPClient(client.id)
+		s.log("Sesion HTTP %s finalizada (shutdown)", client.id)
+	}
+}
+
+// handleHTTPGet streams the server notifications of a session (progress of
+// long calls) as server-sent events until the client or the session goes away
+func (s *MCPServer) handleHTTPGet(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "Not Acceptable: the GET stream requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	sessionID := r.Header.Get(httpSessionHeader)
+	if sessionID == "" {
+		http.Error(w, fmt.Sprintf("Bad Request: %s header is required", httpSessionHeader), http.StatusBadRequest)
+		return
+	}
+	client := lookupHTTPClient(sessionID)
+	if client == nil {
+		http.Error(w, "Not Found: unknown session", http.StatusNotFound)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case n := <-client.events:
+			data, err := json.Marshal(n)
+			if err != nil {
+				s.log("Error serializando notificacion %s: %v", n.Method, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-client.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// streamHTTPResponse sends the response as a server-sent event, with comments
+// as keep-alives while the call runs
+func (s *MCPServer) streamHTTPResponse(w http.ResponseWriter, r *http.Request, client *httpClient, id interface{}, ch chan JSONRPCResponse) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case resp := <-ch:
+			data, err := json.Marshal(resp)
+			if err != nil {
+				s.log("Error serializando respuesta %v: %v", id, err)
+				return
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			client.forget(id)
+			return
+		}
+	}
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
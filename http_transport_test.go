@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHTTPServer serves the MCP endpoint of a fresh server and ends every
+// client session when the test finishes
+func newTestHTTPServer(t *testing.T, config HTTPConfig) (*MCPServer, *httptest.Server) {
+	t.Helper()
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+	ts := httptest.NewServer(s.httpHandler(config))
+	t.Cleanup(func() {
+		httpSessionsMutex.Lock()
+		var ids []string
+		for id := range httpSessions {
+			ids = append(ids, id)
+		}
+		httpSessionsMutex.Unlock()
+		for _, id := range ids {
+			removeHTTPClient(id)
+		}
+		ts.Close()
+	})
+	return s, ts
+}
+
+// postMCP sends a JSON-RPC message with the given headers
+func postMCP(t *testing.T, url, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+const testInitialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+
+// initializeHTTP opens a client session and returns its ID
+func initializeHTTP(t *testing.T, url string, headers map[string]string) string {
+	t.Helper()
+	resp := postMCP(t, url, testInitialize, headers)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("initialize: status %d", resp.StatusCode)
+	}
+	id := resp.Header.Get(httpSessionHeader)
+	if id == "" {
+		t.Fatalf("initialize: no %s header", httpSessionHeader)
+	}
+	return id
+}
+
+func TestHTTPHandlerAuth(t *testing.T) {
+	_, ts := newTestHTTPServer(t, HTTPConfig{Token: "secreto", AllowedOrigins: []string{"https://ok.example"}})
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"no token", nil, http.StatusUnauthorized},
+		{"wrong token", map[string]string{"Authorization": "Bearer otro"}, http.StatusUnauthorized},
+		{"no bearer scheme", map[string]string{"Authorization": "secreto"}, http.StatusUnauthorized},
+		{"unknown origin", map[string]string{"Authorization": "Bearer secreto", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"unsupported version", map[string]string{"Authorization": "Bearer secreto", httpProtocolHeader: "1999-01-01"}, http.StatusBadRequest},
+		{"valid", map[string]string{"Authorization": "Bearer secreto"}, http.StatusOK},
+		{"allowed origin", map[string]string{"Authorization": "Bearer secreto", "Origin": "https://ok.example"}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := postMCP(t, ts.URL, testInitialize, tc.headers)
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+			if tc.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer secreto")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST, DELETE" {
+		t.Errorf("PUT: status %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestHTTPSessionHeader(t *testing.T) {
+	_, ts := newTestHTTPServer(t, HTTPConfig{})
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	id := initializeHTTP(t, ts.URL, nil)
+	if other := initializeHTTP(t, ts.URL, nil); other == id {
+		t.Fatal("two initializations got the same session ID")
+	}
+
+	if resp := postMCP(t, ts.URL, testInitialize, map[string]string{httpSessionHeader: id}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("initialize inside a session: status %d, want 400", resp.StatusCode)
+	}
+	if resp := postMCP(t, ts.URL, ping, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("request without session: status %d, want 400", resp.StatusCode)
+	}
+	if resp := postMCP(t, ts.URL, ping, map[string]string{httpSessionHeader: "desconocida"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want 404", resp.StatusCode)
+	}
+
+	resp := postMCP(t, ts.URL, ping, map[string]string{httpSessionHeader: id})
+	var rpc JSONRPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil || resp.StatusCode != http.StatusOK || rpc.Error != nil {
+		t.Fatalf("ping: status %d, %+v, %v", resp.StatusCode, rpc, err)
+	}
+	if resp := postMCP(t, ts.URL, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, map[string]string{httpSessionHeader: id}); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("notification: status %d, want 202", resp.StatusCode)
+	}
+
+	del := func() int {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL, nil)
+		req.Header.Set(httpSessionHeader, id)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := del(); status != http.StatusNoContent {
+		t.Errorf("DELETE: status %d, want 204", status)
+	}
+	if status := del(); status != http.StatusNotFound {
+		t.Errorf("second DELETE: status %d, want 404", status)
+	}
+	if resp := postMCP(t, ts.URL, ping, map[string]string{httpSessionHeader: id}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("request after DELETE: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHTTPGetStream(t *testing.T) {
+	_, ts := newTestHTTPServer(t, HTTPConfig{})
+	id := initializeHTTP(t, ts.URL, nil)
+
+	get := func(headers map[string]string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	if resp := get(map[string]string{httpSessionHeader: id}); resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("GET without Accept: status %d, want 406", resp.StatusCode)
+	}
+	if resp := get(map[string]string{"Accept": "text/event-stream"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET without session: status %d, want 400", resp.StatusCode)
+	}
+	if resp := get(map[string]string{"Accept": "text/event-stream", httpSessionHeader: "desconocida"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET with unknown session: status %d, want 404", resp.StatusCode)
+	}
+
+	resp := get(map[string]string{"Accept": "text/event-stream", httpSessionHeader: id})
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("GET stream: status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Below the requested level nothing is sent
+	setLevel := `{"jsonrpc":"2.0","id":3,"method":"logging/setLevel","params":{"level":"warning"}}`
+	if r := postMCP(t, ts.URL, setLevel, map[string]string{httpSessionHeader: id}); r.StatusCode != http.StatusOK {
+		t.Fatalf("logging/setLevel: status %d", r.StatusCode)
+	}
+	client := lookupHTTPClient(id)
+	client.server.notifyLog("info", "no enviado")
+	client.server.notifyLog("warning", "Parte %d de %d recibida", 1, 3)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	var data string
+	timeout := time.After(5 * time.Second)
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before the notification")
+			}
+			data = strings.TrimPrefix(line, "data: ")
+			if data == line {
+				data = ""
+			}
+		case <-timeout:
+			t.Fatal("no notification on the GET stream")
+		}
+	}
+	var n struct {
+		Method string
+		Params struct {
+			Level string
+			Data  string
+		}
+	}
+	if err := json.Unmarshal([]byte(data), &n); err != nil {
+		t.Fatalf("event data %q: %v", data, err)
+	}
+	if n.Method != "notifications/message" || n.Params.Level != "warning" || n.Params.Data != "Parte 1 de 3 recibida" {
+		t.Errorf("notification = %+v", n)
+	}
+
+	// Ending the session ends the stream
+	removeHTTPClient(id)
+	for {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("GET stream still open after the session ended")
+		}
+	}
+}
+
+func TestHTTPClientIsolation(t *testing.T) {
+	t.Setenv("SESSION_STATE_DIR", t.TempDir())
+	s, _ := newTestHTTPServer(t, HTTPConfig{})
+	a := s.newHTTPClient()
+	b := s.newHTTPClient()
+
+	session := newTestFileSession(t, a.server, `[et_pb_section][et_pb_text]<p>Hola mundo</p>[/et_pb_text][/et_pb_section]`, "")
+	job := &BatchJob{ID: "lote-test", TargetLang: "en", Owner: a.id}
+	batchJobsMutex.Lock()
+	batchJobs[job.ID] = job
+	batchJobsMutex.Unlock()
+	t.Cleanup(func() {
+		batchJobsMutex.Lock()
+		delete(batchJobs, job.ID)
+		batchJobsMutex.Unlock()
+	})
+
+	if got := a.server.lockOwnExtraction(session.ExtractionID); got == nil {
+		t.Fatal("the owner cannot use its extraction")
+	} else {
+		got.mu.Unlock()
+	}
+	if b.server.lockOwnExtraction(session.ExtractionID) != nil {
+		t.Error("another client used the extraction")
+	}
+	if b.server.lockResumedExtraction(session.ExtractionID) != nil {
+		t.Error("another client resumed the extraction of an active session")
+	}
+	if b.server.lookupBatchJob(job.ID, true) != nil {
+		t.Error("another client adopted the batch job of an active session")
+	}
+	if len(b.server.ownExtractions()) != 0 {
+		t.Error("list_extractions shows the extractions of another client")
+	}
+
+	// Once the owner is gone only an explicit resume adopts them
+	removeHTTPClient(a.id)
+	if b.server.lockOwnExtraction(session.ExtractionID) != nil {
+		t.Error("an orphaned extraction was used without resuming it")
+	}
+	if b.server.lookupBatchJob(job.ID, false) != nil {
+		t.Error("an orphaned batch job was used without resuming it")
+	}
+	got := b.server.lockResumedExtraction(session.ExtractionID)
+	if got == nil {
+		t.Fatal("resume did not adopt the orphaned extraction")
+	}
+	got.mu.Unlock()
+	if session.Owner != b.id {
+		t.Errorf("Owner = %q, want %q", session.Owner, b.id)
+	}
+	if b.server.lockOwnExtraction(session.ExtractionID) == nil {
+		t.Error("the adopting client cannot use the extraction")
+	} else {
+		session.mu.Unlock()
+	}
+	if b.server.lookupBatchJob(job.ID, true) == nil || job.Owner != b.id {
+		t.Errorf("batch job not adopted: Owner = %q", job.Owner)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Offline source language detection with character trigram profiles
+// (Cavnar & Trenkle, "N-Gram-Based Text Categorization"). The profiles are
+// built at first use from the sample texts below, which are written in the
+// register of a typical business website.
+
+// langProfileSize is how many of the most frequent trigrams are compared
+const langProfileSize = 300
+
+// minDetectLetters is the least amount of text worth running the detector on
+const minDetectLetters = 40
+
+// maxDetectChars bounds the text sampled from a large document
+const maxDetectChars = 20000
+
+// minDetectConfidence is the confidence below which the result is not used
+// as source language
+const minDetectConfidence = 0.15
+
+// langSamples holds the training text of each supported language
+var langSamples = map[string]string{
+	"es": `Somos una empresa familiar con mas de veinte años de experiencia en el sector. Nuestro equipo de profesionales trabaja cada dia para ofrecer a nuestros clientes un servicio cercano, rapido y de calidad. Descubre todos nuestros productos y servicios, pide un presupuesto sin compromiso y contacta con nosotros para cualquier duda. Estaremos encantados de ayudarte.
+Nuestra mision es que cada proyecto sea un exito. Por eso escuchamos las necesidades de cada cliente, analizamos la situacion y proponemos la solucion que mejor se adapta a su negocio. Trabajamos con los mejores materiales y cumplimos siempre los plazos de entrega.
+¿Quieres saber mas? Lee nuestro blog, donde publicamos noticias, consejos y las ultimas novedades del sector. Tambien puedes seguirnos en las redes sociales o suscribirte a nuestro boletin para recibir las ofertas antes que nadie.
+Horario de atencion al cliente: de lunes a viernes, de nueve de la mañana a seis de la tarde. Envianos un mensaje a traves del formulario de contacto y te responderemos lo antes posible. Todos los precios incluyen el impuesto. Politica de privacidad, aviso legal y politica de cookies.`,
+
+	"ca": `Som una empresa familiar amb més de vint anys d'experiència en el sector. El nostre equip de professionals treballa cada dia per oferir als nostres clients un servei proper, ràpid i de qualitat. Descobreix tots els nostres productes i serveis, demana un pressupost sense compromís i contacta amb nosaltres per a qualsevol dubte. Estarem encantats d'ajudar-te.
+La nostra missió és que cada projecte sigui un èxit. Per això escoltem les necessitats de cada client, analitzem la situació i proposem la solució que millor s'adapta al seu negoci. Treballem amb els millors materials i complim sempre els terminis de lliurament.
+Vols saber-ne més? Llegeix el nostre blog, on publiquem notícies, consells i les últimes novetats del sector. També pots seguir-nos a les xarxes socials o subscriure't al nostre butlletí per rebre les ofertes abans que ningú.
+Horari d'atenció al client: de dilluns a divendres, de nou del matí a sis de la tarda. Envia'ns un missatge a través del formulari de contacte i et respondrem tan aviat com sigui possible. Tots els preus inclouen l'impost. Política de privadesa, avís legal i política de galetes.`,
+
+	"en": `We are a family business with more than twenty years of experience in the industry. Our team of professionals works every day to offer our customers a friendly, fast and high quality service. Discover all our products and services, ask for a free quote and get in touch with us if you have any questions. We will be happy to help you.
+Our mission is to make every project a success. That is why we listen to the needs of each client, analyse the situation and propose the solution that best fits their business. We work with the best materials and we always meet the delivery deadlines.
+Would you like to know more? Read our blog, where we publish news, tips and the latest trends of the industry. You can also follow us on social media or subscribe to our newsletter to receive the offers before anyone else.
+Customer service hours: Monday to Friday, from nine in the morning to six in the evening. Send us a message through the contact form and we will answer as soon as possible. All prices include tax. Privacy policy, legal notice and cookie policy.`,
+
+	"fr": `Nous sommes une entreprise familiale avec plus de vingt ans d'expérience dans le secteur. Notre équipe de professionnels travaille chaque jour pour offrir à nos clients un service proche, rapide et de qualité. Découvrez tous nos produits et services, demandez un devis sans engagement et contactez-nous pour toute question. Nous serons ravis de vous aider.
+Notre mission est que chaque projet soit un succès. C'est pourquoi nous écoutons les besoins de chaque client, nous analysons la situation et nous proposons la solution qui s'adapte le mieux à son activité. Nous travaillons avec les meilleurs matériaux et nous respectons toujours les délais de livraison.
+Vous voulez en savoir plus ? Lisez notre blog, où nous publions des actualités, des conseils et les dernières nouveautés du secteur. Vous pouvez aussi nous suivre sur les réseaux sociaux ou vous abonner à notre lettre d'information pour recevoir les offres avant tout le monde.
+Horaires du service client : du lundi au vendredi, de neuf heures du matin à six heures du soir. Envoyez-nous un message avec le formulaire de contact et nous vous répondrons dans les plus brefs délais. Tous les prix sont toutes taxes comprises. Politique de confidentialité, mentions légales et politique relative aux cookies.`,
+
+	"de": `Wir sind ein Familienunternehmen mit mehr als zwanzig Jahren Erfahrung in der Branche. Unser Team aus Fachleuten arbeitet jeden Tag daran, unseren Kunden einen persönlichen, schnellen und hochwertigen Service zu bieten. Entdecken Sie alle unsere Produkte und Dienstleistungen, fordern Sie ein unverbindliches Angebot an und kontaktieren Sie uns bei Fragen. Wir helfen Ihnen gerne weiter.
+Unsere Aufgabe ist es, jedes Projekt zu einem Erfolg zu machen. Deshalb hören wir uns die Wünsche jedes Kunden an, analysieren die Situation und schlagen die Lösung vor, die am besten zu seinem Unternehmen passt. Wir arbeiten mit den besten Materialien und halten die Liefertermine immer ein.
+Möchten Sie mehr erfahren? Lesen Sie unseren Blog, in dem wir Neuigkeiten, Tipps und die neuesten Entwicklungen der Branche veröffentlichen. Sie können uns auch in den sozialen Netzwerken folgen oder unseren Newsletter abonnieren, um die Angebote vor allen anderen zu erhalten.
+Öffnungszeiten des Kundendienstes: Montag bis Freitag, von neun Uhr morgens bis sechs Uhr abends. Schicken Sie uns eine Nachricht über das Kontaktformular und wir antworten Ihnen so schnell wie möglich. Alle Preise verstehen sich inklusive Mehrwertsteuer. Datenschutzerklärung, Impressum und Cookie-Richtlinie.`,
+
+	"it": `Siamo un'azienda familiare con più di vent'anni di esperienza nel settore. Il nostro team di professionisti lavora ogni giorno per offrire ai nostri clienti un servizio vicino, rapido e di qualità. Scopri tutti i nostri prodotti e servizi, richiedi un preventivo senza impegno e contattaci per qualsiasi domanda. Saremo felici di aiutarti.
+La nostra missione è che ogni progetto sia un successo. Per questo ascoltiamo le esigenze di ogni cliente, analizziamo la situazione e proponiamo la soluzione che meglio si adatta alla sua attività. Lavoriamo con i migliori materiali e rispettiamo sempre i tempi di consegna.
+Vuoi saperne di più? Leggi il nostro blog, dove pubblichiamo notizie, consigli e le ultime novità del settore. Puoi anche seguirci sui social network o iscriverti alla nostra newsletter per ricevere le offerte prima di tutti.
+Orari del servizio clienti: dal lunedì al venerdì, dalle nove del mattino alle sei del pomeriggio. Inviaci un messaggio tramite il modulo di contatto e ti risponderemo il prima possibile. Tutti i prezzi sono comprensivi di imposta. Informativa sulla privacy, note legali e politica dei cookie.`,
+
+	"pt": `Somos uma empresa familiar com mais de vinte anos de experiência no setor. A nossa equipa de profissionais trabalha todos os dias para oferecer aos nossos clientes um serviço próximo, rápido e de qualidade. Descubra todos os nossos produtos e serviços, peça um orçamento sem compromisso e entre em contacto connosco para qualquer dúvida. Teremos todo o gosto em ajudar.
+A nossa missão é que cada projeto seja um sucesso. Por isso ouvimos as necessidades de cada cliente, analisamos a situação e propomos a solução que melhor se adapta ao seu negócio. Trabalhamos com os melhores materiais e cumprimos sempre os prazos de entrega.
+Quer saber mais? Leia o nosso blog, onde publicamos notícias, conselhos e as últimas novidades do setor. Também pode seguir-nos nas redes sociais ou subscrever a nossa newsletter para receber as ofertas antes de todos.
+Horário de atendimento ao cliente: de segunda a sexta-feira, das nove da manhã às seis da tarde. Envie-nos uma mensagem através do formulário de contacto e responderemos o mais rapidamente possível. Todos os preços incluem o imposto. Política de privacidade, aviso legal e política de cookies.`,
+
+	"nl": `Wij zijn een familiebedrijf met meer dan twintig jaar ervaring in de sector. Ons team van professionals werkt elke dag om onze klanten een persoonlijke, snelle en kwalitatieve service te bieden. Ontdek al onze producten en diensten, vraag een vrijblijvende offerte aan en neem contact met ons op als u vragen heeft. Wij helpen u graag verder.
+Onze missie is om van elk project een succes te maken. Daarom luisteren wij naar de wensen van elke klant, analyseren wij de situatie en stellen wij de oplossing voor die het beste bij zijn bedrijf past. Wij werken met de beste materialen en houden ons altijd aan de levertijden.
+Wilt u meer weten? Lees onze blog, waar wij nieuws, tips en de laatste ontwikkelingen in de sector publiceren. U kunt ons ook volgen op sociale media of u abonneren op onze nieuwsbrief om de aanbiedingen als eerste te ontvangen.
+Openingstijden van de klantenservice: maandag tot en met vrijdag, van negen uur 's ochtends tot zes uur 's avonds. Stuur ons een bericht via het contactformulier en wij antwoorden zo snel mogelijk. Alle prijzen zijn inclusief btw. Privacybeleid, disclaimer en cookiebeleid.`,
+}
+
+// langNames are the display names of the supported languages
+var langNames = map[string]string{
+	"es": "espanol",
+	"ca": "catalan",
+	"en": "ingles",
+	"fr": "frances",
+	"de": "aleman",
+	"it": "italiano",
+	"pt": "portugues",
+	"nl": "neerlandes",
+}
+
+var (
+	langProfilesOnce sync.Once
+	langProfiles     map[string]map[string]int // Trigram -> rank, per language
+)
+
+// LangDetection is the result of running the detector over a text
+type LangDetection struct {
+	Lang       string  // Best language, empty if the text is too short
+	Confidence float64 // 0..1, relative margin over the second best language
+	Runner     string  // Second best language
+}
+
+// htmlEntityPattern matches named and numeric HTML entities
+var htmlEntityPattern = regexp.MustCompile(`(?i)&(?:#\d+|#x[0-9a-f]+|[a-z][a-z0-9]*);`)
+
+// detectText normalizes text for the detector: HTML entities are decoded,
+// HTML tags, shortcodes and URLs are dropped, letters are lowercased and
+// everything else becomes a word boundary
+func detectText(text string) string {
+	// Only well-formed entities are decoded: a bare "&" is just punctuation.
+	// Unknown entities and escaped markup ("&lt;") become word boundaries, so
+	// they cannot open a tag below.
+	text = htmlEntityPattern.ReplaceAllStringFunc(text, func(entity string) string {
+		decoded := html.UnescapeString(entity)
+		if decoded == entity || strings.ContainsAny(decoded, "<>[]") {
+			return " "
+		}
+		return decoded
+	})
+
+	var b strings.Builder
+	skip := rune(0)
+	for _, r := range text {
+		switch {
+		case skip != 0:
+			if r == skip {
+				skip = 0
+				b.WriteByte(' ') // Tags and shortcodes separate words
+			}
+			continue
+		case r == '<':
+			skip = '>'
+			continue
+		case r == '[':
+			skip = ']'
+			continue
+		}
+		if unicode.IsLetter(r) || r == '\'' || r == '’' {
+			if r == '’' {
+				r = '\''
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	// Drop what is left of URLs and e-mail addresses
+	words := strings.Fields(b.String())
+	kept := words[:0]
+	for _, w := range words {
+		if w == "http" || w == "https" || w == "www" {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	return strings.Join(kept, " ")
+}
+
+// trigramProfile ranks the most frequent trigrams of a normalized text. Words
+// are padded with a space so their beginnings and ends count as trigrams.
+func trigramProfile(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(text) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	grams := make([]string, 0, len(counts))
+	for g := range counts {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	if len(grams) > langProfileSize {
+		grams = grams[:langProfileSize]
+	}
+
+	profile := make(map[string]int, len(grams))
+	for rank, g := range grams {
+		profile[g] = rank
+	}
+	return profile
+}
+
+func loadLangProfiles() {
+	langProfiles = make(map[string]map[string]int, len(langSamples))
+	for lang, sample := range langSamples {
+		langProfiles[lang] = trigramProfile(detectText(sample))
+	}
+}
+
+// outOfPlace is the Cavnar & Trenkle distance between a document profile and
+// a language profile. Trigrams missing from the language cost the maximum.
+func outOfPlace(doc, lang map[string]int) int {
+	distance := 0
+	for g, rank := range doc {
+		if langRank, ok := lang[g]; ok {
+			d := rank - langRank
+			if d < 0 {
+				d = -d
+			}
+			distance += d
+		} else {
+			distance += langProfileSize
+		}
+	}
+	return distance
+}
+
+// detectLanguage returns the most likely language of a text among the
+// supported ones
+func detectLanguage(text string) LangDetection {
+	langProfilesOnce.Do(loadLangProfiles)
+
+	normalized := detectText(text)
+	letters := 0
+	for _, r := range normalized {
+		if r != ' ' {
+			letters++
+		}
+	}
+	if letters < minDetectLetters {
+		return LangDetection{}
+	}
+
+	doc := trigramProfile(normalized)
+	type score struct {
+		lang     string
+		distance int
+	}
+	scores := make([]score, 0, len(langProfiles))
+	for lang, profile := range langProfiles {
+		scores = append(scores, score{lang, outOfPlace(doc, profile)})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].distance != scores[j].distance {
+			return scores[i].distance < scores[j].distance
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	best, second := scores[0], scores[1]
+	confidence := 0.0
+	if second.distance > 0 {
+		// A tenth of the second distance is already a clear margin
+		confidence = float64(second.distance-best.distance) / float64(second.distance) * 10
+		if confidence > 1 {
+			confidence = 1
+		}
+	}
+	return LangDetection{Lang: best.lang, Confidence: confidence, Runner: second.lang}
+}
+
+// detectChunksLanguage runs the detector over the translatable chunks of a
+// document, up to maxDetectChars of text
+func detectChunksLanguage(tokens []Token, chunkIndices []int) LangDetection {
+	var b strings.Builder
+	for _, idx := range chunkIndices {
+		if b.Len() >= maxDetectChars {
+			break
+		}
+		b.WriteString(tokenText(tokens[idx]))
+		b.WriteString("\n")
+	}
+	return detectLanguage(b.String())
+}
+
+// normalizeLangCode lowercases a language code and uses "-" as separator
+func normalizeLangCode(lang string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(lang)), "_", "-")
+}
+
+// baseLang returns the primary subtag of a language code ("pt-br" -> "pt")
+func baseLang(lang string) string {
+	return strings.SplitN(normalizeLangCode(lang), "-", 2)[0]
+}
+
+// checkLanguagePair rejects a translation whose explicit source language is
+// the target language. Regional variants of the same language are allowed
+// (es-ES -> es-MX), as adapting a text between them is a real task.
+func checkLanguagePair(sourceLang, targetLang string) error {
+	if sourceLang == "" {
+		return nil
+	}
+	if normalizeLangCode(sourceLang) == normalizeLangCode(targetLang) {
+		return fmt.Errorf("sourceLang y targetLang son el mismo idioma (%s): no hay nada que traducir", targetLang)
+	}
+	return nil
+}
+
+// describeSourceLang formats the source language of a session for the
+// extraction header
+func describeSourceLang(session *BulkTranslationSession) string {
+	if session.SourceLang == "" {
+		if session.DetectedLang != "" {
+			return fmt.Sprintf("desconocido (deteccion dudosa: %s, confianza %.0f%%; indica sourceLang)",
+				session.DetectedLang, session.DetectedConfidence*100)
+		}
+		return "desconocido (texto insuficiente para detectarlo; indica sourceLang)"
+	}
+	if session.DetectedLang == "" {
+		return fmt.Sprintf("%s (indicado)", session.SourceLang)
+	}
+	name := langNames[session.SourceLang]
+	return fmt.Sprintf("%s - %s (detectado, confianza %.0f%%)", session.SourceLang, name, session.DetectedConfidence*100)
+}
+
+// translationDirection is the "from ... to ..." part of the instructions
+func translationDirection(session *BulkTranslationSession) string {
+	if session.SourceLang == "" {
+		return "a " + session.TargetLang
+	}
+	return fmt.Sprintf("de %s a %s", session.SourceLang, session.TargetLang)
+}
+
+// sameLanguageWarning returns a warning when the detected source language is
+// the target language, or "" if there is none. An explicit sourceLang equal
+// to the target is refused earlier by checkLanguagePair.
+func sameLanguageWarning(session *BulkTranslationSession) string {
+	if session.DetectedLang == "" || session.DetectedConfidence < minDetectConfidence {
+		return ""
+	}
+	if session.DetectedLang != baseLang(session.TargetLang) {
+		return ""
+	}
+	return fmt.Sprintf(`
+AVISO: el texto parece estar ya en el idioma destino (%s).
+Comprueba que el post/archivo y targetLang son los correctos. Si la deteccion
+se equivoca, vuelve a extraer indicando sourceLang.
+`, session.TargetLang)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestDetectTextEntities(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Salt & pepper; then serve", "salt pepper then serve"},
+		{"Caf&eacute; &amp; t&#233; &#x00e9;t&eacute;", "café té été"},
+		{"Nuestra Misi&oacute;n&nbsp;y visi&Oacute;n", "nuestra misión y visión"},
+		{"Si a &lt; b entonces &gt; nada &#91;x&#93; fin", "si a b entonces nada x fin"},
+		{"Texto &desconocida; aqui", "texto aqui"},
+		{"R&D department", "r d department"},
+		{"<p>Hola <b>mundo</b></p>[et_pb_text]adios", "hola mundo adios"},
+	}
+	for _, tt := range tests {
+		if got := detectText(tt.in); got != tt.want {
+			t.Errorf("detectText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguageWithAmpersand(t *testing.T) {
+	text := "Salt & pepper are added at the end; the kitchen team prepares every dish " +
+		"with fresh ingredients from local farmers and we serve it with a smile"
+	if got := detectLanguage(text); got.Lang != "en" {
+		t.Errorf("detectLanguage = %+v, want en", got)
+	}
+}
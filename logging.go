@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// logLevels are the MCP logging levels (RFC 5424 severities), lowest first
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// defaultLogLevel is sent to clients that never call logging/setLevel
+const defaultLogLevel = "info"
+
+// logLevelRank returns the position of a level in logLevels, or -1
+func logLevelRank(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// notifyLog sends a notifications/message to the client when level is at or
+// above the level it asked for. Long operations use it to report progress.
+func (s *MCPServer) notifyLog(level, format string, args ...interface{}) {
+	s.logMu.Lock()
+	min := s.logLevel
+	s.logMu.Unlock()
+	if min == "" {
+		min = defaultLogLevel
+	}
+	if logLevelRank(level) < logLevelRank(min) {
+		return
+	}
+	s.writeNotification(JSONRPCNotification{
+		Method: "notifications/message",
+		Params: map[string]interface{}{
+			"level":  level,
+			"logger": "divi-translator",
+			"data":   fmt.Sprintf(format, args...),
+		},
+	})
+}
+
+// notifyBatchProgress reports a finished batch item and the job totals
+func (s *MCPServer) notifyBatchProgress(job *BatchJob, item *BatchItem, outcome string) {
+	job.mu.Lock()
+	progress := job.progressLine()
+	job.mu.Unlock()
+	s.notifyLog("info", "Post %d %s. %s", item.PostID, outcome, progress)
+}
+
+func (s *MCPServer) handleSetLogLevel(req JSONRPCRequest) {
+	var params struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || logLevelRank(params.Level) < 0 {
+		s.writeResponse(JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32602, Message: fmt.Sprintf("Invalid params: unknown log level %q", params.Level)},
+		})
+		return
+	}
+
+	s.logMu.Lock()
+	s.logLevel = params.Level
+	s.logMu.Unlock()
+	s.writeResponse(JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	})
+}
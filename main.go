@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -19,8 +22,29 @@ func main() {
 	// Also try current working directory
 	godotenv.Load(".env")
 
-	// Run MCP server via stdio
+	// Flags override the environment
+	transport := flag.String("transport", os.Getenv("MCP_TRANSPORT"), "transporte MCP: stdio (por defecto) o http")
+	httpAddr := flag.String("http-addr", "", "direccion de escucha del transporte HTTP (por defecto MCP_HTTP_ADDR o 127.0.0.1:8080)")
+	flag.Parse()
+
 	server := NewMCPServer()
-	server.Run()
+	switch strings.ToLower(strings.TrimSpace(*transport)) {
+	case "", "stdio":
+		// Run MCP server via stdio
+		server.Run()
+	case "http":
+		// Run MCP server via streamable HTTP
+		config := httpConfigFromEnv()
+		if *httpAddr != "" {
+			config.Addr = *httpAddr
+		}
+		if err := server.RunHTTP(config); err != nil {
+			fmt.Fprintf(os.Stderr, "[MCP] %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "[MCP] Transporte no soportado: %s (usa stdio o http)\n", *transport)
+		os.Exit(2)
+	}
 	os.Exit(0)
 }
@@ -1,25 +1,38 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // MCP JSON-RPC types
 const MCP_PROTOCOL_VERSION = "2025-11-25"
+const SERVER_VERSION = "4.3.0"
 
 type JSONRPCRequest struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id,omitempty"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
+
+	ctx context.Context // Cancelled by notifications/cancelled or shutdown
+}
+
+// Context returns the request context (Background for inline requests)
+func (r JSONRPCRequest) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
 type JSONRPCResponse struct {
@@ -29,6 +42,12 @@ type JSONRPCResponse struct {
 	Error   *RPCError   `json:"error,omitempty"`
 }
 
+// JSONRPCNotification is a message sent by the server without a request
+type JSONRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
 
 type RPCError struct {
 	Code    int    `json:"code"`
@@ -47,7 +66,8 @@ type InitializeParams struct {
 type InitializeResult struct {
 	ProtocolVersion string `json:"protocolVersion"`
 	Capabilities    struct {
-		Tools map[string]interface{} `json:"tools,omitempty"`
+		Tools   map[string]interface{} `json:"tools,omitempty"`
+		Logging map[string]interface{} `json:"logging,omitempty"`
 	} `json:"capabilities"`
 	ServerInfo struct {
 		Name    string `json:"name"`
@@ -99,36 +119,179 @@ type TranslationSession struct {
 
 // BulkTranslationSession holds state for the optimized bulk translation flow
 type BulkTranslationSession struct {
-	ExtractionID string   // Unique ID for this extraction
-	SourceType   string   // "file" or "wordpress"
-	InputPath    string   // For file source
-	OutputPath   string   // For file source
-	PostID       int64    // For wordpress source
-	BackupPath   string   // For wordpress source
-	TargetLang   string
-	Tokens       []Token
-	ChunkIndices []int    // Indices of text tokens
-	TotalChunks  int
-	Parts        int      // Number of parts (1, 2, or 3)
-	CurrentPart  int      // Current part being translated
-	PartRanges   [][2]int // Start/end indices for each part
-	Translations []string // Collected translations per chunk
-	TextForTranslation string // Generated text with markers (stored, not sent twice)
+	ExtractionID       string // Unique ID for this extraction
+	SourceType         string // "file" or "wordpress"
+	InputPath          string // For file source
+	OutputPath         string // For file source
+	PostID             int64  // For wordpress source
+	BackupPath         string // For wordpress source
+	TargetLang         string
+	Document           *ShortcodeDocument `json:"-"` // Parsed shortcode tree of the source content
+	Tokens             []Token            `json:"-"` // Flattened view of Document
+	ChunkIndices       []int              // Indices of text tokens
+	TotalChunks        int
+	Parts              int               // Number of parts (1, 2, or 3)
+	CurrentPart        int               // Current part being translated
+	PartRanges         [][2]int          // Start/end indices for each part
+	Translations       []string          // Collected translations per chunk
+	TextForTranslation string            // Generated text with markers (stored, not sent twice)
+	SourceLang         string            // Source language code (empty when unknown)
+	DetectedLang       string            // Language found by the detector (empty if sourceLang was given)
+	DetectedConfidence float64           // Confidence of DetectedLang, 0..1
+	Prefilled          []bool            // Chunks filled from the translation memory (not sent)
+	TMHits             int               // Number of prefilled chunks
+	FuzzyMatches       []*TMMatch        // Best similar TM segment per chunk (nil if none)
+	FuzzyHits          int               // Number of chunks with a fuzzy suggestion
+	PartGlossaryIssues []ValidationIssue // Glossary problems found parsing the current part
+	KeptChunks         int               // Chunks whose translation survived refresh_extraction
+	SkipGlobalModules  bool              // Text of Divi global modules is left to the library item
+	GlobalModules      map[int64]int     // Chunks left out per global module ID
 	// WordPress metadata (for wordpress source)
-	OriginalTitle   string
-	OriginalSlug    string
-	OriginalExcerpt string
+	OriginalVersion   PostVersion // Post state at extraction, checked before saving
+	OriginalTitle     string
+	OriginalSlug      string
+	OriginalExcerpt   string
+	SEOMeta           []SEOMetaValue // SEO plugin postmeta (Yoast, Rank Math) translated with the post
 	TranslatedTitle   string
 	TranslatedSlug    string
 	TranslatedExcerpt string
+	ValidationIssues  []ValidationIssue // Accepted (warning or forced) validation issues
+	BatchJobID        string            // Batch job this extraction belongs to (empty if none)
+	CreateCopy        bool              // Save as a new post instead of overwriting PostID
+	CopyStatus        string            // post_status of the new post (default draft)
+	NewPostID         int64             // ID of the created copy
+	SiblingChecked    bool              // SiblingID/SiblingVersion were recorded at extraction
+	SiblingID         int64             // Existing translation a copy save overwrites (0 if none)
+	SiblingVersion    PostVersion       // State of SiblingID at extraction, checked before saving
+	Owner             string            // HTTP client session that created it (empty for stdio)
+	CreatedAt         time.Time
+	UpdatedAt         time.Time // Last state change (persisted)
+	Restored          bool      `json:"-"` // Reloaded from the state directory
+
+	mu sync.Mutex // Serializes tool calls on the same extraction
+}
+
+// isPrefilled reports whether chunk i was filled from the translation memory
+func (b *BulkTranslationSession) isPrefilled(i int) bool {
+	return i < len(b.Prefilled) && b.Prefilled[i]
+}
+
+// pendingInPart returns how many chunks of a part must be sent for translation
+func (b *BulkTranslationSession) pendingInPart(part int) int {
+	pending := 0
+	for i := b.PartRanges[part][0]; i < b.PartRanges[part][1]; i++ {
+		if !b.isPrefilled(i) {
+			pending++
+		}
+	}
+	return pending
 }
 
 // Global storage for active extraction sessions
 var (
-	activeExtractions   = make(map[string]*BulkTranslationSession)
-	extractionsMutex    sync.RWMutex
+	activeExtractions = make(map[string]*BulkTranslationSession)
+	extractionsMutex  sync.RWMutex
 )
 
+// publishSession makes a fully initialized session visible to other calls
+func (s *MCPServer) publishSession(session *BulkTranslationSession) {
+	session.Owner = s.owner
+	extractionsMutex.Lock()
+	activeExtractions[session.ExtractionID] = session
+	extractionsMutex.Unlock()
+}
+
+// lockExtraction returns the active session with its lock held, or nil if it
+// does not exist or finished while waiting. The caller must unlock session.mu.
+func lockExtraction(extractionID string) *BulkTranslationSession {
+	extractionsMutex.RLock()
+	session := activeExtractions[extractionID]
+	extractionsMutex.RUnlock()
+	if session == nil {
+		return nil
+	}
+
+	session.mu.Lock()
+	extractionsMutex.RLock()
+	current := activeExtractions[extractionID]
+	extractionsMutex.RUnlock()
+	if current != session {
+		session.mu.Unlock()
+		return nil
+	}
+	return session
+}
+
+// mayAccess reports whether this client may use an extraction or batch job
+// created by owner
+func (s *MCPServer) mayAccess(owner string) bool {
+	return owner == s.owner
+}
+
+// mayAdopt reports whether this client may take over an extraction or batch
+// job whose HTTP session no longer exists (server restart, expiry). Adoption
+// only happens when the client explicitly resumes it by ID.
+func (s *MCPServer) mayAdopt(owner string) bool {
+	return owner != s.owner && !httpSessionActive(owner)
+}
+
+// lockOwnExtraction is lockExtraction restricted to the extractions of this client
+func (s *MCPServer) lockOwnExtraction(extractionID string) *BulkTranslationSession {
+	session := lockExtraction(extractionID)
+	if session == nil {
+		return nil
+	}
+	if !s.mayAccess(session.Owner) {
+		session.mu.Unlock()
+		return nil
+	}
+	return session
+}
+
+// lockResumedExtraction is lockOwnExtraction for resume_extraction: orphaned
+// extractions are adopted by this client
+func (s *MCPServer) lockResumedExtraction(extractionID string) *BulkTranslationSession {
+	session := lockExtraction(extractionID)
+	if session == nil {
+		return nil
+	}
+	if s.mayAdopt(session.Owner) {
+		s.adoptSession(session)
+	}
+	if !s.mayAccess(session.Owner) {
+		session.mu.Unlock()
+		return nil
+	}
+	return session
+}
+
+// adoptSession makes this client the owner of a locked session
+func (s *MCPServer) adoptSession(session *BulkTranslationSession) {
+	s.log("Extraccion %s adoptada por la sesion '%s'", session.ExtractionID, s.owner)
+	session.Owner = s.owner
+	s.persistSession(session)
+}
+
+// ownExtractions returns the active extractions created by this client
+func (s *MCPServer) ownExtractions() []*BulkTranslationSession {
+	extractionsMutex.RLock()
+	var all []*BulkTranslationSession
+	for _, session := range activeExtractions {
+		all = append(all, session)
+	}
+	extractionsMutex.RUnlock()
+
+	var own []*BulkTranslationSession
+	for _, session := range all {
+		session.mu.Lock()
+		if session.Owner == s.owner {
+			own = append(own, session)
+		}
+		session.mu.Unlock()
+	}
+	return own
+}
+
 // generateExtractionID creates a unique ID for an extraction session
 func generateExtractionID() string {
 	bytes := make([]byte, 8)
@@ -144,18 +307,43 @@ type MCPServer struct {
 	session     *TranslationSession     // Estado de la sesion actual (legacy)
 	bulkSession *BulkTranslationSession // Estado de la sesion bulk (optimizado)
 	wpDB        *WordPressDB            // Conexion WordPress (lazy init)
-	shouldShutdown bool                 // Flag para graceful shutdown
+	tm          *TranslationMemory      // Memoria de traduccion (lazy init)
+	glossary    *Glossary               // Glosario terminologico (lazy init)
+
+	initMu   sync.Mutex // Guards the lazy init of wpDB, tm and glossary
+	legacyMu sync.Mutex // Serializes the legacy single-session tools
+	writeMu  sync.Mutex // One JSON-RPC message per line on stdout
+	logMu    sync.Mutex
+
+	calls      sync.WaitGroup // Tool calls in progress
+	inflightMu sync.Mutex
+	inflight   map[string]*inflightCall // Cancellable calls by request ID
+	stopping   bool                     // Shutdown requested: new tool calls are rejected
+	stopped    chan struct{}            // Closed once shutdown is answered (stdio)
+	callSlots  chan struct{}            // Limits concurrent tool calls (see slots)
+	slotsOnce  sync.Once
+
+	// HTTP clients get their own server sharing the parent's resources
+	parent *MCPServer
+	owner  string                // MCP session ID of the HTTP client ("" for stdio)
+	sink   func(JSONRPCResponse) // Delivers responses instead of writing to stdout
+	notify func(JSONRPCNotification)
+
+	logLevel string // Minimum level of notifications/message (logging/setLevel)
 }
 
 func NewMCPServer() *MCPServer {
 	return &MCPServer{
-		stdin:  os.Stdin,
-		stdout: os.Stdout,
-		stderr: os.Stderr,
+		stdin:     os.Stdin,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		callSlots: make(chan struct{}, maxConcurrentCalls()),
 	}
 }
 
 func (s *MCPServer) log(format string, args ...interface{}) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
 	fmt.Fprintf(s.stderr, "[MCP] "+format+"\n", args...)
 }
 
@@ -177,12 +365,66 @@ func (s *MCPServer) writeResponse(resp JSONRPCResponse) error {
 	if err != nil {
 		return err
 	}
+	// The client has given up on a cancelled request: it expects no response
+	if resp.ID != nil && s.isCancelled(resp.ID) {
+		s.log("Respuesta descartada: peticion %v cancelada", resp.ID)
+		return nil
+	}
+
+	if s.sink != nil {
+		s.sink(resp)
+		return nil
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err = fmt.Fprintf(s.stdout, "%s\n", data)
+	return err
+}
+
+// writeNotification sends a server notification: on stdout for stdio, on the
+// GET event stream for HTTP clients
+func (s *MCPServer) writeNotification(n JSONRPCNotification) error {
+	n.JSONRPC = "2.0"
+	if s.notify != nil {
+		s.notify(n)
+		return nil
+	}
+	if s.stdout == nil {
+		return nil
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	_, err = fmt.Fprintf(s.stdout, "%s\n", data)
 	return err
 }
 
+// writeToolText writes a tool result with a single text item
+func (s *MCPServer) writeToolText(req JSONRPCRequest, text string, isError bool) {
+	s.writeResponse(JSONRPCResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: CallToolResult{
+			Content: []ContentItem{{
+				Type: "text",
+				Text: text,
+			}},
+			IsError: isError,
+		},
+	})
+}
+
 // getWordPressDB returns the WordPress DB connection, initializing if needed
 func (s *MCPServer) getWordPressDB() (*WordPressDB, error) {
+	if s.parent != nil {
+		return s.parent.getWordPressDB()
+	}
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
 	if s.wpDB != nil {
 		return s.wpDB, nil
 	}
@@ -200,8 +442,9 @@ func (s *MCPServer) handleInitialize(req JSONRPCRequest) {
 		ProtocolVersion: MCP_PROTOCOL_VERSION,
 	}
 	result.Capabilities.Tools = map[string]interface{}{}
+	result.Capabilities.Logging = map[string]interface{}{}
 	result.ServerInfo.Name = "divi-translator"
-	result.ServerInfo.Version = "4.3.0"
+	result.ServerInfo.Version = SERVER_VERSION
 
 	s.writeResponse(JSONRPCResponse{
 		JSONRPC: "2.0",
@@ -227,123 +470,594 @@ func (s *MCPServer) handleListTools(req JSONRPCRequest) {
 						"type":        "string",
 						"description": "Ruta donde guardar el fichero traducido",
 					},
-					"targetLang": map[string]interface{}{
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino (es, en, fr, de, it, pt, etc.)",
+					},
+				},
+				"required": []string{"inputPath", "outputPath", "targetLang"},
+			},
+		},
+		// WordPress-based translation
+		{
+			Name:        "start_wordpress_translation",
+			Description: "Inicia la traduccion de un post de WordPress DESDE BASE DE DATOS. Lee el post, crea backup y devuelve el primer chunk. Al finalizar actualiza automaticamente la BD.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"postId": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID del post de WordPress a traducir",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino (es, en, fr, de, it, pt, etc.)",
+					},
+				},
+				"required": []string{"postId", "targetLang"},
+			},
+		},
+		// Common submit tool
+		{
+			Name:        "submit_translation",
+			Description: "Envia la traduccion del chunk actual. Devuelve el siguiente chunk, o confirma que se guardo (archivo o BD) si era el ultimo.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"translatedText": map[string]interface{}{
+						"type":        "string",
+						"description": "El texto traducido del chunk actual (solo el texto, sin marcadores)",
+					},
+				},
+				"required": []string{"translatedText"},
+			},
+		},
+		// Status tool
+		{
+			Name:        "get_translation_status",
+			Description: "Obtiene el estado de una extraccion bulk (con extractionId) o de la traduccion en progreso.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"extractionId": map[string]interface{}{
+						"type":        "string",
+						"description": "ID de la extraccion bulk (opcional)",
+					},
+				},
+			},
+		},
+		// ============ BULK TRANSLATION (OPTIMIZED) ============
+		// These tools minimize MCP calls: extract once, translate text, reassemble once
+		{
+			Name:        "extract_divi_text",
+			Description: "OPTIMIZADO: Extrae texto de archivo Divi. Devuelve extractionId y texto con marcadores {{CHUNK_XXX}}. Traduce el texto y usa submit_bulk_translation con el extractionId.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"inputPath": map[string]interface{}{
+						"type":        "string",
+						"description": "Ruta absoluta del archivo Divi a procesar",
+					},
+					"outputPath": map[string]interface{}{
+						"type":        "string",
+						"description": "Ruta donde guardar el archivo traducido final",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino (es, en, fr, de, etc.)",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma origen (opcional). Si no se indica se detecta a partir del texto (es, ca, en, fr, de, it, pt, nl)",
+					},
+				},
+				"required": []string{"inputPath", "outputPath", "targetLang"},
+			},
+		},
+		{
+			Name:        "extract_wordpress_text",
+			Description: "OPTIMIZADO: Extrae texto de post WordPress. Devuelve extractionId y texto con marcadores {{CHUNK_XXX}}. Incluye titulo, slug, extracto y los metadatos SEO (Yoast, Rank Math). Traduce el texto y usa submit_bulk_translation con el extractionId.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"postId": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID del post de WordPress",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino (es, en, fr, de, etc.)",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma origen (opcional). Si no se indica se detecta a partir del texto (es, ca, en, fr, de, it, pt, nl)",
+					},
+					"createCopy": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Guarda la traduccion como un post nuevo (clonando tipo, padre, orden, autor y postmeta) en lugar de sobrescribir el original. Con WPML o Polylang se vincula como traduccion, y si ya existe una traduccion a ese idioma se actualiza en su lugar",
+					},
+					"copyStatus": map[string]interface{}{
+						"type":        "string",
+						"description": "Estado del post nuevo cuando createCopy=true (por defecto: draft)",
+					},
+				},
+				"required": []string{"postId", "targetLang"},
+			},
+		},
+		{
+			Name:        "server_info",
+			Description: "Devuelve informacion del servidor: version, estado de conexion MySQL, configuracion activa y tools disponibles.",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "submit_bulk_translation",
+			Description: "Recibe extractionId y texto traducido (con marcadores {{CHUNK_XXX}}), valida la estructura (HTML, shortcodes, URLs, marcadores, numeros), reensambla y guarda el documento.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"extractionId": map[string]interface{}{
+						"type":        "string",
+						"description": "ID de extraccion devuelto por extract_divi_text o extract_wordpress_text",
+					},
+					"translatedText": map[string]interface{}{
+						"type":        "string",
+						"description": "El texto traducido completo, manteniendo los marcadores {{CHUNK_XXX}}...{{/CHUNK_XXX}}",
+					},
+					"force": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Guardar aunque la validacion estructural detecte errores fatales (por defecto false)",
+					},
+				},
+				"required": []string{"extractionId", "translatedText"},
+			},
+		},
+		// ============ TRANSLATION MEMORY ============
+		{
+			Name:        "tm_lookup",
+			Description: "Busca en la memoria de traduccion: coincidencia exacta de un texto (text) o listado de entradas filtradas (contains, idiomas).",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "Texto origen exacto a buscar",
+					},
+					"contains": map[string]interface{}{
+						"type":        "string",
+						"description": "Subcadena a buscar en origen o destino",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma origen (opcional)",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino (opcional)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Maximo de entradas a listar (por defecto 20)",
+					},
+				},
+			},
+		},
+		{
+			Name:        "tm_edit",
+			Description: "Corrige la traduccion guardada de una entrada de la memoria de traduccion.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"key": map[string]interface{}{
+						"type":        "string",
+						"description": "Clave de la entrada (devuelta por tm_lookup)",
+					},
+					"targetText": map[string]interface{}{
+						"type":        "string",
+						"description": "Nueva traduccion",
+					},
+				},
+				"required": []string{"key", "targetText"},
+			},
+		},
+		// ============ GLOSSARY ============
+		{
+			Name:        "glossary_import",
+			Description: "Importa un glosario CSV (term,translation[,note]; traduccion vacia = no traducir) o TBX para un par de idiomas.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Ruta absoluta del archivo .csv o .tbx",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma origen (obligatorio para TBX; vacio = cualquiera)",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino",
+					},
+				},
+				"required": []string{"path", "targetLang"},
+			},
+		},
+		{
+			Name:        "glossary_add",
+			Description: "Anade o reemplaza un termino del glosario (traduccion fija o no traducir).",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"term": map[string]interface{}{
+						"type":        "string",
+						"description": "Termino en el idioma origen",
+					},
+					"translation": map[string]interface{}{
+						"type":        "string",
+						"description": "Traduccion obligatoria (vacio = no traducir)",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma origen (vacio = cualquiera)",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Codigo de idioma destino",
+					},
+					"doNotTranslate": map[string]interface{}{
+						"type":        "boolean",
+						"description": "El termino debe quedar sin traducir (marcas, productos)",
+					},
+					"caseSensitive": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Distinguir mayusculas al buscar el termino",
+					},
+					"note": map[string]interface{}{
+						"type":        "string",
+						"description": "Nota para el traductor",
+					},
+				},
+				"required": []string{"term", "targetLang"},
+			},
+		},
+		{
+			Name:        "glossary_remove",
+			Description: "Elimina un termino del glosario.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"term": map[string]interface{}{
+						"type":        "string",
+						"description": "Termino a eliminar",
+					},
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Solo para este idioma origen (opcional)",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Solo para este idioma destino (opcional)",
+					},
+				},
+				"required": []string{"term"},
+			},
+		},
+		{
+			Name:        "list_extractions",
+			Description: "Lista las extracciones bulk activas (origen, idioma, parte pendiente, antiguedad), incluidas las restauradas tras reiniciar el servidor.",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "resume_extraction",
+			Description: "Reanuda una extraccion activa: devuelve de nuevo el texto de la parte pendiente para traducirla con submit_bulk_translation. Tambien recupera las extracciones de una sesion que ya no existe (reinicio del servidor o caducidad).",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"extractionId": map[string]interface{}{
+						"type":        "string",
+						"description": "ID de la extraccion (devuelto por list_extractions)",
+					},
+				},
+				"required": []string{"extractionId"},
+			},
+		},
+		{
+			Name:        "cancel_extraction",
+			Description: "Cancela una extraccion activa y descarta las partes recibidas. No modifica el archivo ni el post.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"extractionId": map[string]interface{}{
+						"type":        "string",
+						"description": "ID de la extraccion a cancelar",
+					},
+				},
+				"required": []string{"extractionId"},
+			},
+		},
+		{
+			Name:        "refresh_extraction",
+			Description: "Vuelve a extraer un post de WordPress que ha cambiado desde la extraccion (conflicto al guardar). Conserva la traduccion de los bloques sin cambios y devuelve solo los bloques nuevos o modificados.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"extractionId": map[string]interface{}{
+						"type":        "string",
+						"description": "ID de la extraccion en conflicto",
+					},
+				},
+				"required": []string{"extractionId"},
+			},
+		},
+		{
+			Name:        "list_backups",
+			Description: "Lista los backups guardados de un post de WordPress (mas recientes primero).",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"postId": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID del post de WordPress",
+					},
+				},
+				"required": []string{"postId"},
+			},
+		},
+		{
+			Name:        "show_backup",
+			Description: "Muestra el contenido de un backup o, con diff=true, sus diferencias con el post actual en la base de datos.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"backup": map[string]interface{}{
+						"type":        "string",
+						"description": "Nombre del archivo de backup (devuelto por list_backups)",
+					},
+					"diff": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Compara el backup con el contenido actual del post",
+					},
+				},
+				"required": []string{"backup"},
+			},
+		},
+		{
+			Name:        "restore_backup",
+			Description: "Restaura un backup en su post (titulo, slug, excerpt y contenido). Antes guarda un backup nuevo del estado actual.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"backup": map[string]interface{}{
+						"type":        "string",
+						"description": "Nombre del archivo de backup (devuelto por list_backups)",
+					},
+				},
+				"required": []string{"backup"},
+			},
+		},
+		{
+			Name:        "prune_backups",
+			Description: "Borra los backups que superan la politica de retencion (edad, numero por post, tamano total). Por defecto es una simulacion (dryRun=true) que solo lista lo que se borraria. Siempre se conserva el backup mas reciente de cada post.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"dryRun": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Solo listar sin borrar (por defecto: true)",
+					},
+					"maxAgeDays": map[string]interface{}{
+						"type":        "number",
+						"description": "Edad maxima en dias (por defecto: WP_BACKUP_MAX_AGE)",
+					},
+					"maxPerPost": map[string]interface{}{
+						"type":        "integer",
+						"description": "Numero maximo de backups por post (por defecto: WP_BACKUP_MAX_PER_POST)",
+					},
+					"maxTotalSize": map[string]interface{}{
+						"type":        "string",
+						"description": "Tamano total maximo, ej: 500MB (por defecto: WP_BACKUP_MAX_TOTAL_SIZE)",
+					},
+				},
+			},
+		},
+		{
+			Name:        "list_post_translations",
+			Description: "Lista las traducciones de un post registradas en el plugin multilingue (WPML o Polylang): idioma, ID, titulo y estado de cada version.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"postId": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID del post (original o cualquiera de sus traducciones)",
+					},
+				},
+				"required": []string{"postId"},
+			},
+		},
+		{
+			Name:        "list_divi_layouts",
+			Description: "Lista las plantillas del Theme Builder de Divi (con su header, body y footer) y los elementos de la Biblioteca de Divi, indicando los modulos globales y cuantos posts los usan. Cada layout se traduce con extract_wordpress_text usando su ID.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"type": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"all", "theme_builder", "library"},
+						"description": "Que listar (por defecto: all)",
+					},
+				},
+			},
+		},
+		{
+			Name:        "create_batch_job",
+			Description: "Crea un lote para traducir varios posts de WordPress. Acepta una lista de IDs o filtros (tipo, estado, categoria, fechas). Despues usa batch_next_extraction para ir obteniendo cada extraccion.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"postIds": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "integer"},
+						"description": "IDs de los posts a traducir (si se indica, se ignoran los filtros)",
+					},
+					"postType": map[string]interface{}{
+						"type":        "string",
+						"description": "Tipo de post, o varios separados por comas (por defecto: post,page). 'divi_layouts' incluye los layouts del Theme Builder y la Biblioteca de Divi",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "Estado del post (por defecto: publish; 'any' para todos)",
+					},
+					"category": map[string]interface{}{
+						"type":        "string",
+						"description": "Slug o ID de la categoria",
+					},
+					"dateFrom": map[string]interface{}{
+						"type":        "string",
+						"description": "Fecha de publicacion minima (YYYY-MM-DD)",
+					},
+					"dateTo": map[string]interface{}{
+						"type":        "string",
+						"description": "Fecha de publicacion maxima (YYYY-MM-DD)",
+					},
+					"modifiedSince": map[string]interface{}{
+						"type":        "string",
+						"description": "Solo posts modificados desde esta fecha (YYYY-MM-DD)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Numero maximo de posts",
+					},
+					"createCopy": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Crea un post nuevo por cada traduccion en lugar de sobrescribir los originales",
+					},
+					"copyStatus": map[string]interface{}{
+						"type":        "string",
+						"description": "Estado de los posts nuevos cuando createCopy=true (por defecto: draft)",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Idioma destino (ej: en, fr, de)",
+					},
+					"sourceLang": map[string]interface{}{
 						"type":        "string",
-						"description": "Codigo de idioma destino (es, en, fr, de, it, pt, etc.)",
+						"description": "Idioma origen de todos los posts (opcional). Si no se indica se detecta en cada post",
 					},
 				},
-				"required": []string{"inputPath", "outputPath", "targetLang"},
+				"required": []string{"targetLang"},
 			},
 		},
-		// WordPress-based translation
 		{
-			Name:        "start_wordpress_translation",
-			Description: "Inicia la traduccion de un post de WordPress DESDE BASE DE DATOS. Lee el post, crea backup y devuelve el primer chunk. Al finalizar actualiza automaticamente la BD.",
+			Name:        "batch_next_extraction",
+			Description: "Devuelve la extraccion del siguiente post pendiente del lote (o reenvia la que esta en curso). Traducela con submit_bulk_translation y vuelve a llamar hasta que el lote finalice.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"postId": map[string]interface{}{
-						"type":        "integer",
-						"description": "ID del post de WordPress a traducir",
-					},
-					"targetLang": map[string]interface{}{
+					"jobId": map[string]interface{}{
 						"type":        "string",
-						"description": "Codigo de idioma destino (es, en, fr, de, it, pt, etc.)",
+						"description": "ID del lote devuelto por create_batch_job",
+					},
+					"skipCurrent": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Omite el post en curso y pasa al siguiente",
 					},
 				},
-				"required": []string{"postId", "targetLang"},
+				"required": []string{"jobId"},
 			},
 		},
-		// Common submit tool
 		{
-			Name:        "submit_translation",
-			Description: "Envia la traduccion del chunk actual. Devuelve el siguiente chunk, o confirma que se guardo (archivo o BD) si era el ultimo.",
+			Name:        "batch_status",
+			Description: "Muestra el progreso de un lote (exitos, fallos, omitidos y pendientes) o lista todos los lotes.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"translatedText": map[string]interface{}{
+					"jobId": map[string]interface{}{
 						"type":        "string",
-						"description": "El texto traducido del chunk actual (solo el texto, sin marcadores)",
+						"description": "ID del lote (opcional, sin el lista todos)",
 					},
 				},
-				"required": []string{"translatedText"},
-			},
-		},
-		// Status tool
-		{
-			Name:        "get_translation_status",
-			Description: "Obtiene el estado actual de la traduccion en progreso.",
-			InputSchema: map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
 			},
 		},
-		// ============ BULK TRANSLATION (OPTIMIZED) ============
-		// These tools minimize MCP calls: extract once, translate text, reassemble once
 		{
-			Name:        "extract_divi_text",
-			Description: "OPTIMIZADO: Extrae texto de archivo Divi. Devuelve extractionId y texto con marcadores {{CHUNK_XXX}}. Traduce el texto y usa submit_bulk_translation con el extractionId.",
+			Name:        "machine_translate",
+			Description: "Traduce en el servidor con un proveedor de traduccion automatica (DeepL, Google, OpenAI compatible o LibreTranslate) todas las partes pendientes de una extraccion, o todos los posts de un lote, y guarda el resultado igual que submit_bulk_translation.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"inputPath": map[string]interface{}{
+					"extractionId": map[string]interface{}{
 						"type":        "string",
-						"description": "Ruta absoluta del archivo Divi a procesar",
+						"description": "ID de la extraccion a traducir",
 					},
-					"outputPath": map[string]interface{}{
+					"jobId": map[string]interface{}{
 						"type":        "string",
-						"description": "Ruta donde guardar el archivo traducido final",
+						"description": "ID del lote a traducir completo (en lugar de extractionId)",
 					},
-					"targetLang": map[string]interface{}{
+					"provider": map[string]interface{}{
 						"type":        "string",
-						"description": "Codigo de idioma destino (es, en, fr, de, etc.)",
+						"enum":        []string{"deepl", "google", "openai", "libretranslate"},
+						"description": "Proveedor (por defecto MT_PROVIDER)",
+					},
+					"force": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Guardar aunque la validacion detecte errores fatales",
 					},
 				},
-				"required": []string{"inputPath", "outputPath", "targetLang"},
 			},
 		},
 		{
-			Name:        "extract_wordpress_text",
-			Description: "OPTIMIZADO: Extrae texto de post WordPress. Devuelve extractionId y texto con marcadores {{CHUNK_XXX}}. Traduce el texto y usa submit_bulk_translation con el extractionId.",
+			Name:        "glossary_list",
+			Description: "Lista los terminos del glosario, opcionalmente filtrados por par de idiomas.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"postId": map[string]interface{}{
-						"type":        "integer",
-						"description": "ID del post de WordPress",
+					"sourceLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Filtrar por idioma origen",
 					},
 					"targetLang": map[string]interface{}{
 						"type":        "string",
-						"description": "Codigo de idioma destino (es, en, fr, de, etc.)",
+						"description": "Filtrar por idioma destino",
 					},
 				},
-				"required": []string{"postId", "targetLang"},
 			},
 		},
 		{
-			Name:        "server_info",
-			Description: "Devuelve informacion del servidor: version, estado de conexion MySQL, configuracion activa y tools disponibles.",
-			InputSchema: map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
-			},
-		},
-		{
-			Name:        "submit_bulk_translation",
-			Description: "Recibe extractionId y texto traducido (con marcadores {{CHUNK_XXX}}), reensambla y guarda el documento.",
+			Name:        "tm_purge",
+			Description: "Elimina entradas de la memoria de traduccion por clave, idioma, texto o antiguedad.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"extractionId": map[string]interface{}{
+					"key": map[string]interface{}{
 						"type":        "string",
-						"description": "ID de extraccion devuelto por extract_divi_text o extract_wordpress_text",
+						"description": "Clave de una entrada concreta",
 					},
-					"translatedText": map[string]interface{}{
+					"sourceLang": map[string]interface{}{
 						"type":        "string",
-						"description": "El texto traducido completo, manteniendo los marcadores {{CHUNK_XXX}}...{{/CHUNK_XXX}}",
+						"description": "Eliminar entradas de este idioma origen",
+					},
+					"targetLang": map[string]interface{}{
+						"type":        "string",
+						"description": "Eliminar entradas de este idioma destino",
+					},
+					"contains": map[string]interface{}{
+						"type":        "string",
+						"description": "Eliminar entradas cuyo origen o destino contenga este texto",
+					},
+					"olderThanDays": map[string]interface{}{
+						"type":        "integer",
+						"description": "Eliminar entradas no actualizadas en este numero de dias",
+					},
+					"all": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Vaciar toda la memoria de traduccion",
 					},
 				},
-				"required": []string{"extractionId", "translatedText"},
 			},
 		},
 	}
@@ -369,6 +1083,13 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		return
 	}
 
+	// The legacy tools share a single session per server
+	switch params.Name {
+	case "start_divi_translation", "start_wordpress_translation", "submit_translation", "get_translation_status":
+		s.legacyMu.Lock()
+		defer s.legacyMu.Unlock()
+	}
+
 	switch params.Name {
 	case "start_divi_translation":
 		s.handleStartTranslation(req, params)
@@ -377,7 +1098,7 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 	case "submit_translation":
 		s.handleSubmitTranslation(req, params)
 	case "get_translation_status":
-		s.handleGetStatus(req)
+		s.handleGetStatus(req, params)
 	// Bulk translation (optimized)
 	case "extract_divi_text":
 		s.handleExtractDiviText(req, params)
@@ -387,6 +1108,56 @@ func (s *MCPServer) handleCallTool(req JSONRPCRequest) {
 		s.handleSubmitBulkTranslation(req, params)
 	case "server_info":
 		s.handleServerInfo(req)
+	// Translation memory
+	case "tm_lookup":
+		s.handleTMLookup(req, params)
+	case "tm_edit":
+		s.handleTMEdit(req, params)
+	case "tm_purge":
+		s.handleTMPurge(req, params)
+	// Glossary
+	case "glossary_import":
+		s.handleGlossaryImport(req, params)
+	case "glossary_add":
+		s.handleGlossaryAdd(req, params)
+	case "glossary_remove":
+		s.handleGlossaryRemove(req, params)
+	case "glossary_list":
+		s.handleGlossaryList(req, params)
+	// Persisted sessions
+	case "list_extractions":
+		s.handleListExtractions(req, params)
+	case "resume_extraction":
+		s.handleResumeExtraction(req, params)
+	case "cancel_extraction":
+		s.handleCancelExtraction(req, params)
+	case "refresh_extraction":
+		s.handleRefreshExtraction(req, params)
+	// Backups
+	case "list_backups":
+		s.handleListBackups(req, params)
+	case "show_backup":
+		s.handleShowBackup(req, params)
+	case "restore_backup":
+		s.handleRestoreBackup(req, params)
+	case "prune_backups":
+		s.handlePruneBackups(req, params)
+	// Multilingual plugins
+	case "list_post_translations":
+		s.handleListPostTranslations(req, params)
+	// Divi layouts
+	case "list_divi_layouts":
+		s.handleListDiviLayouts(req, params)
+	// Batch jobs
+	case "create_batch_job":
+		s.handleCreateBatchJob(req, params)
+	case "batch_next_extraction":
+		s.handleBatchNextExtraction(req, params)
+	case "batch_status":
+		s.handleBatchStatus(req, params)
+	// Machine translation
+	case "machine_translate":
+		s.handleMachineTranslate(req, params)
 	default:
 		s.writeResponse(JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -800,7 +1571,7 @@ func (s *MCPServer) saveToWordPress() string {
 		return fmt.Sprintf("ERROR conectando a WordPress: %v", err)
 	}
 
-	err = wpDB.UpdatePostContent(s.session.PostID, result)
+	_, err = wpDB.UpdatePostContent(s.session.PostID, result)
 	if err != nil {
 		return fmt.Sprintf("ERROR actualizando post: %v", err)
 	}
@@ -834,6 +1605,7 @@ func (s *MCPServer) handleExtractDiviText(req JSONRPCRequest, params CallToolPar
 	inputPath, _ := params.Arguments["inputPath"].(string)
 	outputPath, _ := params.Arguments["outputPath"].(string)
 	targetLang, _ := params.Arguments["targetLang"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
 
 	if inputPath == "" || outputPath == "" || targetLang == "" {
 		s.writeResponse(JSONRPCResponse{
@@ -850,6 +1622,11 @@ func (s *MCPServer) handleExtractDiviText(req JSONRPCRequest, params CallToolPar
 		return
 	}
 
+	if err := checkLanguagePair(sourceLang, targetLang); err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
 	// Read file
 	data, err := os.ReadFile(inputPath)
 	if err != nil {
@@ -867,7 +1644,7 @@ func (s *MCPServer) handleExtractDiviText(req JSONRPCRequest, params CallToolPar
 		return
 	}
 
-	session := s.initBulkSessionWithID(string(data), targetLang, "file", inputPath, outputPath, 0, "")
+	session := s.initBulkSessionWithID(string(data), sourceLang, targetLang, "file", inputPath, outputPath, 0, "")
 
 	if session == nil {
 		s.writeResponse(JSONRPCResponse{
@@ -884,6 +1661,8 @@ func (s *MCPServer) handleExtractDiviText(req JSONRPCRequest, params CallToolPar
 		return
 	}
 
+	s.publishSession(session)
+	s.persistSession(session)
 	s.log("Sesion bulk archivo iniciada: ID=%s, %d chunks, %d partes", session.ExtractionID, session.TotalChunks, session.Parts)
 
 	// Generate and return extraction response with ID
@@ -904,6 +1683,7 @@ func (s *MCPServer) handleExtractWordPressText(req JSONRPCRequest, params CallTo
 	postIDFloat, _ := params.Arguments["postId"].(float64)
 	postID := int64(postIDFloat)
 	targetLang, _ := params.Arguments["targetLang"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
 
 	if postID == 0 || targetLang == "" {
 		s.writeResponse(JSONRPCResponse{
@@ -920,42 +1700,12 @@ func (s *MCPServer) handleExtractWordPressText(req JSONRPCRequest, params CallTo
 		return
 	}
 
-	// Get WordPress DB connection
-	wpDB, err := s.getWordPressDB()
-	if err != nil {
-		s.writeResponse(JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: CallToolResult{
-				Content: []ContentItem{{
-					Type: "text",
-					Text: fmt.Sprintf("ERROR conectando a WordPress: %v", err),
-				}},
-				IsError: true,
-			},
-		})
-		return
-	}
-
-	// Read post
-	post, err := wpDB.GetPost(postID)
-	if err != nil {
-		s.writeResponse(JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: CallToolResult{
-				Content: []ContentItem{{
-					Type: "text",
-					Text: fmt.Sprintf("ERROR leyendo post: %v", err),
-				}},
-				IsError: true,
-			},
-		})
+	if err := checkLanguagePair(sourceLang, targetLang); err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
 		return
 	}
 
-	// Create full backup (includes title, slug, excerpt, content)
-	backupPath, err := wpDB.SaveFullBackup(post, targetLang)
+	session, err := s.extractWordPressPost(postID, sourceLang, targetLang)
 	if err != nil {
 		s.writeResponse(JSONRPCResponse{
 			JSONRPC: "2.0",
@@ -963,24 +1713,7 @@ func (s *MCPServer) handleExtractWordPressText(req JSONRPCRequest, params CallTo
 			Result: CallToolResult{
 				Content: []ContentItem{{
 					Type: "text",
-					Text: fmt.Sprintf("ERROR creando backup: %v", err),
-				}},
-				IsError: true,
-			},
-		})
-		return
-	}
-
-	session := s.initBulkSessionWithID(post.PostContent, targetLang, "wordpress", "", "", postID, backupPath)
-
-	if session == nil {
-		s.writeResponse(JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: CallToolResult{
-				Content: []ContentItem{{
-					Type: "text",
-					Text: "El post no contiene texto Divi para traducir.",
+					Text: extractErrorText(err),
 				}},
 				IsError: true,
 			},
@@ -988,15 +1721,16 @@ func (s *MCPServer) handleExtractWordPressText(req JSONRPCRequest, params CallTo
 		return
 	}
 
-	// Store original metadata for translation
-	session.OriginalTitle = post.PostTitle
-	session.OriginalSlug = post.PostName
-	session.OriginalExcerpt = post.PostExcerpt
+	session.mu.Lock()
+	session.CreateCopy, _ = params.Arguments["createCopy"].(bool)
+	session.CopyStatus, _ = params.Arguments["copyStatus"].(string)
+	s.persistSession(session)
 
 	s.log("Sesion bulk WordPress iniciada: ID=%s, Post %d, %d chunks, %d partes", session.ExtractionID, postID, session.TotalChunks, session.Parts)
 
 	// Generate and return extraction response with ID (includes metadata)
 	response := s.generateBulkExtractResponseWithID(session)
+	session.mu.Unlock()
 	s.writeResponse(JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
@@ -1009,14 +1743,70 @@ func (s *MCPServer) handleExtractWordPressText(req JSONRPCRequest, params CallTo
 	})
 }
 
+// errNoTranslatableText is returned when a document has no text to translate
+var errNoTranslatableText = errors.New("El post no contiene texto Divi para traducir.")
+
+// extractErrorText formats an extraction error for a tool response
+func extractErrorText(err error) string {
+	if err == errNoTranslatableText {
+		return err.Error()
+	}
+	return fmt.Sprintf("ERROR %v", err)
+}
+
+// extractWordPressPost reads a post, saves a full backup and opens a bulk
+// session for it, with the original title, slug and excerpt attached. An
+// empty sourceLang is detected from the content.
+func (s *MCPServer) extractWordPressPost(postID int64, sourceLang, targetLang string) (*BulkTranslationSession, error) {
+	// Get WordPress DB connection
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		return nil, fmt.Errorf("conectando a WordPress: %v", err)
+	}
+
+	// Read post
+	post, err := wpDB.GetPost(postID)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo post: %v", err)
+	}
+
+	session := s.initBulkSessionWithID(post.PostContent, sourceLang, targetLang, "wordpress", "", "", postID, "")
+	if session == nil {
+		return nil, errNoTranslatableText
+	}
+
+	// Create full backup (all fields and postmeta), tagged with the extraction
+	session.BackupPath, err = wpDB.SaveFullBackup(post, session.SourceLang, targetLang, session.ExtractionID)
+	if err != nil {
+		return nil, fmt.Errorf("creando backup: %v", err)
+	}
+
+	// Store original metadata for translation
+	session.OriginalVersion = VersionOf(post)
+	session.OriginalTitle = post.PostTitle
+	session.OriginalSlug = post.PostName
+	session.OriginalExcerpt = post.PostExcerpt
+	session.SEOMeta, err = wpDB.GetSEOMeta(postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordSibling(wpDB, session); err != nil {
+		return nil, err
+	}
+
+	s.publishSession(session)
+	return session, nil
+}
+
 func (s *MCPServer) initBulkSession(content, targetLang, sourceType, inputPath, outputPath string, postID int64, backupPath string) {
-	// Tokenize
-	tokens := tokenize(content)
+	// Parse shortcode tree and flatten it into tokens
+	doc := parseShortcodeDocument(content)
+	tokens := doc.Tokens()
 
-	// Extract text chunk indices
+	// Extract text and translatable attribute chunk indices
 	var chunkIndices []int
 	for i, t := range tokens {
-		if t.Kind == "text" && strings.TrimSpace(t.Value) != "" {
+		if isTranslatableToken(t) {
 			chunkIndices = append(chunkIndices, i)
 		}
 	}
@@ -1059,6 +1849,7 @@ func (s *MCPServer) initBulkSession(content, targetLang, sourceType, inputPath,
 		PostID:       postID,
 		BackupPath:   backupPath,
 		TargetLang:   targetLang,
+		Document:     doc,
 		Tokens:       tokens,
 		ChunkIndices: chunkIndices,
 		TotalChunks:  len(chunkIndices),
@@ -1069,27 +1860,14 @@ func (s *MCPServer) initBulkSession(content, targetLang, sourceType, inputPath,
 	}
 }
 
-// initBulkSessionWithID creates a new bulk session with a unique ID and stores it globally
-func (s *MCPServer) initBulkSessionWithID(content, targetLang, sourceType, inputPath, outputPath string, postID int64, backupPath string) *BulkTranslationSession {
-	// Tokenize
-	tokens := tokenize(content)
-
-	// Extract text chunk indices
-	var chunkIndices []int
-	for i, t := range tokens {
-		if t.Kind == "text" && strings.TrimSpace(t.Value) != "" {
-			chunkIndices = append(chunkIndices, i)
-		}
-	}
-
-	if len(chunkIndices) == 0 {
-		return nil
-	}
-
-	// Calculate total text length to determine parts
+// splitIntoParts divides the chunks into 1, 2 or 3 parts by the length of the
+// text to send (reused chunks are not sent) and returns the part ranges
+func splitIntoParts(tokens []Token, chunkIndices []int, prefilled []bool) (int, [][2]int) {
 	totalLen := 0
-	for _, idx := range chunkIndices {
-		totalLen += len(tokens[idx].Value)
+	for i, idx := range chunkIndices {
+		if !prefilled[i] {
+			totalLen += len(tokens[idx].Value)
+		}
 	}
 
 	// Determine number of parts (1, 2, or 3)
@@ -1111,31 +1889,73 @@ func (s *MCPServer) initBulkSessionWithID(content, targetLang, sourceType, input
 		}
 		partRanges[p] = [2]int{start, end}
 	}
+	return parts, partRanges
+}
+
+// initBulkSessionWithID creates a new bulk session with a unique ID and stores it globally
+// An empty sourceLang is detected from the text of the chunks.
+func (s *MCPServer) initBulkSessionWithID(content, sourceLang, targetLang, sourceType, inputPath, outputPath string, postID int64, backupPath string) *BulkTranslationSession {
+	// Parse shortcode tree and flatten it into tokens
+	doc := parseShortcodeDocument(content)
+	tokens := doc.Tokens()
+
+	// Extract text and translatable attribute chunk indices. Global modules
+	// of a WordPress post are translated in the Divi Library instead.
+	skipGlobal := sourceType == "wordpress"
+	chunkIndices, globalModules := translatableChunks(tokens, skipGlobal, postID)
+
+	if len(chunkIndices) == 0 {
+		return nil
+	}
+
+	// Detect the source language when not given; a doubtful result is
+	// reported but not used, so the TM and translators treat it as unknown
+	sourceLang = normalizeLangCode(sourceLang)
+	var detected LangDetection
+	if sourceLang == "" {
+		detected = detectChunksLanguage(tokens, chunkIndices)
+		if detected.Lang != "" && detected.Confidence >= minDetectConfidence {
+			sourceLang = detected.Lang
+		}
+	}
+
+	// Reuse exact matches from the translation memory
+	translations, prefilled, tmHits := s.prefillFromTranslationMemory(tokens, chunkIndices, sourceLang, targetLang)
+
+	parts, partRanges := splitIntoParts(tokens, chunkIndices, prefilled)
 
 	// Generate unique ID
 	extractionID := generateExtractionID()
 
 	session := &BulkTranslationSession{
-		ExtractionID: extractionID,
-		SourceType:   sourceType,
-		InputPath:    inputPath,
-		OutputPath:   outputPath,
-		PostID:       postID,
-		BackupPath:   backupPath,
-		TargetLang:   targetLang,
-		Tokens:       tokens,
-		ChunkIndices: chunkIndices,
-		TotalChunks:  len(chunkIndices),
-		Parts:        parts,
-		CurrentPart:  0,
-		PartRanges:   partRanges,
-		Translations: make([]string, len(chunkIndices)),
-	}
-
-	// Store in global map
-	extractionsMutex.Lock()
-	activeExtractions[extractionID] = session
-	extractionsMutex.Unlock()
+		ExtractionID:       extractionID,
+		SourceType:         sourceType,
+		InputPath:          inputPath,
+		OutputPath:         outputPath,
+		PostID:             postID,
+		BackupPath:         backupPath,
+		SourceLang:         sourceLang,
+		TargetLang:         targetLang,
+		DetectedLang:       detected.Lang,
+		DetectedConfidence: detected.Confidence,
+		Document:           doc,
+		Tokens:             tokens,
+		ChunkIndices:       chunkIndices,
+		TotalChunks:        len(chunkIndices),
+		Parts:              parts,
+		CurrentPart:        0,
+		PartRanges:         partRanges,
+		Translations:       translations,
+		Prefilled:          prefilled,
+		TMHits:             tmHits,
+		SkipGlobalModules:  skipGlobal,
+		GlobalModules:      globalModules,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+
+	// Attach similar translations as hints for the remaining chunks
+	s.suggestFromTranslationMemory(session)
 
 	return session
 }
@@ -1189,8 +2009,7 @@ TEXTO A TRADUCIR (PARTE %d):
 	// Generate text blocks with markers
 	for i := partRange[0]; i < partRange[1]; i++ {
 		chunkIdx := session.ChunkIndices[i]
-		text := session.Tokens[chunkIdx].Value
-		builder.WriteString(fmt.Sprintf("\n{{CHUNK_%03d}}\n%s\n{{/CHUNK_%03d}}\n", i+1, text, i+1))
+		builder.WriteString(formatChunkBlock(i+1, session.Tokens[chunkIdx], nil))
 	}
 
 	return builder.String()
@@ -1214,8 +2033,26 @@ func truncateForDisplay(s string, maxLen int) string {
 	return s[:maxLen-3] + "..."
 }
 
+// formatChunkBlock renders one {{CHUNK_XXX}} block. Hints go outside the
+// markers: attribute chunks say where the text lives and fuzzy translation
+// memory matches show the previous translation of a similar text.
+func formatChunkBlock(n int, t Token, fuzzy *TMMatch) string {
+	hint := ""
+	if t.Kind == "attr" {
+		hint = fmt.Sprintf("\n(atributo %s de %s: solo texto plano, sin HTML)", t.Attr, t.Module)
+	}
+	if fuzzy != nil {
+		hint += fmt.Sprintf("\n(traduccion previa, %.0f%% de coincidencia - usala como referencia de estilo y terminologia:\n%s\n)",
+			fuzzy.Score*100, fuzzy.Entry.TargetText)
+	}
+	return fmt.Sprintf("%s\n{{CHUNK_%03d}}\n%s\n{{/CHUNK_%03d}}\n", hint, n, tokenText(t), n)
+}
+
 func (s *MCPServer) getSourceDescriptionForSession(session *BulkTranslationSession) string {
 	if session.SourceType == "wordpress" {
+		if session.CreateCopy {
+			return fmt.Sprintf("WordPress Post ID %d (se guardara como post nuevo)", session.PostID)
+		}
 		return fmt.Sprintf("WordPress Post ID %d", session.PostID)
 	}
 	return session.InputPath
@@ -1233,35 +2070,81 @@ func (s *MCPServer) generateBulkExtractResponseWithID(session *BulkTranslationSe
 =====================
 extractionId: %s
 Origen: %s
+Idioma origen: %s
 Idioma destino: %s
 Total de bloques: %d
 
 INSTRUCCIONES:
-1. Traduce TODO el texto a %s
+1. Traduce TODO el texto %s
 2. CONSERVA los marcadores {{CHUNK_XXX}} y {{/CHUNK_XXX}} exactamente igual
 3. NO traduzcas atributos HTML (class, style, href, src, id, data-*)
 4. SI traduce atributos "title" y "alt"
 5. Conserva la estructura HTML y saltos de linea
 6. Usa "submit_bulk_translation" con extractionId="%s" y el texto traducido
-`, session.ExtractionID, s.getSourceDescriptionForSession(session), session.TargetLang, session.TotalChunks,
-   session.TargetLang, session.ExtractionID))
+`, session.ExtractionID, s.getSourceDescriptionForSession(session), describeSourceLang(session), session.TargetLang, session.TotalChunks,
+			translationDirection(session), session.ExtractionID))
 	} else {
 		builder.WriteString(fmt.Sprintf(`EXTRACCION COMPLETADA - PARTE %d de %d
 ======================================
 extractionId: %s
 Origen: %s
+Idioma origen: %s
 Idioma destino: %s
 Bloques en esta parte: %d-%d de %d total
 
 INSTRUCCIONES:
-1. Traduce TODO el texto a %s
+1. Traduce TODO el texto %s
 2. CONSERVA los marcadores {{CHUNK_XXX}} y {{/CHUNK_XXX}} exactamente igual
 3. NO traduzcas atributos HTML (class, style, href, src, id, data-*)
 4. SI traduce atributos "title" y "alt"
 5. Conserva la estructura HTML y saltos de linea
 6. Usa "submit_bulk_translation" con extractionId="%s" y el texto traducido
-`, session.CurrentPart+1, session.Parts, session.ExtractionID, s.getSourceDescriptionForSession(session), session.TargetLang,
-			partRange[0]+1, partRange[1], session.TotalChunks, session.TargetLang, session.ExtractionID))
+`, session.CurrentPart+1, session.Parts, session.ExtractionID, s.getSourceDescriptionForSession(session), describeSourceLang(session), session.TargetLang,
+			partRange[0]+1, partRange[1], session.TotalChunks, translationDirection(session), session.ExtractionID))
+	}
+
+	if session.CurrentPart == 0 {
+		builder.WriteString(sameLanguageWarning(session))
+		builder.WriteString(formatGlobalModules(session.GlobalModules))
+		if session.CreateCopy && len(session.GlobalModules) > 0 {
+			builder.WriteString(fmt.Sprintf("Al guardar la copia, cada modulo global se enlaza a su traduccion '%s' de la Biblioteca si existe.\n", session.TargetLang))
+		}
+	}
+
+	// Glossary terms that occur in the text of this part
+	builder.WriteString(formatGlossaryInstructions(s.glossaryTermsForPart(session)))
+
+	if session.KeptChunks > 0 && session.CurrentPart == 0 {
+		builder.WriteString(fmt.Sprintf("\nBloques sin cambios desde la extraccion anterior: %d de %d (se conserva su traduccion, no se incluyen abajo)\n", session.KeptChunks, session.TotalChunks))
+	}
+	if session.TMHits > 0 && session.CurrentPart == 0 {
+		builder.WriteString(fmt.Sprintf("\nBloques reutilizados de la memoria de traduccion: %d de %d (no se incluyen abajo)\n", session.TMHits, session.TotalChunks))
+	}
+	if session.FuzzyHits > 0 && session.CurrentPart == 0 {
+		builder.WriteString(fmt.Sprintf("Bloques con traduccion previa similar: %d (ver sugerencias junto a cada bloque)\n", session.FuzzyHits))
+	}
+	if session.pendingInPart(session.CurrentPart) == 0 && session.KeptChunks > 0 {
+		builder.WriteString(`
+Todos los bloques de esta parte ya tienen traduccion (extraccion anterior o memoria de traduccion).
+Envia submit_bulk_translation con translatedText="OK" (y los metadatos traducidos si los hay).
+`)
+	} else if session.pendingInPart(session.CurrentPart) == 0 {
+		builder.WriteString(`
+Todos los bloques de esta parte vienen de la memoria de traduccion.
+Envia submit_bulk_translation con translatedText="OK" (y los metadatos traducidos si los hay).
+`)
+	}
+
+	// Report unbalanced shortcodes found while parsing (first part only)
+	if session.CurrentPart == 0 && session.Document != nil && len(session.Document.Errors) > 0 {
+		builder.WriteString("\nADVERTENCIAS DE ESTRUCTURA (el documento original tiene shortcodes desbalanceados):\n")
+		for i, e := range session.Document.Errors {
+			if i == 10 {
+				builder.WriteString(fmt.Sprintf("- ... y %d mas\n", len(session.Document.Errors)-10))
+				break
+			}
+			builder.WriteString(fmt.Sprintf("- %s\n", e.String()))
+		}
 	}
 
 	// Add WordPress metadata section for first part only
@@ -1283,6 +2166,7 @@ METADATOS DEL POST (traducir tambien):
 {{/POST_EXCERPT}}
 
 `, session.OriginalTitle, session.OriginalSlug, session.OriginalExcerpt))
+		builder.WriteString(formatSEOMetaSection(session.SEOMeta))
 	}
 
 	// Content section header
@@ -1298,9 +2182,15 @@ METADATOS DEL POST (traducir tambien):
 
 	// Generate text blocks with markers
 	for i := partRange[0]; i < partRange[1]; i++ {
+		if session.isPrefilled(i) {
+			continue
+		}
 		chunkIdx := session.ChunkIndices[i]
-		text := session.Tokens[chunkIdx].Value
-		builder.WriteString(fmt.Sprintf("\n{{CHUNK_%03d}}\n%s\n{{/CHUNK_%03d}}\n", i+1, text, i+1))
+		var fuzzy *TMMatch
+		if i < len(session.FuzzyMatches) {
+			fuzzy = session.FuzzyMatches[i]
+		}
+		builder.WriteString(formatChunkBlock(i+1, session.Tokens[chunkIdx], fuzzy))
 	}
 
 	return builder.String()
@@ -1309,6 +2199,7 @@ METADATOS DEL POST (traducir tambien):
 func (s *MCPServer) handleSubmitBulkTranslation(req JSONRPCRequest, params CallToolParams) {
 	extractionId, _ := params.Arguments["extractionId"].(string)
 	translatedText, _ := params.Arguments["translatedText"].(string)
+	force, _ := params.Arguments["force"].(bool)
 
 	if extractionId == "" {
 		s.writeResponse(JSONRPCResponse{
@@ -1323,36 +2214,16 @@ func (s *MCPServer) handleSubmitBulkTranslation(req JSONRPCRequest, params CallT
 			},
 		})
 		return
-	}
-
-	if translatedText == "" {
-		s.writeResponse(JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: CallToolResult{
-				Content: []ContentItem{{
-					Type: "text",
-					Text: "ERROR: translatedText es obligatorio",
-				}},
-				IsError: true,
-			},
-		})
-		return
-	}
-
-	// Get session by extractionId
-	extractionsMutex.RLock()
-	session, exists := activeExtractions[extractionId]
-	extractionsMutex.RUnlock()
+	}
 
-	if !exists {
+	if translatedText == "" {
 		s.writeResponse(JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
 			Result: CallToolResult{
 				Content: []ContentItem{{
 					Type: "text",
-					Text: fmt.Sprintf("ERROR: extractionId '%s' no encontrado. Usa extract_divi_text o extract_wordpress_text primero.", extractionId),
+					Text: "ERROR: translatedText es obligatorio",
 				}},
 				IsError: true,
 			},
@@ -1360,65 +2231,126 @@ func (s *MCPServer) handleSubmitBulkTranslation(req JSONRPCRequest, params CallT
 		return
 	}
 
-	// Parse translated chunks from the text
-	err := s.parseBulkTranslationForSession(session, translatedText)
-	if err != nil {
+	// Get session by extractionId; submits of the same extraction run one at a time
+	session := s.lockOwnExtraction(extractionId)
+	if session == nil {
 		s.writeResponse(JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
 			Result: CallToolResult{
 				Content: []ContentItem{{
 					Type: "text",
-					Text: fmt.Sprintf("ERROR parseando traduccion: %v", err),
+					Text: fmt.Sprintf("ERROR: extractionId '%s' no encontrado. Usa extract_divi_text o extract_wordpress_text primero.", extractionId),
 				}},
 				IsError: true,
 			},
 		})
 		return
 	}
+	defer session.mu.Unlock()
+
+	text, isError := s.submitBulkPart(req.Context(), session, translatedText, force)
+	s.writeToolText(req, text, isError)
+}
+
+// submitBulkPart applies the translation of the current part of a locked
+// session: it validates it, then returns the next part or saves the result
+// once all parts are in. It backs submit_bulk_translation and machine_translate.
+func (s *MCPServer) submitBulkPart(ctx context.Context, session *BulkTranslationSession, translatedText string, force bool) (string, bool) {
+	if err := ctx.Err(); err != nil {
+		return "Envio cancelado antes de procesarse", true
+	}
+
+	// Parse translated chunks from the text
+	err := s.parseBulkTranslationForSession(session, translatedText)
+	if err != nil {
+		return fmt.Sprintf("ERROR parseando traduccion: %v", err), true
+	}
+
+	// Validate the chunks of this part before accepting it
+	report := validateSessionPart(session)
+	report.Issues = append(report.Issues, session.PartGlossaryIssues...)
+	if session.SourceType == "wordpress" && session.CurrentPart == 0 {
+		report.Issues = append(report.Issues, validateSEOMeta(session).Issues...)
+	}
+	if report.HasFatal() && !force {
+		return formatValidationFailure(session, report, session.CurrentPart+1), true
+	}
+	session.ValidationIssues = append(session.ValidationIssues, report.Issues...)
 
 	session.CurrentPart++
+	s.persistSession(session)
 
 	// Check if there are more parts
 	if session.CurrentPart < session.Parts {
 		// Return next part
 		response := s.generateBulkExtractResponseWithID(session)
-		s.writeResponse(JSONRPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: CallToolResult{
-				Content: []ContentItem{{
-					Type: "text",
-					Text: fmt.Sprintf("PARTE %d RECIBIDA\n\n%s", session.CurrentPart, response),
-				}},
-			},
-		})
-		return
+		return fmt.Sprintf("PARTE %d RECIBIDA\n\n%s", session.CurrentPart, response), false
+	}
+
+	// All parts received: compare the shortcode skeleton of the rebuilt document
+	docReport := validateDocumentSkeleton(session.Document.Source, renderTranslatedDocument(session))
+	if docReport.HasFatal() && !force {
+		// Keep the session so the last part can be resubmitted
+		session.CurrentPart = session.Parts - 1
+		s.persistSession(session)
+		return formatValidationFailure(session, docReport, session.Parts), true
+	}
+	session.ValidationIssues = append(session.ValidationIssues, docReport.Issues...)
+
+	// Last chance to honour a cancellation: nothing has been written yet
+	if err := ctx.Err(); err != nil {
+		session.CurrentPart = session.Parts - 1
+		s.persistSession(session)
+		return "Envio cancelado antes de guardar; la ultima parte puede reenviarse", true
 	}
 
 	// All parts received, save the result
 	var result string
 	if session.SourceType == "wordpress" {
-		result = s.saveBulkToWordPressFromSession(session)
+		var conflict bool
+		result, conflict = s.saveBulkToWordPressFromSession(session)
+		if conflict {
+			// Keep the session so the changed chunks can be re-extracted
+			session.CurrentPart = session.Parts - 1
+			s.persistSession(session)
+			return result, true
+		}
 	} else {
 		result = s.saveBulkToFileFromSession(session)
 	}
 
-	// Remove from active extractions
-	extractionsMutex.Lock()
-	delete(activeExtractions, extractionId)
-	extractionsMutex.Unlock()
+	if strings.HasPrefix(result, "ERROR") {
+		// Nothing was written: keep the received parts so the save can be retried
+		session.CurrentPart = session.Parts - 1
+		s.persistSession(session)
+		result += fmt.Sprintf("\n\nLa traduccion se conserva (extractionId=%s). Reenvia la parte %d con submit_bulk_translation para reintentar el guardado, o usa cancel_extraction para descartarla.",
+			session.ExtractionID, session.Parts)
+		return result, true
+	}
 
-	s.writeResponse(JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result: CallToolResult{
-			Content: []ContentItem{{
-				Type: "text",
-				Text: result,
-			}},
-		},
-	})
+	// Remember the new segments once the document is saved
+	s.storeInTranslationMemory(session)
+
+	// Keep the backup directory within the retention policy
+	if session.SourceType == "wordpress" {
+		if wpDB, err := s.getWordPressDB(); err == nil {
+			result += s.applyBackupRetention(wpDB)
+		}
+	}
+
+	if len(session.ValidationIssues) > 0 {
+		report := &ValidationReport{Issues: session.ValidationIssues}
+		fatal, warnings := report.Counts()
+		result += fmt.Sprintf("\n\nVALIDACION (%d errores fatales forzados, %d advertencias):\n%s", fatal, warnings, report.String())
+	}
+
+	result += s.completeBatchItem(session, result)
+
+	// Remove from active extractions and the state directory
+	s.forgetSession(session.ExtractionID)
+
+	return result, false
 }
 
 func (s *MCPServer) parseBulkTranslation(text string) error {
@@ -1445,7 +2377,7 @@ func (s *MCPServer) parseBulkTranslation(text string) error {
 		translated := strings.TrimSpace(text[contentStart:endIdx])
 
 		// Preserve original leading/trailing whitespace pattern
-		original := session.Tokens[session.ChunkIndices[i]].Value
+		original := tokenText(session.Tokens[session.ChunkIndices[i]])
 		if strings.HasPrefix(original, "\n") && !strings.HasPrefix(translated, "\n") {
 			translated = "\n" + translated
 		}
@@ -1462,20 +2394,8 @@ func (s *MCPServer) parseBulkTranslation(text string) error {
 func (s *MCPServer) saveBulkToFile() string {
 	session := s.bulkSession
 
-	// Replace text tokens with translations
-	for i, idx := range session.ChunkIndices {
-		if session.Translations[i] != "" {
-			session.Tokens[idx].Value = session.Translations[i]
-		}
-	}
-
-	// Rebuild document
-	var builder strings.Builder
-	for _, t := range session.Tokens {
-		builder.WriteString(t.Value)
-	}
-
-	result := dropEmptyPTags(builder.String())
+	// Write translations into the shortcode tree and render it
+	result := renderTranslatedDocument(session)
 
 	// Save to file
 	err := os.WriteFile(session.OutputPath, []byte(result), 0644)
@@ -1501,20 +2421,8 @@ Los shortcodes [et_*] se han preservado intactos.`, outputPath, totalChunks)
 func (s *MCPServer) saveBulkToWordPress() string {
 	session := s.bulkSession
 
-	// Replace text tokens with translations
-	for i, idx := range session.ChunkIndices {
-		if session.Translations[i] != "" {
-			session.Tokens[idx].Value = session.Translations[i]
-		}
-	}
-
-	// Rebuild document
-	var builder strings.Builder
-	for _, t := range session.Tokens {
-		builder.WriteString(t.Value)
-	}
-
-	result := dropEmptyPTags(builder.String())
+	// Write translations into the shortcode tree and render it
+	result := renderTranslatedDocument(session)
 
 	// Update WordPress
 	wpDB, err := s.getWordPressDB()
@@ -1522,7 +2430,7 @@ func (s *MCPServer) saveBulkToWordPress() string {
 		return fmt.Sprintf("ERROR conectando a WordPress: %v", err)
 	}
 
-	err = wpDB.UpdatePostContent(session.PostID, result)
+	_, err = wpDB.UpdatePostContent(session.PostID, result)
 	if err != nil {
 		return fmt.Sprintf("ERROR actualizando post: %v", err)
 	}
@@ -1556,7 +2464,7 @@ func (s *MCPServer) parseBulkTranslationForSession(session *BulkTranslationSessi
 		// Parse POST_TITLE
 		if titleStart := strings.Index(text, "{{POST_TITLE}}"); titleStart != -1 {
 			if titleEnd := strings.Index(text, "{{/POST_TITLE}}"); titleEnd != -1 {
-				session.TranslatedTitle = strings.TrimSpace(text[titleStart+len("{{POST_TITLE}}"):titleEnd])
+				session.TranslatedTitle = strings.TrimSpace(text[titleStart+len("{{POST_TITLE}}") : titleEnd])
 			}
 		}
 		// If not found, keep original
@@ -1567,7 +2475,7 @@ func (s *MCPServer) parseBulkTranslationForSession(session *BulkTranslationSessi
 		// Parse POST_SLUG
 		if slugStart := strings.Index(text, "{{POST_SLUG}}"); slugStart != -1 {
 			if slugEnd := strings.Index(text, "{{/POST_SLUG}}"); slugEnd != -1 {
-				session.TranslatedSlug = strings.TrimSpace(text[slugStart+len("{{POST_SLUG}}"):slugEnd])
+				session.TranslatedSlug = strings.TrimSpace(text[slugStart+len("{{POST_SLUG}}") : slugEnd])
 			}
 		}
 		// If not found, keep original
@@ -1578,17 +2486,23 @@ func (s *MCPServer) parseBulkTranslationForSession(session *BulkTranslationSessi
 		// Parse POST_EXCERPT
 		if excerptStart := strings.Index(text, "{{POST_EXCERPT}}"); excerptStart != -1 {
 			if excerptEnd := strings.Index(text, "{{/POST_EXCERPT}}"); excerptEnd != -1 {
-				session.TranslatedExcerpt = strings.TrimSpace(text[excerptStart+len("{{POST_EXCERPT}}"):excerptEnd])
+				session.TranslatedExcerpt = strings.TrimSpace(text[excerptStart+len("{{POST_EXCERPT}}") : excerptEnd])
 			}
 		}
 		// If not found, keep original
 		if session.TranslatedExcerpt == "" {
 			session.TranslatedExcerpt = session.OriginalExcerpt
 		}
+
+		// Parse the SEO plugin fields ({{META:key}})
+		parseSEOMeta(session, text)
 	}
 
-	// Parse each chunk marker
+	// Parse each chunk marker (chunks reused from the translation memory were not sent)
 	for i := partRange[0]; i < partRange[1]; i++ {
+		if session.isPrefilled(i) {
+			continue
+		}
 		marker := fmt.Sprintf("{{CHUNK_%03d}}", i+1)
 		endMarker := fmt.Sprintf("{{/CHUNK_%03d}}", i+1)
 
@@ -1607,7 +2521,7 @@ func (s *MCPServer) parseBulkTranslationForSession(session *BulkTranslationSessi
 		translated := strings.TrimSpace(text[contentStart:endIdx])
 
 		// Preserve original leading/trailing whitespace pattern
-		original := session.Tokens[session.ChunkIndices[i]].Value
+		original := tokenText(session.Tokens[session.ChunkIndices[i]])
 		if strings.HasPrefix(original, "\n") && !strings.HasPrefix(translated, "\n") {
 			translated = "\n" + translated
 		}
@@ -1618,25 +2532,46 @@ func (s *MCPServer) parseBulkTranslationForSession(session *BulkTranslationSessi
 		session.Translations[i] = translated
 	}
 
+	// Check glossary terms on the chunks (and metadata) received in this part
+	session.PartGlossaryIssues = nil
+	if entries := s.glossaryForSession(session); len(entries) > 0 {
+		report := &ValidationReport{}
+		for i := partRange[0]; i < partRange[1]; i++ {
+			if !session.isPrefilled(i) {
+				checkGlossary(report, i+1, entries, tokenText(session.Tokens[session.ChunkIndices[i]]), session.Translations[i])
+			}
+		}
+		if session.SourceType == "wordpress" && session.CurrentPart == 0 {
+			checkGlossary(report, 0, entries, session.OriginalTitle, session.TranslatedTitle)
+			checkGlossary(report, 0, entries, session.OriginalExcerpt, session.TranslatedExcerpt)
+			for _, f := range session.SEOMeta {
+				checkGlossary(report, 0, entries, f.Original, f.Translated)
+			}
+		}
+		session.PartGlossaryIssues = report.Issues
+	}
+
 	return nil
 }
 
-// saveBulkToFileFromSession saves translated content to file for a specific session
-func (s *MCPServer) saveBulkToFileFromSession(session *BulkTranslationSession) string {
-	// Replace text tokens with translations
+// renderTranslatedDocument writes the collected translations into a fresh copy
+// of the session's shortcode tree and renders the resulting document. The
+// session tokens keep the source text so the document can be rendered again.
+func renderTranslatedDocument(session *BulkTranslationSession) string {
+	doc := parseShortcodeDocument(session.Document.Source)
+	tokens := doc.Tokens()
 	for i, idx := range session.ChunkIndices {
 		if session.Translations[i] != "" {
-			session.Tokens[idx].Value = session.Translations[i]
+			setTokenText(&tokens[idx], session.Translations[i])
 		}
 	}
+	return dropEmptyPTags(doc.Render())
+}
 
-	// Rebuild document
-	var builder strings.Builder
-	for _, t := range session.Tokens {
-		builder.WriteString(t.Value)
-	}
-
-	result := dropEmptyPTags(builder.String())
+// saveBulkToFileFromSession saves translated content to file for a specific session
+func (s *MCPServer) saveBulkToFileFromSession(session *BulkTranslationSession) string {
+	// Write translations into the shortcode tree and render it
+	result := renderTranslatedDocument(session)
 
 	// Save to file
 	err := os.WriteFile(session.OutputPath, []byte(result), 0644)
@@ -1654,39 +2589,39 @@ El archivo Divi ha sido traducido y guardado exitosamente.
 Los shortcodes [et_*] se han preservado intactos.`, session.ExtractionID, session.OutputPath, session.TotalChunks)
 }
 
-// saveBulkToWordPressFromSession saves translated content to WordPress for a specific session
-func (s *MCPServer) saveBulkToWordPressFromSession(session *BulkTranslationSession) string {
-	// Replace text tokens with translations
-	for i, idx := range session.ChunkIndices {
-		if session.Translations[i] != "" {
-			session.Tokens[idx].Value = session.Translations[i]
-		}
-	}
-
-	// Rebuild document
-	var builder strings.Builder
-	for _, t := range session.Tokens {
-		builder.WriteString(t.Value)
-	}
-
-	translatedContent := dropEmptyPTags(builder.String())
+// saveBulkToWordPressFromSession saves translated content to WordPress for a
+// specific session. conflict is true when the post changed since extraction
+// and nothing was written.
+func (s *MCPServer) saveBulkToWordPressFromSession(session *BulkTranslationSession) (result string, conflict bool) {
+	// Write translations into the shortcode tree and render it
+	translatedContent := renderTranslatedDocument(session)
 
 	// Update WordPress with full post data (title, slug, excerpt, content)
 	wpDB, err := s.getWordPressDB()
 	if err != nil {
-		return fmt.Sprintf("ERROR conectando a WordPress: %v", err)
+		return fmt.Sprintf("ERROR conectando a WordPress: %v", err), false
 	}
 
-	// Use UpdatePostFull to update all fields
-	err = wpDB.UpdatePostFull(
-		session.PostID,
-		session.TranslatedTitle,
-		session.TranslatedSlug,
-		session.TranslatedExcerpt,
-		translatedContent,
-	)
+	if session.CreateCopy {
+		return s.saveBulkAsNewWordPressPost(wpDB, session, translatedContent)
+	}
+
+	// Update all fields, unless an editor changed the post in the meantime.
+	// Sessions persisted before the version was recorded are saved as before.
+	var revisionID int64
+	meta := seoMetaUpdates(session)
+	if session.OriginalVersion.ContentSHA256 == "" {
+		revisionID, err = wpDB.UpdatePostFull(session.PostID, session.TranslatedTitle, session.TranslatedSlug, session.TranslatedExcerpt, translatedContent, meta)
+	} else {
+		revisionID, err = wpDB.UpdatePostFullIfUnchanged(session.PostID, session.OriginalVersion,
+			session.TranslatedTitle, session.TranslatedSlug, session.TranslatedExcerpt, translatedContent, meta)
+	}
+	var conflictErr *PostConflictError
+	if errors.As(err, &conflictErr) {
+		return s.formatSaveConflict(session, conflictErr.Current), true
+	}
 	if err != nil {
-		return fmt.Sprintf("ERROR actualizando post: %v", err)
+		return fmt.Sprintf("ERROR actualizando post: %v", err), false
 	}
 
 	return fmt.Sprintf(`TRADUCCION BULK COMPLETADA (WORDPRESS)
@@ -1700,18 +2635,179 @@ CAMPOS ACTUALIZADOS:
 - Titulo: %s
 - Slug: %s
 - Excerpt: %s
-- Contenido: %d bloques traducidos
+- Contenido: %d bloques traducidos%s
 
 El post de WordPress ha sido actualizado exitosamente.
 Los shortcodes [et_*] se han preservado intactos.
 
 IMPORTANTE: Backup del contenido original en:
-%s`, session.ExtractionID, session.PostID, session.BackupPath, session.TotalChunks,
+%s%s%s`, session.ExtractionID, session.PostID, session.BackupPath, session.TotalChunks,
 		session.TranslatedTitle, session.TranslatedSlug,
-		truncateForDisplay(session.TranslatedExcerpt, 50), session.TotalChunks, session.BackupPath)
+		truncateForDisplay(session.TranslatedExcerpt, 50), session.TotalChunks, formatSEOMetaSaved(meta), session.BackupPath, revisionNote(revisionID),
+		formatSaveActions(wpDB.RunPostSaveHooks(session.PostID))), false
+}
+
+// revisionNote describes the WordPress revision written by a save, if any
+func revisionNote(revisionID int64) string {
+	if revisionID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nRevision de WordPress con el estado anterior: ID %d\n(restaurable desde la pantalla de revisiones del editor)", revisionID)
+}
+
+// saveBulkAsNewWordPressPost stores the translation as a copy of the source
+// post, leaving the original-language post untouched. conflict is true when
+// the existing translation changed since extraction and nothing was written.
+func (s *MCPServer) saveBulkAsNewWordPressPost(wpDB *WordPressDB, session *BulkTranslationSession, translatedContent string) (result string, conflict bool) {
+	// A translation already linked by the multilingual plugin is updated in place
+	siblingID, err := wpDB.FindTranslation(session.PostID, session.TargetLang)
+	if err != nil {
+		return fmt.Sprintf("ERROR buscando traducciones existentes: %v", err), false
+	}
+	if siblingID != 0 && session.SiblingChecked && siblingID != session.SiblingID {
+		// Linked after the extraction: it may hold a translator's work
+		sibling, err := wpDB.GetPost(siblingID)
+		if err != nil {
+			return fmt.Sprintf("ERROR leyendo traduccion existente: %v", err), false
+		}
+		return s.formatSiblingConflict(session, sibling), true
+	}
+
+	// Global modules render from the library item: use its translation
+	translatedContent, remapped, missing, err := wpDB.remapGlobalModules(translatedContent, session.TargetLang, session.PostID)
+	if err != nil {
+		return fmt.Sprintf("ERROR: %v", err), false
+	}
+	globalNote := formatGlobalModuleRemap(remapped, missing, session.GlobalModules, session.TargetLang)
+
+	if siblingID != 0 {
+		return s.saveBulkToTranslationSibling(wpDB, session, siblingID, translatedContent, globalNote)
+	}
+
+	newID, err := wpDB.CreateTranslatedCopy(
+		session.PostID,
+		session.TranslatedTitle,
+		session.TranslatedSlug,
+		session.TranslatedExcerpt,
+		translatedContent,
+		session.CopyStatus,
+		seoMetaUpdates(session),
+	)
+	if err != nil {
+		return fmt.Sprintf("ERROR creando post traducido: %v", err), false
+	}
+	session.NewPostID = newID
+
+	// The slug may have been suffixed to keep it unique
+	slug, status := session.TranslatedSlug, session.CopyStatus
+	if post, err := wpDB.GetPost(newID); err == nil {
+		slug, status = post.PostName, post.PostStatus
+	}
+
+	s.log("Copia traducida creada: post %d -> %d (%s)", session.PostID, newID, session.TargetLang)
+
+	// Register the copy as a translation of the original
+	linkNote := ""
+	if linked, err := wpDB.LinkTranslation(session.PostID, newID, session.TargetLang, session.SourceLang); err != nil {
+		linkNote = fmt.Sprintf("\n\nAVISO %s: el post se ha creado pero no se ha vinculado: %v", strings.ToUpper(wpDB.Multilingual()), err)
+	} else if linked {
+		linkNote = fmt.Sprintf("\n\n%s: vinculado como traduccion '%s' del post %d.", strings.ToUpper(wpDB.Multilingual()), session.TargetLang, session.PostID)
+	}
+
+	return fmt.Sprintf(`TRADUCCION BULK COMPLETADA (WORDPRESS, POST NUEVO)
+==================================================
+extractionId: %s
+Post original: %d (sin cambios)
+Post nuevo creado: %d
+Estado: %s
+Bloques traducidos: %d
+
+CAMPOS DEL POST NUEVO:
+- Titulo: %s
+- Slug: %s
+- Excerpt: %s
+- Contenido: %d bloques traducidos%s
+
+Se han copiado tipo, padre, orden de menu, autor y todos los postmeta
+(incluidos _et_pb_use_builder, _et_pb_page_layout y la cache CSS de Divi).
+
+Backup del post original en:
+%s%s%s%s`, session.ExtractionID, session.PostID, newID, status, session.TotalChunks,
+		session.TranslatedTitle, slug,
+		truncateForDisplay(session.TranslatedExcerpt, 50), session.TotalChunks, formatSEOMetaSaved(seoMetaUpdates(session)), session.BackupPath, linkNote, globalNote,
+		formatSaveActions(wpDB.RunPostSaveHooks(newID))), false
+}
+
+// saveBulkToTranslationSibling overwrites the existing translation of the
+// source post, after backing it up, instead of creating a duplicate. Like the
+// in-place save, it refuses to overwrite edits made after the extraction.
+func (s *MCPServer) saveBulkToTranslationSibling(wpDB *WordPressDB, session *BulkTranslationSession, siblingID int64, translatedContent, globalNote string) (result string, conflict bool) {
+	sibling, err := wpDB.GetPost(siblingID)
+	if err != nil {
+		return fmt.Sprintf("ERROR leyendo traduccion existente: %v", err), false
+	}
+	siblingBackup, err := wpDB.SaveFullBackup(sibling, session.SourceLang, session.TargetLang, session.ExtractionID)
+	if err != nil {
+		return fmt.Sprintf("ERROR creando backup de la traduccion existente: %v", err), false
+	}
+
+	// Sessions persisted before the sibling was recorded are saved as before
+	var revisionID int64
+	meta := seoMetaUpdates(session)
+	if session.SiblingID == siblingID && session.SiblingVersion.ContentSHA256 != "" {
+		revisionID, err = wpDB.UpdatePostFullIfUnchanged(siblingID, session.SiblingVersion,
+			session.TranslatedTitle, session.TranslatedSlug, session.TranslatedExcerpt, translatedContent, meta)
+	} else {
+		revisionID, err = wpDB.UpdatePostFull(siblingID,
+			session.TranslatedTitle, session.TranslatedSlug, session.TranslatedExcerpt, translatedContent, meta)
+	}
+	var conflictErr *PostConflictError
+	if errors.As(err, &conflictErr) {
+		return s.formatSiblingConflict(session, conflictErr.Current), true
+	}
+	if err != nil {
+		return fmt.Sprintf("ERROR actualizando traduccion existente: %v", err), false
+	}
+	session.NewPostID = siblingID
+
+	s.log("Traduccion existente actualizada: post %d -> %d (%s)", session.PostID, siblingID, session.TargetLang)
+
+	return fmt.Sprintf(`TRADUCCION BULK COMPLETADA (WORDPRESS, TRADUCCION EXISTENTE)
+============================================================
+extractionId: %s
+Post original: %d (sin cambios)
+Traduccion '%s' actualizada: post %d (%s)
+Bloques traducidos: %d
+
+CAMPOS ACTUALIZADOS:
+- Titulo: %s
+- Slug: %s
+- Excerpt: %s
+- Contenido: %d bloques traducidos%s
+
+Backup del post original en:
+%s
+Backup de la traduccion anterior en:
+%s%s%s%s`, session.ExtractionID, session.PostID, session.TargetLang, siblingID, strings.ToUpper(wpDB.Multilingual()),
+		session.TotalChunks, session.TranslatedTitle, session.TranslatedSlug,
+		truncateForDisplay(session.TranslatedExcerpt, 50), session.TotalChunks, formatSEOMetaSaved(meta), session.BackupPath, siblingBackup, revisionNote(revisionID), globalNote,
+		formatSaveActions(wpDB.RunPostSaveHooks(siblingID))), false
 }
 
-func (s *MCPServer) handleGetStatus(req JSONRPCRequest) {
+func (s *MCPServer) handleGetStatus(req JSONRPCRequest, params CallToolParams) {
+	// Bulk extraction by ID
+	if extractionID, _ := params.Arguments["extractionId"].(string); extractionID != "" {
+		session := s.lockOwnExtraction(extractionID)
+		if session == nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: extractionId '%s' no encontrado, cancelado o caducado", extractionID), true)
+			return
+		}
+		status := s.extractionStatus(session)
+		session.mu.Unlock()
+		s.writeToolText(req, status, false)
+		return
+	}
+
 	// Check bulk session first
 	if s.bulkSession != nil {
 		var source string
@@ -1750,6 +2846,10 @@ Parte actual: %d de %d`,
 
 	// Check legacy session
 	if s.session == nil {
+		if len(s.ownExtractions()) > 0 {
+			s.handleListExtractions(req, params)
+			return
+		}
 		s.writeResponse(JSONRPCResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
@@ -1822,35 +2922,85 @@ func (s *MCPServer) handleServerInfo(req JSONRPCRequest) {
 			mysqlStatus = fmt.Sprintf("ERROR ping: %v", pingErr)
 		}
 	}
+	multilingual := "(sin conexion)"
+	if mysqlStatus == "OK" {
+		multilingual = wpDB.Multilingual()
+	}
 
 	// Config activa (enmascarada)
 	host := maskString(os.Getenv("WP_MYSQL_HOST"), "localhost")
 	port := os.Getenv("WP_MYSQL_PORT")
-	if port == "" { port = "3306" }
+	if port == "" {
+		port = "3306"
+	}
 	tablePrefix := os.Getenv("WP_TABLE_PREFIX")
-	if tablePrefix == "" { tablePrefix = "wp_" }
+	if tablePrefix == "" {
+		tablePrefix = "wp_"
+	}
 	backupDir := os.Getenv("WP_BACKUP_DIR")
-	if backupDir == "" { backupDir = "." }
+	if backupDir == "" {
+		backupDir = "."
+	}
 	mysqlDB = maskString(mysqlDB, "")
 
+	// Memoria de traduccion
+	tmStatus := "OK"
+	tmPath := ""
+	tmSegments := 0
+	if tm, err := s.getTranslationMemory(); err != nil {
+		tmStatus = fmt.Sprintf("ERROR: %v", err)
+	} else {
+		tmPath = tm.Path()
+		tmSegments = tm.Count()
+	}
+
+	// Glosario
+	glossaryStatus := "OK"
+	glossaryPath := ""
+	glossaryTerms := 0
+	if g, err := s.getGlossary(); err != nil {
+		glossaryStatus = fmt.Sprintf("ERROR: %v", err)
+	} else {
+		glossaryPath = g.Path()
+		g.mu.RLock()
+		glossaryTerms = len(g.Entries)
+		g.mu.RUnlock()
+	}
+
 	// Sesiones activas
 	extractionsMutex.RLock()
 	activeSessions := len(activeExtractions)
 	extractionsMutex.RUnlock()
+	transport := "stdio"
+	if s.owner != "" {
+		transport = "HTTP (sesion " + s.owner + ")"
+	}
 
 	info := fmt.Sprintf(`=== DIVI TRANSLATOR SERVER INFO ===
-Version:          4.3.0
+Version:          %s
 Protocol:         %s
+Transporte:       %s
 
 --- MySQL ---
 Status:           %s
 Host:             %s:%s
 Database:         %s
 Table Prefix:     %s
+Multilingue:      %s
 
 --- Rutas ---
 Backup Dir:       %s
 
+--- Memoria de traduccion ---
+Status:           %s
+Archivo:          %s
+Segmentos:        %d
+
+--- Glosario ---
+Status:           %s
+Archivo:          %s
+Terminos:         %d
+
 --- Sesiones activas ---
 Bulk extractions: %d
 
@@ -1859,6 +3009,35 @@ Bulk extractions: %d
     extract_divi_text
     extract_wordpress_text
     submit_bulk_translation
+  Memoria de traduccion:
+    tm_lookup
+    tm_edit
+    tm_purge
+  Glosario:
+    glossary_import
+    glossary_add
+    glossary_remove
+    glossary_list
+  Sesiones:
+    list_extractions
+    resume_extraction
+    cancel_extraction
+    refresh_extraction
+  Backups:
+    list_backups
+    show_backup
+    restore_backup
+    prune_backups
+  Multilingue:
+    list_post_translations
+  Divi:
+    list_divi_layouts
+  Lotes:
+    create_batch_job
+    batch_next_extraction
+    batch_status
+  Traduccion automatica:
+    machine_translate
   Utilidad:
     get_translation_status
     server_info
@@ -1866,12 +3045,21 @@ Bulk extractions: %d
     start_divi_translation
     start_wordpress_translation
     submit_translation`,
+		SERVER_VERSION,
 		MCP_PROTOCOL_VERSION,
+		transport,
 		mysqlStatus,
 		host, port,
 		mysqlDB,
 		tablePrefix,
+		multilingual,
 		backupDir,
+		tmStatus,
+		tmPath,
+		tmSegments,
+		glossaryStatus,
+		glossaryPath,
+		glossaryTerms,
 		activeSessions,
 	)
 
@@ -1894,36 +3082,101 @@ func (s *MCPServer) handlePing(req JSONRPCRequest) {
 }
 
 func (s *MCPServer) handleShutdown(req JSONRPCRequest) {
-	// Clean up WordPress connection if exists
-	if s.wpDB != nil {
-		s.wpDB.Close()
+	if !s.stopAccepting() {
+		s.writeResponse(JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error:   &RPCError{Code: -32600, Message: "Invalid Request: shutdown already in progress"},
+		})
+		return
 	}
 
-	// Respond to shutdown request
-	s.writeResponse(JSONRPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result:  map[string]interface{}{},
-	})
+	// Let the calls in progress finish before closing their resources. The
+	// drain runs off the reader goroutine, so cancellations of those calls are
+	// still read meanwhile. An HTTP client only ends its own session: the
+	// resources are shared.
+	go func() {
+		s.drainCalls()
+		if s.parent == nil {
+			s.closeResources()
+		}
 
-	// Signal that server should exit
-	s.shouldShutdown = true
+		s.writeResponse(JSONRPCResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  map[string]interface{}{},
+		})
+
+		// Signal that server should exit
+		if s.stopped != nil {
+			close(s.stopped)
+		}
+	}()
 }
 
 func (s *MCPServer) Run() {
-	scanner := bufio.NewScanner(s.stdin)
-	// Increase buffer size for large inputs
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
+	// Reload extractions interrupted by a previous restart
+	s.restoreSessions()
+
+	// Expire abandoned extractions in the background
+	stopReaper := make(chan struct{})
+	defer close(stopReaper)
+	go s.reapSessions(stopReaper)
+
+	// Messages are read in their own goroutine, so it keeps reading while
+	// shutdown waits for the calls in progress
+	s.stopped = make(chan struct{})
+	eof := make(chan struct{})
+	go func() {
+		defer close(eof)
+		s.readMessages(newMessageReader(s.stdin, maxMessageSize()))
+	}()
+
+	select {
+	case <-s.stopped:
+		return
+	case <-eof:
+	}
+
+	// stdin closed: clean up unless a shutdown request is already doing it
+	if !s.stopAccepting() {
+		<-s.stopped
+		return
+	}
+	s.drainCalls()
+	s.closeResources()
+}
+
+// readMessages handles the messages of the stdio transport until stdin ends.
+// Messages are read without a fixed line limit (MCP_MAX_MESSAGE_SIZE).
+func (s *MCPServer) readMessages(reader *messageReader) {
+	for {
+		line, err := reader.Next()
+		if tooLarge, ok := err.(*messageTooLargeError); ok {
+			s.log("Mensaje rechazado: %v", tooLarge)
+			s.writeResponse(JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      tooLarge.RequestID(),
+				Error: &RPCError{
+					Code:    -32600,
+					Message: fmt.Sprintf("Invalid Request: message of %d bytes exceeds the %d byte limit (MCP_MAX_MESSAGE_SIZE)", tooLarge.Size, tooLarge.Limit),
+				},
+			})
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.log("Error leyendo stdin: %v", err)
+			break
+		}
+		if len(line) == 0 {
 			continue
 		}
 
 		var req JSONRPCRequest
-		if err := json.Unmarshal([]byte(line), &req); err != nil {
+		if err := json.Unmarshal(line, &req); err != nil {
 			s.log("Error parsing request: %v", err)
 			continue
 		}
@@ -1942,46 +3195,40 @@ func (s *MCPServer) Run() {
 		}
 
 		s.log("Received method: %s", req.Method)
-
-		switch req.Method {
-		case "initialize":
-			s.handleInitialize(req)
-		case "shutdown":
-			s.handleShutdown(req)
-			return // Exit gracefully after shutdown
-		case "tools/list":
-			s.handleListTools(req)
-		case "tools/call":
-			s.handleCallTool(req)
-		case "ping":
-			s.handlePing(req)
-		case "notifications/initialized":
-			// Client notification, no response needed
-		default:
-			if req.ID != nil {
-				s.writeResponse(JSONRPCResponse{
-					JSONRPC: "2.0",
-					ID:      req.ID,
-					Error: &RPCError{
-						Code:    -32601,
-						Message: fmt.Sprintf("Method not found: %s", req.Method),
-					},
-				})
-			}
-		}
-
-		// Check if shutdown was requested
-		if s.shouldShutdown {
-			return
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		s.log("Scanner error: %v", err)
+		s.handleRequest(req)
 	}
+}
 
-	// Clean up WordPress connection
-	if s.wpDB != nil {
-		s.wpDB.Close()
+// handleRequest routes a parsed JSON-RPC message. It is shared by the stdio
+// and HTTP transports; tool calls run in the background.
+func (s *MCPServer) handleRequest(req JSONRPCRequest) {
+	switch req.Method {
+	case "initialize":
+		s.handleInitialize(req)
+	case "shutdown":
+		s.handleShutdown(req)
+	case "tools/list":
+		s.handleListTools(req)
+	case "tools/call":
+		s.dispatchToolCall(req)
+	case "ping":
+		s.handlePing(req)
+	case "logging/setLevel":
+		s.handleSetLogLevel(req)
+	case "notifications/initialized":
+		// Client notification, no response needed
+	case "notifications/cancelled":
+		s.handleCancelled(req)
+	default:
+		if req.ID != nil {
+			s.writeResponse(JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &RPCError{
+					Code:    -32601,
+					Message: fmt.Sprintf("Method not found: %s", req.Method),
+				},
+			})
+		}
 	}
 }
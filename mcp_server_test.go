@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestFileSession publishes a file extraction of source
+func newTestFileSession(t *testing.T, s *MCPServer, source, outputPath string) *BulkTranslationSession {
+	t.Helper()
+	session := s.initBulkSessionWithID(source, "es", "en", "file", "", outputPath, 0, "")
+	if session == nil {
+		t.Fatal("no translatable text")
+	}
+	s.publishSession(session)
+	t.Cleanup(func() { s.forgetSession(session.ExtractionID) })
+	return session
+}
+
+// partText answers every chunk of the session's current part with translate
+func partText(session *BulkTranslationSession, translate func(string) string) string {
+	var b strings.Builder
+	partRange := session.PartRanges[session.CurrentPart]
+	for i := partRange[0]; i < partRange[1]; i++ {
+		source := tokenText(session.Tokens[session.ChunkIndices[i]])
+		b.WriteString(fmt.Sprintf("{{CHUNK_%03d}}%s{{/CHUNK_%03d}}\n", i+1, translate(source), i+1))
+	}
+	return b.String()
+}
+
+func TestSubmitBulkPartKeepsSessionWhenSaveFails(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("SESSION_STATE_DIR", stateDir)
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+
+	outDir := filepath.Join(t.TempDir(), "missing")
+	session := newTestFileSession(t, s, `[et_pb_section][et_pb_text]<p>Hola mundo</p>[/et_pb_text][/et_pb_section]`, filepath.Join(outDir, "out.txt"))
+	text := partText(session, func(string) string { return "<p>Hello world</p>" })
+
+	result, isError := s.submitBulkPart(context.Background(), session, text, false)
+	if !isError || !strings.HasPrefix(result, "ERROR guardando archivo") {
+		t.Fatalf("failed save: isError=%v, result:\n%s", isError, result)
+	}
+	if lockExtraction(session.ExtractionID) == nil {
+		t.Fatal("the session was dropped after a failed save")
+	}
+	session.mu.Unlock()
+	if session.CurrentPart != session.Parts-1 {
+		t.Errorf("CurrentPart = %d, want %d", session.CurrentPart, session.Parts-1)
+	}
+	if _, err := os.Stat(sessionFile(stateDir, session.ExtractionID)); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+
+	// Resubmitting the last part retries the save
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	result, isError = s.submitBulkPart(context.Background(), session, text, false)
+	if isError {
+		t.Fatalf("retry failed:\n%s", result)
+	}
+	data, err := os.ReadFile(session.OutputPath)
+	if err != nil || !strings.Contains(string(data), "<p>Hello world</p>") {
+		t.Errorf("output = %q, %v", data, err)
+	}
+	if _, err := os.Stat(sessionFile(stateDir, session.ExtractionID)); !os.IsNotExist(err) {
+		t.Errorf("state file left after a successful save: %v", err)
+	}
+}
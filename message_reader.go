@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultMaxMessageSize bounds one JSON-RPC message on stdin. Large Divi pages
+// translated in a single submit_bulk_translation easily exceed a few MB.
+const defaultMaxMessageSize = 64 << 20
+
+// oversizePrefixSize is how much of a rejected message is kept to find its ID
+const oversizePrefixSize = 4096
+
+// messageTooLargeError is returned for a line over the size limit. The rest of
+// the line is discarded so the next message can still be read.
+type messageTooLargeError struct {
+	Size   int64
+	Limit  int64
+	Prefix []byte
+}
+
+func (e *messageTooLargeError) Error() string {
+	return fmt.Sprintf("mensaje de %s supera el limite de %s (MCP_MAX_MESSAGE_SIZE)", formatBytes(e.Size), formatBytes(e.Limit))
+}
+
+// requestIDPattern finds a top-level-looking "id" member in a truncated message
+var requestIDPattern = regexp.MustCompile(`"id"\s*:\s*("(?:[^"\\]|\\.)*"|-?\d+)`)
+
+// RequestID makes a best effort to recover the request ID from the prefix, so
+// the client can match the error with its call. It returns nil if not found.
+func (e *messageTooLargeError) RequestID() interface{} {
+	m := requestIDPattern.FindSubmatch(e.Prefix)
+	if m == nil {
+		return nil
+	}
+	var id interface{}
+	if err := json.Unmarshal(m[1], &id); err != nil {
+		return nil
+	}
+	return id
+}
+
+// maxMessageSize reads MCP_MAX_MESSAGE_SIZE (bytes, or with KB/MB/GB suffix).
+// 0 disables the limit.
+func maxMessageSize() int64 {
+	v := os.Getenv("MCP_MAX_MESSAGE_SIZE")
+	if strings.TrimSpace(v) == "" {
+		return defaultMaxMessageSize
+	}
+	size, err := parseByteSize(v)
+	if err != nil {
+		return defaultMaxMessageSize
+	}
+	return size
+}
+
+// messageReader reads newline-delimited JSON-RPC messages of any length up to
+// a configurable limit, without bufio.Scanner's fixed token size
+type messageReader struct {
+	r     *bufio.Reader
+	limit int64 // 0 means no limit
+}
+
+func newMessageReader(r io.Reader, limit int64) *messageReader {
+	return &messageReader{r: bufio.NewReaderSize(r, 64*1024), limit: limit}
+}
+
+// Next returns the next line without its line ending. It returns a
+// *messageTooLargeError for an oversize line (the reader stays usable) and
+// io.EOF once the input is exhausted.
+func (m *messageReader) Next() ([]byte, error) {
+	var line []byte
+	var size int64
+	tooLarge := false
+
+	for {
+		chunk, err := m.r.ReadSlice('\n')
+		size += int64(len(chunk))
+
+		if m.limit > 0 && size > m.limit+2 { // Allow for the \r\n
+			if !tooLarge {
+				tooLarge = true
+				// Keep only the start of the message to recover its ID
+				line = append(line, chunk...)
+				if len(line) > oversizePrefixSize {
+					line = line[:oversizePrefixSize]
+				}
+			}
+		} else {
+			line = append(line, chunk...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && size > 0:
+			// Last line without a trailing newline
+		case err != nil:
+			return nil, err
+		}
+		break
+	}
+
+	if tooLarge {
+		return nil, &messageTooLargeError{Size: size, Limit: m.limit, Prefix: line}
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line, nil
+}
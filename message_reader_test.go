@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// rpcLine builds a JSON-RPC request line whose params carry a text of size bytes
+func rpcLine(t *testing.T, id interface{}, method string, size int) []byte {
+	t.Helper()
+	line, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  map[string]interface{}{"text": strings.Repeat("Hola mundo. ", size/12+1)[:size]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestMessageReaderLargeMessage(t *testing.T) {
+	big := rpcLine(t, 1, "tools/call", 5<<20)
+	small := rpcLine(t, 2, "ping", 10)
+	input := append(append(append([]byte{}, big...), '\r', '\n'), small...)
+	input = append(input, '\n')
+
+	r := newMessageReader(bytes.NewReader(input), 64<<20)
+	got, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Fatalf("message of %d bytes read as %d bytes", len(big), len(got))
+	}
+	got, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, small) {
+		t.Errorf("second message = %q, want %q", got, small)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("after the last message: err = %v, want io.EOF", err)
+	}
+}
+
+func TestMessageReaderOversizeMessage(t *testing.T) {
+	big := rpcLine(t, "big-1", "tools/call", 3<<20)
+	small := rpcLine(t, 2, "ping", 10)
+	input := append(append(append([]byte{}, big...), '\n'), small...)
+	input = append(input, '\n')
+
+	r := newMessageReader(bytes.NewReader(input), 1<<20)
+	_, err := r.Next()
+	var tooLarge *messageTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want *messageTooLargeError", err)
+	}
+	if tooLarge.Size != int64(len(big))+1 {
+		t.Errorf("Size = %d, want %d", tooLarge.Size, len(big)+1)
+	}
+	if len(tooLarge.Prefix) > oversizePrefixSize {
+		t.Errorf("kept %d bytes of the rejected message, want at most %d", len(tooLarge.Prefix), oversizePrefixSize)
+	}
+	if id := tooLarge.RequestID(); id != "big-1" {
+		t.Errorf("RequestID() = %v, want big-1", id)
+	}
+
+	// The rest of the oversize line is discarded: the next message is intact
+	got, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, small) {
+		t.Errorf("message after the oversize one = %q, want %q", got, small)
+	}
+}
+
+func TestMessageReaderNoTrailingNewline(t *testing.T) {
+	first := rpcLine(t, 1, "ping", 10)
+	last := rpcLine(t, 2, "tools/call", 2<<20)
+	input := append(append(append([]byte{}, first...), '\n'), last...)
+
+	r := newMessageReader(bytes.NewReader(input), 64<<20)
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, last) {
+		t.Errorf("last message of %d bytes read as %d bytes", len(last), len(got))
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("err = %v, want io.EOF", err)
+	}
+}
+
+// TestRunRejectsOversizeMessage checks the server answers an oversize message
+// with a JSON-RPC error for its ID and keeps serving the next requests
+func TestRunRejectsOversizeMessage(t *testing.T) {
+	t.Setenv("MCP_MAX_MESSAGE_SIZE", "1MB")
+	t.Setenv("SESSION_STATE_DIR", t.TempDir())
+
+	var input bytes.Buffer
+	input.Write(rpcLine(t, 7, "tools/call", 2<<20))
+	input.WriteString("\n")
+	input.Write(rpcLine(t, 8, "ping", 10))
+	input.WriteString("\n")
+
+	var output bytes.Buffer
+	s := &MCPServer{stdin: &input, stdout: &output, stderr: io.Discard}
+	s.Run()
+
+	var responses []JSONRPCResponse
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		var resp JSONRPCResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", scanner.Text(), err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("got %d responses, want 2: %s", len(responses), output.String())
+	}
+	if responses[0].ID != float64(7) || responses[0].Error == nil || responses[0].Error.Code != -32600 {
+		t.Errorf("oversize message: got %+v, want error -32600 for id 7", responses[0])
+	}
+	if responses[1].ID != float64(8) || responses[1].Error != nil {
+		t.Errorf("ping after the oversize message: got %+v", responses[1])
+	}
+}
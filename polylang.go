@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Polylang taxonomies
+const (
+	pllLanguageTaxonomy     = "language"
+	pllTranslationsTaxonomy = "post_translations"
+)
+
+// pllGroup is a post_translations term: language slug -> post ID, serialized
+// as a PHP array in term_taxonomy.description
+type pllGroup struct {
+	TermTaxonomyID int64
+	Langs          []string // Keys in stored order
+	Posts          map[string]int64
+	Extra          []string // Other entries (Polylang Pro "sync", ...), raw key and value
+}
+
+// phpSerializeLangMap serializes a language -> post ID map like PHP
+// serialize(). The extra entries are written back unchanged after the posts.
+func phpSerializeLangMap(langs []string, posts map[string]int64, extra []string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("a:%d:{", len(langs)+len(extra)))
+	for _, lang := range langs {
+		b.WriteString(fmt.Sprintf("s:%d:\"%s\";i:%d;", len(lang), lang, posts[lang]))
+	}
+	for _, entry := range extra {
+		b.WriteString(entry)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// phpValueEnd returns the offset just after the serialized PHP value that
+// starts at i. Nested arrays and objects are skipped as a whole.
+func phpValueEnd(data string, i int) (int, error) {
+	if i+1 >= len(data) {
+		return 0, fmt.Errorf("valor serializado incompleto")
+	}
+	switch data[i] {
+	case 'N':
+		if data[i+1] != ';' {
+			return 0, fmt.Errorf("valor nulo serializado no valido")
+		}
+		return i + 2, nil
+	case 'i', 'd', 'b':
+		end := strings.IndexByte(data[i:], ';')
+		if data[i+1] != ':' || end < 0 {
+			return 0, fmt.Errorf("valor serializado incompleto")
+		}
+		return i + end + 1, nil
+	case 's':
+		n, start, err := phpLength(data, i+2)
+		if err != nil {
+			return 0, err
+		}
+		if start+n+2 > len(data) || data[start-1] != '"' || data[start+n:start+n+2] != "\";" {
+			return 0, fmt.Errorf("longitud de cadena serializada no valida")
+		}
+		return start + n + 2, nil
+	case 'a', 'O':
+		j := i + 2
+		if data[i] == 'O' {
+			// O:len:"Class":count:{...}
+			n, start, err := phpLength(data, j)
+			if err != nil || start+n+2 > len(data) || data[start+n:start+n+2] != "\":" {
+				return 0, fmt.Errorf("objeto serializado no valido")
+			}
+			j = start + n + 2
+		}
+		colon := strings.IndexByte(data[j:], ':')
+		if colon < 0 {
+			return 0, fmt.Errorf("array serializado incompleto")
+		}
+		count, err := strconv.Atoi(data[j : j+colon])
+		j += colon + 1
+		if err != nil || count < 0 || j >= len(data) || data[j] != '{' {
+			return 0, fmt.Errorf("array serializado no valido")
+		}
+		j++
+		for k := 0; k < 2*count; k++ {
+			if j, err = phpValueEnd(data, j); err != nil {
+				return 0, err
+			}
+		}
+		if j >= len(data) || data[j] != '}' {
+			return 0, fmt.Errorf("array serializado sin cierre")
+		}
+		return j + 1, nil
+	}
+	return 0, fmt.Errorf("tipo serializado no soportado: %q", truncateForDisplay(data[i:], 20))
+}
+
+// phpLength reads the N:" prefix of a serialized string at i and returns N
+// and the offset of the first byte of the string
+func phpLength(data string, i int) (int, int, error) {
+	if i > len(data) || data[i-1] != ':' {
+		return 0, 0, fmt.Errorf("cadena serializada incompleta")
+	}
+	colon := strings.IndexByte(data[i:], ':')
+	if colon < 0 {
+		return 0, 0, fmt.Errorf("cadena serializada incompleta")
+	}
+	n, err := strconv.Atoi(data[i : i+colon])
+	start := i + colon + 2 // Skip ':"'
+	if err != nil || n < 0 || start > len(data) {
+		return 0, 0, fmt.Errorf("longitud de cadena serializada no valida")
+	}
+	return n, start, nil
+}
+
+// phpUnserializeLangMap parses the a:N:{s:L:"lang";i:ID;...} arrays Polylang
+// stores for translation groups. Values serialized as strings are accepted
+// too; any other entry is returned raw in extra so it can be written back.
+func phpUnserializeLangMap(data string) (langs []string, posts map[string]int64, extra []string, err error) {
+	posts = make(map[string]int64)
+
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return langs, posts, nil, nil
+	}
+	if !strings.HasPrefix(data, "a:") {
+		return nil, nil, nil, fmt.Errorf("grupo de traducciones Polylang no valido: %q", truncateForDisplay(data, 80))
+	}
+	if end, err := phpValueEnd(data, 0); err != nil || end != len(data) {
+		if err == nil {
+			err = fmt.Errorf("datos sobrantes")
+		}
+		return nil, nil, nil, fmt.Errorf("grupo de traducciones Polylang no valido (%v): %q", err, truncateForDisplay(data, 80))
+	}
+
+	// The array is well formed: walk its key/value pairs
+	i := strings.IndexByte(data, '{') + 1
+	for data[i] != '}' {
+		keyEnd, _ := phpValueEnd(data, i)
+		valueEnd, _ := phpValueEnd(data, keyEnd)
+		key, value := phpScalar(data[i:keyEnd]), phpScalar(data[keyEnd:valueEnd])
+		id, idErr := strconv.ParseInt(value, 10, 64)
+		if data[i] != 's' || idErr != nil || (data[keyEnd] != 'i' && data[keyEnd] != 's') {
+			extra = append(extra, data[i:valueEnd])
+		} else {
+			if _, dup := posts[key]; !dup {
+				langs = append(langs, key)
+			}
+			posts[key] = id
+		}
+		i = valueEnd
+	}
+	return langs, posts, extra, nil
+}
+
+// phpScalar returns the value of a serialized string or integer, or "" for
+// other types
+func phpScalar(raw string) string {
+	switch {
+	case strings.HasPrefix(raw, "s:"):
+		start := strings.IndexByte(raw, '"')
+		return raw[start+1 : len(raw)-2]
+	case strings.HasPrefix(raw, "i:"):
+		return raw[2 : len(raw)-1]
+	}
+	return ""
+}
+
+// pllPostTerm returns the term_taxonomy_id and slug of the post's term in a
+// Polylang taxonomy, or 0 if it has none
+func (wp *WordPressDB) pllPostTerm(q rowQuerier, postID int64, taxonomy string) (int64, string, string, error) {
+	query := fmt.Sprintf(`
+		SELECT tt.term_taxonomy_id, t.slug, tt.description
+		FROM %[1]sterm_relationships tr
+		JOIN %[1]sterm_taxonomy tt ON tt.term_taxonomy_id = tr.term_taxonomy_id
+		JOIN %[1]sterms t ON t.term_id = tt.term_id
+		WHERE tr.object_id = ? AND tt.taxonomy = ?
+		LIMIT 1`,
+		wp.tablePrefix)
+
+	var ttID int64
+	var slug, description string
+	err := q.QueryRow(query, postID, taxonomy).Scan(&ttID, &slug, &description)
+	if err == sql.ErrNoRows {
+		return 0, "", "", nil
+	}
+	if err != nil {
+		return 0, "", "", fmt.Errorf("error leyendo taxonomia %s: %v", taxonomy, err)
+	}
+	return ttID, slug, description, nil
+}
+
+// pllLanguageTermID returns the term_taxonomy_id of a Polylang language by slug
+func (wp *WordPressDB) pllLanguageTermID(q rowQuerier, lang string) (int64, error) {
+	query := fmt.Sprintf(`
+		SELECT tt.term_taxonomy_id
+		FROM %[1]sterm_taxonomy tt
+		JOIN %[1]sterms t ON t.term_id = tt.term_id
+		WHERE tt.taxonomy = ? AND t.slug = ?`,
+		wp.tablePrefix)
+
+	var ttID int64
+	err := q.QueryRow(query, pllLanguageTaxonomy, strings.ToLower(lang)).Scan(&ttID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("el idioma '%s' no esta configurado en Polylang", lang)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo idiomas de Polylang: %v", err)
+	}
+	return ttID, nil
+}
+
+// pllGroupFor returns the post_translations group of a post, or nil
+func (wp *WordPressDB) pllGroupFor(q rowQuerier, postID int64) (*pllGroup, error) {
+	ttID, _, description, err := wp.pllPostTerm(q, postID, pllTranslationsTaxonomy)
+	if err != nil || ttID == 0 {
+		return nil, err
+	}
+	langs, posts, extra, err := phpUnserializeLangMap(description)
+	if err != nil {
+		return nil, err
+	}
+	return &pllGroup{TermTaxonomyID: ttID, Langs: langs, Posts: posts, Extra: extra}, nil
+}
+
+// pllAddRelationship assigns a term to a post and updates the term count
+func (wp *WordPressDB) pllAddRelationship(tx *sql.Tx, postID, termTaxonomyID int64) error {
+	query := fmt.Sprintf(`
+		INSERT IGNORE INTO %sterm_relationships (object_id, term_taxonomy_id, term_order)
+		VALUES (?, ?, 0)`,
+		wp.tablePrefix)
+	result, err := tx.Exec(query, postID, termTaxonomyID)
+	if err != nil {
+		return fmt.Errorf("error asignando termino: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		query = fmt.Sprintf(`UPDATE %sterm_taxonomy SET count = count + 1 WHERE term_taxonomy_id = ?`, wp.tablePrefix)
+		if _, err := tx.Exec(query, termTaxonomyID); err != nil {
+			return fmt.Errorf("error actualizando contador de termino: %v", err)
+		}
+	}
+	return nil
+}
+
+// PolylangTranslations returns every post in the Polylang translation group of
+// postID, or only the post itself if it has a language but no group yet.
+// It returns nil if the post has no Polylang language.
+func (wp *WordPressDB) PolylangTranslations(postID int64) ([]PostTranslation, error) {
+	group, err := wp.pllGroupFor(wp.db, postID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		_, lang, _, err := wp.pllPostTerm(wp.db, postID, pllLanguageTaxonomy)
+		if err != nil || lang == "" {
+			return nil, err
+		}
+		group = &pllGroup{Langs: []string{lang}, Posts: map[string]int64{lang: postID}}
+	}
+
+	var translations []PostTranslation
+	for _, lang := range group.Langs {
+		post, err := wp.GetPost(group.Posts[lang])
+		if err != nil {
+			continue // Stale entry: the post was deleted
+		}
+		translations = append(translations, PostTranslation{
+			PostID:   post.ID,
+			Language: lang,
+			Title:    post.PostTitle,
+			Status:   post.PostStatus,
+		})
+	}
+	sort.SliceStable(translations, func(i, j int) bool { return translations[i].Language < translations[j].Language })
+	return translations, nil
+}
+
+// PolylangLinkTranslation assigns the lang language term to translatedID and
+// merges it into the post_translations group of sourceID, creating the group
+// if needed. A source without language gets sourceLang.
+func (wp *WordPressDB) PolylangLinkTranslation(sourceID, translatedID int64, lang, sourceLang string) error {
+	lang = strings.ToLower(lang)
+
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Language of the source post
+	_, srcLang, _, err := wp.pllPostTerm(tx, sourceID, pllLanguageTaxonomy)
+	if err != nil {
+		return err
+	}
+	if srcLang == "" {
+		if sourceLang == "" {
+			return fmt.Errorf("el post %d no tiene idioma en Polylang y no se conoce su idioma", sourceID)
+		}
+		srcTermID, err := wp.pllLanguageTermID(tx, sourceLang)
+		if err != nil {
+			return err
+		}
+		if err := wp.pllAddRelationship(tx, sourceID, srcTermID); err != nil {
+			return err
+		}
+		srcLang = strings.ToLower(sourceLang)
+	}
+	if srcLang == lang {
+		return fmt.Errorf("el post %d ya esta en idioma '%s' en Polylang", sourceID, lang)
+	}
+
+	// Language of the translation
+	langTermID, err := wp.pllLanguageTermID(tx, lang)
+	if err != nil {
+		return err
+	}
+	_, currentLang, _, err := wp.pllPostTerm(tx, translatedID, pllLanguageTaxonomy)
+	if err != nil {
+		return err
+	}
+	if currentLang != "" && currentLang != lang {
+		return fmt.Errorf("el post %d ya tiene el idioma '%s' en Polylang", translatedID, currentLang)
+	}
+	if err := wp.pllAddRelationship(tx, translatedID, langTermID); err != nil {
+		return err
+	}
+
+	// Merge into the source's translation group
+	group, err := wp.pllGroupFor(tx, sourceID)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		group = &pllGroup{Langs: []string{srcLang}, Posts: map[string]int64{srcLang: sourceID}}
+
+		name := fmt.Sprintf("pll_%x", time.Now().UnixNano())
+		query := fmt.Sprintf(`INSERT INTO %sterms (name, slug, term_group) VALUES (?, ?, 0)`, wp.tablePrefix)
+		result, err := tx.Exec(query, name, name)
+		if err != nil {
+			return fmt.Errorf("error creando grupo de traducciones: %v", err)
+		}
+		termID, _ := result.LastInsertId()
+
+		query = fmt.Sprintf(`
+			INSERT INTO %sterm_taxonomy (term_id, taxonomy, description, parent, count)
+			VALUES (?, ?, '', 0, 0)`,
+			wp.tablePrefix)
+		result, err = tx.Exec(query, termID, pllTranslationsTaxonomy)
+		if err != nil {
+			return fmt.Errorf("error creando grupo de traducciones: %v", err)
+		}
+		group.TermTaxonomyID, _ = result.LastInsertId()
+
+		if err := wp.pllAddRelationship(tx, sourceID, group.TermTaxonomyID); err != nil {
+			return err
+		}
+	}
+
+	if existing, ok := group.Posts[lang]; ok && existing != translatedID {
+		return fmt.Errorf("el grupo Polylang de %d ya tiene una traduccion '%s' (post %d)", sourceID, lang, existing)
+	}
+	if _, ok := group.Posts[lang]; !ok {
+		group.Langs = append(group.Langs, lang)
+	}
+	group.Posts[lang] = translatedID
+
+	query := fmt.Sprintf(`UPDATE %sterm_taxonomy SET description = ? WHERE term_taxonomy_id = ?`, wp.tablePrefix)
+	if _, err := tx.Exec(query, phpSerializeLangMap(group.Langs, group.Posts, group.Extra), group.TermTaxonomyID); err != nil {
+		return fmt.Errorf("error actualizando grupo de traducciones: %v", err)
+	}
+	if err := wp.pllAddRelationship(tx, translatedID, group.TermTaxonomyID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return nil
+}
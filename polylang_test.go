@@ -0,0 +1,229 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPHPLangMapRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		langs []string
+		posts map[string]int64
+		extra []string
+	}{
+		{"empty", "", nil, map[string]int64{}, nil},
+		{"two posts", `a:2:{s:2:"es";i:10;s:2:"en";i:11;}`, []string{"es", "en"}, map[string]int64{"es": 10, "en": 11}, nil},
+		{"regional slug", `a:2:{s:5:"pt-br";i:7;s:2:"es";i:8;}`, []string{"pt-br", "es"}, map[string]int64{"pt-br": 7, "es": 8}, nil},
+		{
+			"polylang pro sync",
+			`a:3:{s:2:"es";i:10;s:4:"sync";a:1:{s:2:"en";s:2:"es";}s:2:"en";i:11;}`,
+			[]string{"es", "en"}, map[string]int64{"es": 10, "en": 11},
+			[]string{`s:4:"sync";a:1:{s:2:"en";s:2:"es";}`},
+		},
+		{
+			"other value types",
+			`a:4:{s:2:"es";i:10;i:0;s:1:"x";s:1:"b";b:1;s:1:"o";O:8:"stdClass":1:{s:1:"a";d:1.5;}}`,
+			[]string{"es"}, map[string]int64{"es": 10},
+			[]string{`i:0;s:1:"x";`, `s:1:"b";b:1;`, `s:1:"o";O:8:"stdClass":1:{s:1:"a";d:1.5;}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			langs, posts, extra, err := phpUnserializeLangMap(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(langs, tt.langs) || !reflect.DeepEqual(posts, tt.posts) || !reflect.DeepEqual(extra, tt.extra) {
+				t.Fatalf("got %v %v %q, want %v %v %q", langs, posts, extra, tt.langs, tt.posts, tt.extra)
+			}
+
+			// Serializing keeps every entry; parsing it again gives the same map
+			out := phpSerializeLangMap(langs, posts, extra)
+			langs2, posts2, extra2, err := phpUnserializeLangMap(out)
+			if err != nil {
+				t.Fatalf("reparsing %s: %v", out, err)
+			}
+			if !reflect.DeepEqual(langs2, langs) || !reflect.DeepEqual(posts2, posts) || !reflect.DeepEqual(extra2, extra) {
+				t.Errorf("round trip of %s changed the map", out)
+			}
+		})
+	}
+}
+
+func TestPHPLangMapStringIDs(t *testing.T) {
+	langs, posts, _, err := phpUnserializeLangMap(`a:1:{s:2:"fr";s:2:"42";}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(langs) != 1 || posts["fr"] != 42 {
+		t.Errorf("got %v %v", langs, posts)
+	}
+	if got := phpSerializeLangMap(langs, posts, nil); got != `a:1:{s:2:"fr";i:42;}` {
+		t.Errorf("serialized as %s", got)
+	}
+}
+
+func TestPHPLangMapMalformed(t *testing.T) {
+	for _, data := range []string{
+		`s:2:"es";`,
+		`a:1:{s:2:"es";i:10;`,
+		`a:2:{s:2:"es";i:10;}`,
+		`a:1:{s:9:"es";i:10;}`,
+		`a:1:{s:2:"es"i:10;}`,
+		`a:1:{s:2:"es";i:10}`,
+		`a:1:{s:2:"es";x:10;}`,
+		`a:1:{s:4:"sync";a:1:{s:2:"en";s:2:"es";}`,
+		`a:1:{s:2:"es";i:10;}garbage`,
+		`a:-1:{}`,
+		`a:1:{s:`,
+	} {
+		if _, _, _, err := phpUnserializeLangMap(data); err == nil {
+			t.Errorf("%q: expected an error", data)
+		} else if !strings.Contains(err.Error(), "Polylang") {
+			t.Errorf("%q: error %v", data, err)
+		}
+	}
+}
+
+// openPolylangDB loads the WPML fixture, which creates the posts, and the
+// Polylang one, which drops the WPML table
+func openPolylangDB(t *testing.T) *WordPressDB {
+	t.Helper()
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql", "test/fixtures/wordpress_polylang.sql")
+	if got := wp.Multilingual(); got != multilingualPolylang {
+		t.Fatalf("Multilingual() = %q, want %q", got, multilingualPolylang)
+	}
+	return wp
+}
+
+// pllDescription returns the serialized group of a post
+func pllDescription(t *testing.T, wp *WordPressDB, postID int64) string {
+	t.Helper()
+	_, _, description, err := wp.pllPostTerm(wp.db, postID, pllTranslationsTaxonomy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return description
+}
+
+func TestPolylangExistingTranslation(t *testing.T) {
+	wp := openPolylangDB(t)
+
+	translations, err := wp.PolylangTranslations(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 2 || translations[0].Language != "en" || translations[0].PostID != 11 ||
+		translations[1].Language != "es" || translations[1].PostID != 10 {
+		t.Fatalf("unexpected group: %+v", translations)
+	}
+
+	if id, err := wp.FindTranslation(10, "en"); err != nil || id != 11 {
+		t.Errorf("FindTranslation(10, en) = %d, %v, want 11", id, err)
+	}
+	if id, _ := wp.FindTranslation(10, "fr"); id != 0 {
+		t.Errorf("FindTranslation(10, fr) = %d, want 0", id)
+	}
+
+	// A post with a language but no group is its own only translation
+	translations, err = wp.PolylangTranslations(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 1 || translations[0].PostID != 20 || translations[0].Language != "es" {
+		t.Errorf("post without group: %+v", translations)
+	}
+}
+
+func TestPolylangLinkNewTranslation(t *testing.T) {
+	wp := openPolylangDB(t)
+
+	newID, err := wp.CreateTranslatedCopy(20, "Services", "services", "", "[et_pb_section][/et_pb_section]", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := wp.LinkTranslation(20, newID, "en", "es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !linked {
+		t.Fatal("LinkTranslation did not use Polylang")
+	}
+
+	if id, err := wp.FindTranslation(20, "en"); err != nil || id != newID {
+		t.Errorf("FindTranslation(20, en) = %d, %v, want %d", id, err, newID)
+	}
+	if id, err := wp.FindTranslation(newID, "es"); err != nil || id != 20 {
+		t.Errorf("FindTranslation(%d, es) = %d, %v, want 20", newID, id, err)
+	}
+
+	// Linking the same post again leaves the group as it is
+	before := pllDescription(t, wp, 20)
+	if err := wp.PolylangLinkTranslation(20, newID, "en", "es"); err != nil {
+		t.Errorf("relinking the same translation: %v", err)
+	}
+	if after := pllDescription(t, wp, 20); after != before {
+		t.Errorf("group changed from %s to %s", before, after)
+	}
+}
+
+func TestPolylangLinkKeepsSyncEntry(t *testing.T) {
+	wp := openPolylangDB(t)
+
+	// Polylang Pro stores the synchronized translations in the group
+	sync := `s:4:"sync";a:1:{s:2:"en";s:2:"es";}`
+	if _, err := wp.db.Exec(`UPDATE wp_term_taxonomy SET description = ? WHERE term_taxonomy_id = 4`,
+		`a:3:{s:2:"es";i:10;s:2:"en";i:11;`+sync+`}`); err != nil {
+		t.Fatal(err)
+	}
+
+	newID, err := wp.CreateTranslatedCopy(10, "Accueil", "accueil", "", "", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.PolylangLinkTranslation(10, newID, "fr", "es"); err != nil {
+		t.Fatal(err)
+	}
+
+	description := pllDescription(t, wp, 10)
+	if !strings.Contains(description, sync) {
+		t.Errorf("sync entry lost: %s", description)
+	}
+	_, posts, extra, err := phpUnserializeLangMap(description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posts["es"] != 10 || posts["en"] != 11 || posts["fr"] != newID || len(extra) != 1 {
+		t.Errorf("unexpected group: %s", description)
+	}
+}
+
+func TestPolylangLinkDuplicateLanguage(t *testing.T) {
+	wp := openPolylangDB(t)
+
+	newID, err := wp.CreateTranslatedCopy(10, "Home", "home", "", "", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Post 11 already is the English version of post 10
+	err = wp.PolylangLinkTranslation(10, newID, "en", "es")
+	if err == nil || !strings.Contains(err.Error(), "ya tiene una traduccion 'en' (post 11)") {
+		t.Errorf("duplicate language: got %v", err)
+	}
+	if err := wp.PolylangLinkTranslation(10, newID, "es", "es"); err == nil {
+		t.Error("linking in the language of the source should fail")
+	}
+	if err := wp.PolylangLinkTranslation(10, newID, "de", "es"); err == nil {
+		t.Error("linking in a language not configured in Polylang should fail")
+	}
+
+	// Nothing was registered for the copy
+	if translations, _ := wp.PolylangTranslations(newID); translations != nil {
+		t.Errorf("copy was linked: %+v", translations)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PostSaveHook runs after a post has been written (translated in place, saved
+// as a copy or restored). It returns the actions it took, one line each, for
+// the save report. The post is already saved, so an error is only reported.
+type PostSaveHook func(postID int64) ([]string, error)
+
+// namedPostSaveHook is a registered hook
+type namedPostSaveHook struct {
+	name string
+	run  PostSaveHook
+}
+
+// AddPostSaveHook registers a hook; hooks run in registration order
+func (wp *WordPressDB) AddPostSaveHook(name string, hook PostSaveHook) {
+	wp.saveHooks = append(wp.saveHooks, namedPostSaveHook{name: name, run: hook})
+}
+
+// registerDefaultHooks installs the built-in hooks enabled by the environment
+func (wp *WordPressDB) registerDefaultHooks() {
+	if diviCacheClearEnabled() {
+		wp.AddPostSaveHook("cache Divi", wp.clearDiviCache)
+	}
+}
+
+// RunPostSaveHooks runs every hook for a saved post and returns the actions
+// taken; a failing hook adds a warning line and does not stop the others
+func (wp *WordPressDB) RunPostSaveHooks(postID int64) []string {
+	var actions []string
+	for _, hook := range wp.saveHooks {
+		done, err := hook.run(postID)
+		for _, action := range done {
+			actions = append(actions, fmt.Sprintf("%s: %s", hook.name, action))
+		}
+		if err != nil {
+			actions = append(actions, fmt.Sprintf("AVISO %s: %v", hook.name, err))
+		}
+	}
+	return actions
+}
+
+// formatSaveActions formats the post-save actions for a save report
+func formatSaveActions(actions []string) string {
+	if len(actions) == 0 {
+		return ""
+	}
+	return "\n\nACCIONES TRAS GUARDAR:\n- " + strings.Join(actions, "\n- ")
+}
+
+// --- Divi cache ---
+
+// diviCacheMetaKeys are the postmeta keys where Divi caches data derived from
+// the post content. Builder settings (_et_pb_use_builder, _et_pb_page_layout,
+// ...) are not caches and are never touched.
+var diviCacheMetaKeys = []string{
+	"_et_dynamic_cached_shortcodes",
+	"_et_dynamic_cached_attributes",
+	"_et_builder_module_features_cache",
+	"_et_builder_dynamic_assets_loading_attr_threshold",
+	"et_enqueued_post_fonts",
+}
+
+// diviCacheMetaPattern catches the other cache keys of Divi and its modules
+const diviCacheMetaPattern = `\_et\_%cache%`
+
+// diviCacheClearEnabled reads DIVI_CACHE_CLEAR (default true)
+func diviCacheClearEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("DIVI_CACHE_CLEAR"))) {
+	case "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// diviCacheCleared counts what a cache clear removed
+type diviCacheCleared struct {
+	meta    int64
+	options int64
+	files   int
+}
+
+func (c *diviCacheCleared) add(o diviCacheCleared) {
+	c.meta += o.meta
+	c.options += o.options
+	c.files += o.files
+}
+
+// actions describes the cleared caches for the save report; scope names the
+// posts whose caches were cleared and dir where the files were removed
+func (c diviCacheCleared) actions(scope, dir string) []string {
+	var actions []string
+	if c.meta > 0 {
+		actions = append(actions, fmt.Sprintf("%d postmeta de cache borrados (%s)", c.meta, scope))
+	}
+	if c.options > 0 {
+		actions = append(actions, fmt.Sprintf("%d opciones/transients et_core_page_resource borrados (%s)", c.options, scope))
+	}
+	if c.files > 0 {
+		actions = append(actions, fmt.Sprintf("%d archivos borrados de %s", c.files, dir))
+	}
+	return actions
+}
+
+// clearDiviCache deletes the Divi caches that depend on a saved post so the
+// frontend is rebuilt from the new content. A Theme Builder layout is
+// rendered on every page it is assigned to, so it clears the whole site
+// cache; a Divi Library item also clears the pages that use it as a global
+// module; any other post only clears its own cache.
+func (wp *WordPressDB) clearDiviCache(postID int64) ([]string, error) {
+	var postType string
+	query := fmt.Sprintf(`SELECT post_type FROM %sposts WHERE ID = ?`, wp.tablePrefix)
+	if err := wp.db.QueryRow(query, postID).Scan(&postType); err != nil {
+		return nil, fmt.Errorf("error leyendo el tipo del post %d: %v", postID, err)
+	}
+
+	var actions []string
+	switch postType {
+	case postTypeTemplate, postTypeHeaderLayout, postTypeBodyLayout, postTypeFooterLayout:
+		cleared, err := wp.clearSiteDiviCache()
+		actions = cleared.actions("todo el sitio, plantilla del Theme Builder", os.Getenv("DIVI_CACHE_DIR"))
+		if err != nil {
+			return actions, err
+		}
+
+	case postTypeLibrary:
+		cleared, err := wp.clearPostDiviCache(postID)
+		actions = cleared.actions(fmt.Sprintf("post %d", postID), filepath.Join(os.Getenv("DIVI_CACHE_DIR"), strconv.FormatInt(postID, 10)))
+		if err != nil {
+			return actions, err
+		}
+		users, err := wp.GlobalModuleUsers(postID)
+		if err != nil {
+			return actions, err
+		}
+		var total diviCacheCleared
+		for _, user := range users {
+			cleared, userErr := wp.clearPostDiviCache(user)
+			total.add(cleared)
+			if userErr != nil {
+				err = userErr
+				break
+			}
+		}
+		actions = append(actions, total.actions(fmt.Sprintf("%d posts que usan el modulo global", len(users)), os.Getenv("DIVI_CACHE_DIR"))...)
+		if err != nil {
+			return actions, err
+		}
+
+	default:
+		cleared, err := wp.clearPostDiviCache(postID)
+		actions = cleared.actions(fmt.Sprintf("post %d", postID), filepath.Join(os.Getenv("DIVI_CACHE_DIR"), strconv.FormatInt(postID, 10)))
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	if len(actions) == 0 {
+		actions = append(actions, "sin cache que borrar")
+	}
+	return actions, nil
+}
+
+// clearPostDiviCache deletes the caches of one post: the cache postmeta, the
+// et_core_page_resource options and transients of the post and, when
+// DIVI_CACHE_DIR points to wp-content/et-cache, the post's static CSS/JS files
+func (wp *WordPressDB) clearPostDiviCache(postID int64) (diviCacheCleared, error) {
+	var cleared diviCacheCleared
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(diviCacheMetaKeys)), ", ")
+	query := fmt.Sprintf(`
+		DELETE FROM %spostmeta
+		WHERE post_id = ? AND (meta_key IN (%s) OR meta_key LIKE ?)`,
+		wp.tablePrefix, placeholders)
+	args := []interface{}{postID}
+	for _, key := range diviCacheMetaKeys {
+		args = append(args, key)
+	}
+	args = append(args, diviCacheMetaPattern)
+	result, err := wp.db.Exec(query, args...)
+	if err != nil {
+		return cleared, fmt.Errorf("error borrando postmeta de cache: %v", err)
+	}
+	cleared.meta, _ = result.RowsAffected()
+
+	// Page resources are named after the post ("et-divi-dynamic-123-late");
+	// the timeout rows of the transients go with them
+	id := strconv.FormatInt(postID, 10)
+	query = fmt.Sprintf(`
+		DELETE FROM %soptions
+		WHERE (%s)
+		  AND (option_name LIKE ? OR option_name LIKE ? OR option_name LIKE ? OR option_name LIKE ?)`,
+		wp.tablePrefix, pageResourceCondition)
+	result, err = wp.db.Exec(query, "%-"+id+"-%", "%-"+id, `%\_`+id+`\_%`, `%\_`+id)
+	if err != nil {
+		return cleared, fmt.Errorf("error borrando opciones et_core_page_resource: %v", err)
+	}
+	cleared.options, _ = result.RowsAffected()
+
+	cleared.files, err = removeDiviCacheFiles(postID)
+	return cleared, err
+}
+
+// pageResourceCondition matches the et_core_page_resource options and their
+// transients
+const pageResourceCondition = `option_name LIKE 'et\_core\_page\_resource%'
+		    OR option_name LIKE '\_transient\_et\_core\_page\_resource%'
+		    OR option_name LIKE '\_transient\_timeout\_et\_core\_page\_resource%'`
+
+// clearSiteDiviCache deletes the Divi caches of every post, all the
+// et_core_page_resource options and transients and the whole DIVI_CACHE_DIR
+func (wp *WordPressDB) clearSiteDiviCache() (diviCacheCleared, error) {
+	var cleared diviCacheCleared
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(diviCacheMetaKeys)), ", ")
+	query := fmt.Sprintf(`
+		DELETE FROM %spostmeta
+		WHERE meta_key IN (%s) OR meta_key LIKE ?`,
+		wp.tablePrefix, placeholders)
+	var args []interface{}
+	for _, key := range diviCacheMetaKeys {
+		args = append(args, key)
+	}
+	args = append(args, diviCacheMetaPattern)
+	result, err := wp.db.Exec(query, args...)
+	if err != nil {
+		return cleared, fmt.Errorf("error borrando postmeta de cache: %v", err)
+	}
+	cleared.meta, _ = result.RowsAffected()
+
+	query = fmt.Sprintf(`DELETE FROM %soptions WHERE %s`, wp.tablePrefix, pageResourceCondition)
+	result, err = wp.db.Exec(query)
+	if err != nil {
+		return cleared, fmt.Errorf("error borrando opciones et_core_page_resource: %v", err)
+	}
+	cleared.options, _ = result.RowsAffected()
+
+	cleared.files, err = removeAllDiviCacheFiles()
+	return cleared, err
+}
+
+// removeDiviCacheFiles deletes <DIVI_CACHE_DIR>/<postID>, where Divi writes
+// the static CSS and JS of a post. It returns how many files were removed.
+func removeDiviCacheFiles(postID int64) (int, error) {
+	base := strings.TrimSpace(os.Getenv("DIVI_CACHE_DIR"))
+	if base == "" {
+		return 0, nil
+	}
+	dir := filepath.Join(base, strconv.FormatInt(postID, 10))
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return 0, fmt.Errorf("%s no es un directorio", dir)
+	}
+
+	files := 0
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			files++
+		}
+		return nil
+	})
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, fmt.Errorf("error borrando %s: %v", dir, err)
+	}
+	return files, nil
+}
+
+// removeAllDiviCacheFiles empties DIVI_CACHE_DIR, keeping the directory
+// itself. It returns how many files were removed.
+func removeAllDiviCacheFiles() (int, error) {
+	base := strings.TrimSpace(os.Getenv("DIVI_CACHE_DIR"))
+	if base == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error leyendo %s: %v", base, err)
+	}
+
+	files := 0
+	for _, entry := range entries {
+		path := filepath.Join(base, entry.Name())
+		filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				files++
+			}
+			return nil
+		})
+		if err := os.RemoveAll(path); err != nil {
+			return files, fmt.Errorf("error borrando %s: %v", path, err)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveAllDiviCacheFiles(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("DIVI_CACHE_DIR", base)
+	for _, name := range []string{"12/et-divi-dynamic-12-late.css", "12/et-core-unified-12.min.css", "global/et-divi-customizer-global.min.css"} {
+		path := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("body{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := removeAllDiviCacheFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("removed %d files, want 3", removed)
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatalf("the cache directory itself must be kept: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d entries left in the cache directory", len(entries))
+	}
+
+	t.Setenv("DIVI_CACHE_DIR", filepath.Join(base, "missing"))
+	if removed, err := removeAllDiviCacheFiles(); removed != 0 || err != nil {
+		t.Errorf("missing directory: got %d, %v", removed, err)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SEOMetaField is a postmeta field translated with the post metadata
+type SEOMetaField struct {
+	Key       string // meta_key
+	Label     string
+	MaxLength int // Recommended maximum in characters (variables excluded), 0 if none
+}
+
+// defaultSEOMetaFields are the Yoast SEO and Rank Math fields holding text
+var defaultSEOMetaFields = []SEOMetaField{
+	{Key: "_yoast_wpseo_title", Label: "Titulo SEO (Yoast)"},
+	{Key: "_yoast_wpseo_metadesc", Label: "Meta descripcion (Yoast)", MaxLength: 156},
+	{Key: "_yoast_wpseo_focuskw", Label: "Frase clave (Yoast)"},
+	{Key: "_yoast_wpseo_opengraph-title", Label: "Titulo OpenGraph (Yoast)"},
+	{Key: "_yoast_wpseo_opengraph-description", Label: "Descripcion OpenGraph (Yoast)"},
+	{Key: "_yoast_wpseo_twitter-title", Label: "Titulo Twitter (Yoast)"},
+	{Key: "_yoast_wpseo_twitter-description", Label: "Descripcion Twitter (Yoast)"},
+	{Key: "rank_math_title", Label: "Titulo SEO (Rank Math)"},
+	{Key: "rank_math_description", Label: "Meta descripcion (Rank Math)", MaxLength: 160},
+	{Key: "rank_math_focus_keyword", Label: "Palabras clave (Rank Math, separadas por comas)"},
+	{Key: "rank_math_facebook_title", Label: "Titulo Facebook (Rank Math)"},
+	{Key: "rank_math_facebook_description", Label: "Descripcion Facebook (Rank Math)"},
+	{Key: "rank_math_twitter_title", Label: "Titulo Twitter (Rank Math)"},
+	{Key: "rank_math_twitter_description", Label: "Descripcion Twitter (Rank Math)"},
+}
+
+// AddSEOMetaField registers a postmeta field to translate; a field with the
+// same key replaces the previous one
+func (wp *WordPressDB) AddSEOMetaField(field SEOMetaField) {
+	for i := range wp.seoFields {
+		if wp.seoFields[i].Key == field.Key {
+			wp.seoFields[i] = field
+			return
+		}
+	}
+	wp.seoFields = append(wp.seoFields, field)
+}
+
+// registerDefaultSEOFields installs the Yoast and Rank Math fields plus the
+// ones listed in SEO_META_FIELDS ("meta_key" or "meta_key:maxLength",
+// separated by commas)
+func (wp *WordPressDB) registerDefaultSEOFields() {
+	for _, field := range defaultSEOMetaFields {
+		wp.AddSEOMetaField(field)
+	}
+	for _, item := range strings.Split(os.Getenv("SEO_META_FIELDS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field := SEOMetaField{Key: item, Label: item}
+		if i := strings.LastIndex(item, ":"); i > 0 {
+			if n, err := strconv.Atoi(item[i+1:]); err == nil {
+				field = SEOMetaField{Key: item[:i], Label: item[:i], MaxLength: n}
+			}
+		}
+		wp.AddSEOMetaField(field)
+	}
+}
+
+// SEOMetaValue is a field of a post in a session, with its translation
+type SEOMetaValue struct {
+	Key        string `json:"key"`
+	Label      string `json:"label"`
+	MaxLength  int    `json:"maxLength,omitempty"`
+	Original   string `json:"original"`
+	Translated string `json:"translated,omitempty"`
+}
+
+// seoVariablePattern matches the snippet variables of Yoast (%%title%%) and
+// Rank Math (%sep%, %customfield(name)%), which must not be translated
+var seoVariablePattern = regexp.MustCompile(`%%[\w-]+%%|%[a-z_]+(?:\([^()%]*\))?%`)
+
+// seoMetaHasText reports whether a value has text to translate once its
+// variables are removed ("%%title%% %%sep%% %%sitename%%" has none)
+func seoMetaHasText(value string) bool {
+	for _, r := range seoVariablePattern.ReplaceAllString(value, "") {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// seoMetaLength counts the characters of a value without its variables
+func seoMetaLength(value string) int {
+	return utf8.RuneCountInString(strings.TrimSpace(seoVariablePattern.ReplaceAllString(value, "")))
+}
+
+// GetSEOMeta returns the registered fields of a post that have text to
+// translate, in registration order
+func (wp *WordPressDB) GetSEOMeta(postID int64) ([]SEOMetaValue, error) {
+	meta, err := wp.GetPostMeta(postID)
+	if err != nil {
+		return nil, err
+	}
+	return wp.seoMetaFrom(meta, true), nil
+}
+
+// seoMetaFrom picks the registered fields out of a post's postmeta (first
+// row of each key); with textOnly, fields without translatable text are left out
+func (wp *WordPressDB) seoMetaFrom(meta []PostMeta, textOnly bool) []SEOMetaValue {
+	values := make(map[string]string)
+	for _, m := range meta {
+		if _, ok := values[m.Key]; !ok {
+			values[m.Key] = m.Value
+		}
+	}
+	var fields []SEOMetaValue
+	for _, f := range wp.seoFields {
+		value, ok := values[f.Key]
+		if !ok || (textOnly && !seoMetaHasText(value)) {
+			continue
+		}
+		fields = append(fields, SEOMetaValue{Key: f.Key, Label: f.Label, MaxLength: f.MaxLength, Original: value})
+	}
+	return fields
+}
+
+// updatePostMetaValues writes single-valued postmeta inside tx, adding the
+// keys the post does not have yet
+func (wp *WordPressDB) updatePostMetaValues(tx *sql.Tx, postID int64, meta map[string]string) error {
+	for key, value := range meta {
+		var count int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %spostmeta WHERE post_id = ? AND meta_key = ?`, wp.tablePrefix)
+		if err := tx.QueryRow(query, postID, key).Scan(&count); err != nil {
+			return fmt.Errorf("error leyendo postmeta %s: %v", key, err)
+		}
+		if count > 0 {
+			query = fmt.Sprintf(`UPDATE %spostmeta SET meta_value = ? WHERE post_id = ? AND meta_key = ?`, wp.tablePrefix)
+		} else {
+			query = fmt.Sprintf(`INSERT INTO %spostmeta (meta_value, post_id, meta_key) VALUES (?, ?, ?)`, wp.tablePrefix)
+		}
+		if _, err := tx.Exec(query, value, postID, key); err != nil {
+			return fmt.Errorf("error guardando postmeta %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// seoMetaUpdates returns the translated fields of a session that differ from
+// the original, ready for the update functions
+func seoMetaUpdates(session *BulkTranslationSession) map[string]string {
+	var meta map[string]string
+	for _, f := range session.SEOMeta {
+		if f.Translated == "" || f.Translated == f.Original {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[f.Key] = f.Translated
+	}
+	return meta
+}
+
+// seoMetaMarkers returns the opening and closing markers of a field
+func seoMetaMarkers(key string) (string, string) {
+	return "{{META:" + key + "}}", "{{/META:" + key + "}}"
+}
+
+// formatSEOMetaSection lists the SEO fields in the metadata section of the
+// first part
+func formatSEOMetaSection(fields []SEOMetaValue) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`METADATOS SEO (traducir tambien; conserva las variables como %%title%%,
+%%sitename%% o %sep% tal cual):
+
+`)
+	for _, f := range fields {
+		openMarker, closeMarker := seoMetaMarkers(f.Key)
+		if f.MaxLength > 0 {
+			b.WriteString(fmt.Sprintf("%s, maximo %d caracteres (ahora %d):\n", f.Label, f.MaxLength, seoMetaLength(f.Original)))
+		} else {
+			b.WriteString(f.Label + ":\n")
+		}
+		b.WriteString(fmt.Sprintf("%s\n%s\n%s\n\n", openMarker, f.Original, closeMarker))
+	}
+	return b.String()
+}
+
+// parseSEOMeta reads the translated SEO fields; a missing field keeps its
+// original value
+func parseSEOMeta(session *BulkTranslationSession, text string) {
+	for i := range session.SEOMeta {
+		f := &session.SEOMeta[i]
+		openMarker, closeMarker := seoMetaMarkers(f.Key)
+		if start := strings.Index(text, openMarker); start != -1 {
+			if end := strings.Index(text, closeMarker); end > start {
+				f.Translated = strings.TrimSpace(text[start+len(openMarker) : end])
+			}
+		}
+		if f.Translated == "" {
+			f.Translated = f.Original
+		}
+	}
+}
+
+// validateSEOMeta checks the translated SEO fields: variables must be kept
+// and meta descriptions should fit the length shown in search results
+func validateSEOMeta(session *BulkTranslationSession) *ValidationReport {
+	report := &ValidationReport{}
+	for _, f := range session.SEOMeta {
+		if f.Translated == "" {
+			continue
+		}
+		missing := missingFrom(countStrings(seoVariablePattern.FindAllString(f.Original, -1)),
+			countStrings(seoVariablePattern.FindAllString(f.Translated, -1)))
+		if len(missing) > 0 {
+			report.add(0, "seo", true, "%s: faltan las variables %s", f.Key, strings.Join(missing, ", "))
+		}
+		if f.MaxLength > 0 {
+			if n := seoMetaLength(f.Translated); n > f.MaxLength {
+				report.add(0, "seo", false, "%s: %d caracteres, maximo recomendado %d (original: %d); se cortara en los resultados de busqueda",
+					f.Key, n, f.MaxLength, seoMetaLength(f.Original))
+			}
+		}
+	}
+	return report
+}
+
+// rebaseSEOMeta keeps the translation of the fields whose original value did
+// not change
+func rebaseSEOMeta(previous, current []SEOMetaValue) []SEOMetaValue {
+	translated := make(map[string]SEOMetaValue)
+	for _, f := range previous {
+		translated[f.Key] = f
+	}
+	for i := range current {
+		if old, ok := translated[current[i].Key]; ok && old.Original == current[i].Original {
+			current[i].Translated = old.Translated
+		}
+	}
+	return current
+}
+
+// formatSEOMetaSaved lists the SEO fields written by a save, as a line of
+// the updated fields of a report
+func formatSEOMetaSaved(meta map[string]string) string {
+	if len(meta) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("\n- SEO: %s", strings.Join(keys, ", "))
+}
+
+// protectSEOVariables wraps the variables of a value in untranslatable spans
+// before machine translation; unprotectSEOVariables removes them
+func protectSEOVariables(value string) string {
+	return seoVariablePattern.ReplaceAllString(value, `<span translate="no">$0</span>`)
+}
+
+var protectedSEOVariablePattern = regexp.MustCompile(`<span translate="no">\s*(.*?)\s*</span>`)
+
+func unprotectSEOVariables(value string) string {
+	return protectedSEOVariablePattern.ReplaceAllString(value, "$1")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSEOVariablePattern(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		hasText bool
+		length  int
+	}{
+		{"%%title%% %%sep%% %%sitename%%", []string{"%%title%%", "%%sep%%", "%%sitename%%"}, false, 0},
+		{"%title% %sep% %sitename%", []string{"%title%", "%sep%", "%sitename%"}, false, 0},
+		{"Precio: %customfield(precio_base)% euros", []string{"%customfield(precio_base)%"}, true, 14},
+		{"%%cf_mi-campo%% y %%ct_product_cat%%", []string{"%%cf_mi-campo%%", "%%ct_product_cat%%"}, true, 1},
+		{"Descuento del 20% en %%title%%", []string{"%%title%%"}, true, 20},
+		{"Hasta un 10%de descuento %", nil, true, 26},
+		{"Nuestra mision", nil, true, 14},
+		{"Mision y vision", nil, true, 15},
+	}
+	for _, tt := range tests {
+		if got := seoVariablePattern.FindAllString(tt.value, -1); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("variables of %q = %q, want %q", tt.value, got, tt.want)
+		}
+		if got := seoMetaHasText(tt.value); got != tt.hasText {
+			t.Errorf("seoMetaHasText(%q) = %v, want %v", tt.value, got, tt.hasText)
+		}
+		if got := seoMetaLength(tt.value); got != tt.length {
+			t.Errorf("seoMetaLength(%q) = %d, want %d", tt.value, got, tt.length)
+		}
+	}
+}
+
+func TestParseSEOMeta(t *testing.T) {
+	session := &BulkTranslationSession{SEOMeta: []SEOMetaValue{
+		{Key: "_yoast_wpseo_title", Original: "Mision %%sep%% %%sitename%%"},
+		{Key: "_yoast_wpseo_metadesc", Original: "Conoce nuestra mision"},
+		{Key: "rank_math_title", Original: "Mision %sep% %sitename%"},
+	}}
+	text := `{{TITLE}}Mission{{/TITLE}}
+{{META:_yoast_wpseo_title}}
+  Mission %%sep%% %%sitename%%
+{{/META:_yoast_wpseo_title}}
+{{META:rank_math_title}}   {{/META:rank_math_title}}
+`
+	parseSEOMeta(session, text)
+
+	want := []string{
+		"Mission %%sep%% %%sitename%%",
+		"Conoce nuestra mision", // Missing: kept as is
+		"Mision %sep% %sitename%",
+	}
+	for i, f := range session.SEOMeta {
+		if f.Translated != want[i] {
+			t.Errorf("%s = %q, want %q", f.Key, f.Translated, want[i])
+		}
+	}
+}
+
+func TestValidateSEOMeta(t *testing.T) {
+	title := SEOMetaValue{Key: "_yoast_wpseo_title", Original: "Mision %%sep%% %%sitename%%"}
+	metadesc := SEOMetaValue{Key: "_yoast_wpseo_metadesc", MaxLength: 156, Original: "Conoce nuestra mision %%sep%% %%sitename%%"}
+	rankMath := SEOMetaValue{Key: "rank_math_title", Original: "%customfield(marca)% %sep% Mision"}
+	long := strings.Repeat("a", 150)
+
+	tests := []struct {
+		name       string
+		field      SEOMetaValue
+		translated string
+		want       []string
+		message    string
+	}{
+		{"variables kept", title, "Mission %%sep%% %%sitename%%", nil, ""},
+		{"variables moved", title, "%%sitename%% %%sep%% Mission", nil, ""},
+		{"variable lost", title, "Mission %%sep%%", []string{"seo!"}, "%%sitename%%"},
+		{"variable translated", title, "Mission %%sep%% %%nombredelsitio%%", []string{"seo!"}, "%%sitename%%"},
+		{"rank math variables kept", rankMath, "%customfield(marca)% %sep% Mission", nil, ""},
+		{"custom field renamed", rankMath, "%customfield(brand)% %sep% Mission", []string{"seo!"}, "%customfield(marca)%"},
+		{"untranslated", title, "", nil, ""},
+		{"description within the limit", metadesc, long + " %%sep%% %%sitename%%", nil, ""},
+		{"description too long", metadesc, long + " textos %%sep%% %%sitename%%", []string{"seo?"}, "157 caracteres, maximo recomendado 156"},
+		{"no limit", title, long + long + " %%sep%% %%sitename%%", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.field
+			f.Translated = tt.translated
+			report := validateSEOMeta(&BulkTranslationSession{SEOMeta: []SEOMetaValue{f}})
+			if got := issueKinds(report); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("issues = %q, want %q\n%s", got, tt.want, report.String())
+			}
+			if tt.message != "" && !strings.Contains(report.String(), tt.message) {
+				t.Errorf("report does not mention %q:\n%s", tt.message, report.String())
+			}
+		})
+	}
+}
+
+func TestProtectSEOVariables(t *testing.T) {
+	tests := []struct {
+		value     string
+		protected string
+	}{
+		{"Mision %%sep%% %%sitename%%", `Mision <span translate="no">%%sep%%</span> <span translate="no">%%sitename%%</span>`},
+		{"%customfield(marca)% %sep% Mision", `<span translate="no">%customfield(marca)%</span> <span translate="no">%sep%</span> Mision`},
+		{"Descuento del 20%", "Descuento del 20%"},
+	}
+	for _, tt := range tests {
+		protected := protectSEOVariables(tt.value)
+		if protected != tt.protected {
+			t.Errorf("protectSEOVariables(%q) = %q, want %q", tt.value, protected, tt.protected)
+		}
+		if got := unprotectSEOVariables(protected); got != tt.value {
+			t.Errorf("unprotectSEOVariables(%q) = %q, want %q", protected, got, tt.value)
+		}
+	}
+
+	// Machine translators may pad the protected spans with spaces
+	translated := `Mission <span translate="no"> %%sep%% </span> <span translate="no">%%sitename%%</span>`
+	if got := unprotectSEOVariables(translated); got != "Mission %%sep%% %%sitename%%" {
+		t.Errorf("unprotectSEOVariables(%q) = %q", translated, got)
+	}
+}
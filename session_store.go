@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionStateVersion is the format version of persisted session files
+const sessionStateVersion = 1
+
+// defaultSessionMaxAge is how long an untouched extraction is kept
+const defaultSessionMaxAge = 7 * 24 * time.Hour
+
+// maxSessionReapInterval bounds how often abandoned extractions are checked
+const maxSessionReapInterval = 10 * time.Minute
+
+// persistedSession is the on-disk form of a bulk session. The shortcode tree
+// and tokens are not stored: they are rebuilt from Source on reload.
+type persistedSession struct {
+	Version int                     `json:"version"`
+	SavedAt time.Time               `json:"savedAt"`
+	Source  string                  `json:"source"`
+	Session *BulkTranslationSession `json:"session"`
+}
+
+// sessionStateDir returns the directory for persisted sessions (SESSION_STATE_DIR,
+// default "sessions" next to the executable), or "" if SESSION_PERSIST=false
+func sessionStateDir() string {
+	if strings.EqualFold(os.Getenv("SESSION_PERSIST"), "false") {
+		return ""
+	}
+	if dir := os.Getenv("SESSION_STATE_DIR"); dir != "" {
+		return dir
+	}
+	exePath, _ := os.Executable()
+	return filepath.Join(filepath.Dir(exePath), "sessions")
+}
+
+// sessionMaxAge reads SESSION_MAX_AGE (days, or a duration like 12h)
+func sessionMaxAge() time.Duration {
+	if age, err := parseRetentionAge(os.Getenv("SESSION_MAX_AGE")); err == nil && age > 0 {
+		return age
+	}
+	return defaultSessionMaxAge
+}
+
+// sessionFile returns the state file of an extraction
+func sessionFile(dir, extractionID string) string {
+	return filepath.Join(dir, "extraction_"+sanitizeFilename(extractionID)+".json")
+}
+
+// persistSession writes the session to the state directory. Errors are only
+// logged: persistence must never block a translation.
+func (s *MCPServer) persistSession(session *BulkTranslationSession) {
+	session.UpdatedAt = time.Now()
+
+	dir := sessionStateDir()
+	if dir == "" || session.Document == nil {
+		return
+	}
+	data, err := json.Marshal(persistedSession{
+		Version: sessionStateVersion,
+		SavedAt: session.UpdatedAt,
+		Source:  session.Document.Source,
+		Session: session,
+	})
+	if err != nil {
+		s.log("Error serializando sesion %s: %v", session.ExtractionID, err)
+		return
+	}
+	if err := writeStateFile(sessionFile(dir, session.ExtractionID), data); err != nil {
+		s.log("Error guardando sesion %s: %v", session.ExtractionID, err)
+	}
+}
+
+// writeStateFile writes a file of the state directory, creating it if needed.
+// It writes then renames so a crash never leaves a truncated file.
+func writeStateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// forgetSession removes an extraction from memory and from the state directory
+func (s *MCPServer) forgetSession(extractionID string) {
+	extractionsMutex.Lock()
+	delete(activeExtractions, extractionID)
+	extractionsMutex.Unlock()
+
+	if dir := sessionStateDir(); dir != "" {
+		if err := os.Remove(sessionFile(dir, extractionID)); err != nil && !os.IsNotExist(err) {
+			s.log("Error borrando sesion %s: %v", extractionID, err)
+		}
+	}
+}
+
+// loadPersistedSession reads a state file and rebuilds the shortcode tree and
+// tokens of the session from its source
+func loadPersistedSession(path string) (*BulkTranslationSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state persistedSession
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("JSON no valido: %v", err)
+	}
+	if state.Version != sessionStateVersion || state.Session == nil {
+		return nil, fmt.Errorf("version de sesion %d no soportada", state.Version)
+	}
+
+	session := state.Session
+	doc := parseShortcodeDocument(state.Source)
+	tokens := doc.Tokens()
+
+	chunkIndices, _ := translatableChunks(tokens, session.SkipGlobalModules, session.PostID)
+	if len(chunkIndices) != len(session.ChunkIndices) {
+		return nil, fmt.Errorf("el contenido reconstruido tiene %d bloques, la sesion %d (cambio de configuracion?)", len(chunkIndices), len(session.ChunkIndices))
+	}
+	for i := range chunkIndices {
+		if chunkIndices[i] != session.ChunkIndices[i] {
+			return nil, fmt.Errorf("los bloques reconstruidos no coinciden con la sesion")
+		}
+	}
+	if len(session.Translations) != session.TotalChunks || session.CurrentPart >= session.Parts {
+		return nil, fmt.Errorf("estado de sesion inconsistente")
+	}
+
+	session.Document = doc
+	session.Tokens = tokens
+	session.Restored = true
+	if session.UpdatedAt.IsZero() {
+		session.UpdatedAt = state.SavedAt
+	}
+	return session, nil
+}
+
+// restoreSessions reloads the persisted batch jobs and extractions at startup,
+// deleting the expired or unreadable ones
+func (s *MCPServer) restoreSessions() {
+	dir := sessionStateDir()
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.log("Error leyendo directorio de sesiones: %v", err)
+		}
+		return
+	}
+
+	maxAge := sessionMaxAge()
+	s.restoreBatchJobs(dir, entries, maxAge)
+
+	restored, expired := 0, 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "extraction_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+
+		session, err := loadPersistedSession(path)
+		if err != nil {
+			s.log("Descartando sesion %s: %v", name, err)
+			os.Remove(path)
+			continue
+		}
+		if time.Since(session.UpdatedAt) > maxAge {
+			expired++
+			os.Remove(path)
+			continue
+		}
+		// A job that expired or was lost can no longer track the extraction
+		if session.BatchJobID != "" && !batchJobExists(session.BatchJobID) {
+			s.log("Sesion %s: lote %s no encontrado, se restaura fuera del lote", session.ExtractionID, session.BatchJobID)
+			session.BatchJobID = ""
+		}
+
+		extractionsMutex.Lock()
+		if _, exists := activeExtractions[session.ExtractionID]; !exists {
+			activeExtractions[session.ExtractionID] = session
+			restored++
+		}
+		extractionsMutex.Unlock()
+	}
+
+	if restored > 0 || expired > 0 {
+		s.log("Sesiones restauradas: %d (caducadas: %d) desde %s", restored, expired, dir)
+	}
+}
+
+// reapSessions removes extractions untouched for longer than SESSION_MAX_AGE
+// until stop is closed
+func (s *MCPServer) reapSessions(stop <-chan struct{}) {
+	maxAge := sessionMaxAge()
+	interval := maxAge / 10
+	if interval > maxSessionReapInterval {
+		interval = maxSessionReapInterval
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.expireSessions(maxAge)
+		}
+	}
+}
+
+// expireSessions removes the extractions idle for longer than maxAge
+func (s *MCPServer) expireSessions(maxAge time.Duration) int {
+	var ids []string
+	extractionsMutex.RLock()
+	for id := range activeExtractions {
+		ids = append(ids, id)
+	}
+	extractionsMutex.RUnlock()
+
+	// Checked under the session lock: a tool call in progress refreshes UpdatedAt
+	expired := 0
+	for _, id := range ids {
+		session := lockExtraction(id)
+		if session == nil {
+			continue
+		}
+		if time.Since(session.UpdatedAt) > maxAge {
+			s.forgetSession(id)
+			expired++
+		}
+		session.mu.Unlock()
+	}
+	if expired > 0 {
+		s.log("Extracciones caducadas: %d (sin actividad en %s)", expired, formatRetentionAge(maxAge))
+	}
+	return expired
+}
+
+// formatAge renders an elapsed time in a compact human form
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "menos de 1 min"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d h", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d dias", int(d.Hours()/24))
+}
+
+// sessionSummary describes an extraction in one line for listings
+func (s *MCPServer) sessionSummary(session *BulkTranslationSession) string {
+	state := fmt.Sprintf("parte %d de %d", session.CurrentPart+1, session.Parts)
+	line := fmt.Sprintf("- %s | %s -> %s | %s | %d bloques | creada hace %s, actividad hace %s",
+		session.ExtractionID, s.getSourceDescriptionForSession(session), session.TargetLang,
+		state, session.TotalChunks, formatAge(time.Since(session.CreatedAt)), formatAge(time.Since(session.UpdatedAt)))
+	if session.BatchJobID != "" {
+		line += " | lote " + session.BatchJobID
+	}
+	if session.Restored {
+		line += " | restaurada"
+	}
+	return line
+}
+
+func (s *MCPServer) handleListExtractions(req JSONRPCRequest, params CallToolParams) {
+	sessions := s.ownExtractions()
+	if len(sessions) == 0 {
+		s.writeToolText(req, "No hay extracciones activas.", false)
+		return
+	}
+	// Snapshot each session under its lock: a submit may be updating it
+	lines := make([]string, len(sessions))
+	updated := make([]time.Time, len(sessions))
+	for i, session := range sessions {
+		session.mu.Lock()
+		lines[i] = s.sessionSummary(session)
+		updated[i] = session.UpdatedAt
+		session.mu.Unlock()
+	}
+	order := make([]int, len(sessions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return updated[order[i]].After(updated[order[j]]) })
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("EXTRACCIONES ACTIVAS (%d)\n========================\n", len(sessions)))
+	for _, i := range order {
+		b.WriteString(lines[i] + "\n")
+	}
+	b.WriteString("\nUsa resume_extraction con el extractionId para recibir de nuevo la parte pendiente.")
+	s.writeToolText(req, b.String(), false)
+}
+
+// extractionStatus describes the progress of a bulk extraction
+func (s *MCPServer) extractionStatus(session *BulkTranslationSession) string {
+	received := 0
+	for p := 0; p < session.CurrentPart; p++ {
+		received += session.PartRanges[p][1] - session.PartRanges[p][0]
+	}
+
+	status := fmt.Sprintf(`ESTADO DE EXTRACCION BULK
+=========================
+extractionId: %s
+Origen: %s
+Idioma destino: %s
+Partes: %d recibidas de %d (pendiente: parte %d)
+Bloques: %d recibidos de %d (%d%%)
+Reutilizados de la memoria: %d
+Creada: %s (hace %s)
+Ultima actividad: hace %s
+Caduca tras %s sin actividad`,
+		session.ExtractionID,
+		s.getSourceDescriptionForSession(session),
+		session.TargetLang,
+		session.CurrentPart, session.Parts, session.CurrentPart+1,
+		received, session.TotalChunks, received*100/session.TotalChunks,
+		session.TMHits,
+		session.CreatedAt.Format("2006-01-02 15:04:05"), formatAge(time.Since(session.CreatedAt)),
+		formatAge(time.Since(session.UpdatedAt)),
+		formatRetentionAge(sessionMaxAge()))
+
+	if session.BatchJobID != "" {
+		status += fmt.Sprintf("\nLote: %s", session.BatchJobID)
+	}
+	if session.Restored {
+		status += "\nRestaurada tras reiniciar el servidor"
+	}
+	if len(session.ValidationIssues) > 0 {
+		report := &ValidationReport{Issues: session.ValidationIssues}
+		fatal, warnings := report.Counts()
+		status += fmt.Sprintf("\nValidacion: %d errores forzados, %d advertencias aceptadas", fatal, warnings)
+	}
+	return status
+}
+
+func (s *MCPServer) handleCancelExtraction(req JSONRPCRequest, params CallToolParams) {
+	extractionID, _ := params.Arguments["extractionId"].(string)
+
+	session := s.lockOwnExtraction(extractionID)
+	if session == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: extractionId '%s' no encontrado o ya finalizado", extractionID), true)
+		return
+	}
+	defer session.mu.Unlock()
+
+	s.forgetSession(extractionID)
+	s.cancelBatchItem(session)
+	s.log("Extraccion cancelada: %s", extractionID)
+
+	text := fmt.Sprintf("Extraccion %s cancelada (%s, parte %d de %d). No se ha modificado nada.",
+		extractionID, s.getSourceDescriptionForSession(session), session.CurrentPart+1, session.Parts)
+	if session.BatchJobID != "" {
+		text += fmt.Sprintf("\nEl post queda omitido en el lote %s; usa batch_next_extraction para continuar.", session.BatchJobID)
+	}
+	s.writeToolText(req, text, false)
+}
+
+func (s *MCPServer) handleResumeExtraction(req JSONRPCRequest, params CallToolParams) {
+	extractionID, _ := params.Arguments["extractionId"].(string)
+
+	session := s.lockResumedExtraction(extractionID)
+	if session == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: extractionId '%s' no encontrado o caducado. Usa list_extractions para ver las activas.", extractionID), true)
+		return
+	}
+	defer session.mu.Unlock()
+
+	s.writeToolText(req, fmt.Sprintf("REANUDANDO EXTRACCION (parte %d de %d)\n\n%s",
+		session.CurrentPart+1, session.Parts, s.generateBulkExtractResponseWithID(session)), false)
+}
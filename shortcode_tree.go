@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShortcodeDocument is a Divi document parsed into a tree of shortcode nodes.
+// Rendering an unmodified document returns exactly the original bytes.
+type ShortcodeDocument struct {
+	Source string
+	Root   *ShortcodeNode
+	Errors []ShortcodeError // Structural problems found while parsing
+}
+
+// ShortcodeNode is either the document root, an [et_*] shortcode with its
+// children, a run of text, or a stray closing tag without opener.
+type ShortcodeNode struct {
+	Kind        string // "root", "shortcode", "text" or "stray"
+	Name        string // Shortcode name (et_pb_text, et_pb_row, ...)
+	Attrs       []ShortcodeAttribute
+	Text        string // For "text" nodes: current (possibly translated) text
+	Children    []*ShortcodeNode
+	Parent      *ShortcodeNode
+	Start       int  // Offset of the opening '[' (or first text byte)
+	End         int  // Offset just after the node (closing tag included)
+	OpenEnd     int  // Offset just after the opening tag
+	CloseStart  int  // Offset of the closing tag, -1 if the node has none
+	SelfClosing bool // Shortcode without closing tag ([et_pb_divider /])
+}
+
+// ShortcodeAttribute is one attribute of an opening tag. Start/End are the
+// absolute source offsets of the raw value, quotes included.
+type ShortcodeAttribute struct {
+	Name       string
+	Value      string // Decoded value
+	Raw        string // Raw value as written in the tag (may be replaced)
+	Start, End int
+}
+
+// ShortcodeError describes an unbalanced or malformed shortcode.
+type ShortcodeError struct {
+	Offset  int
+	Name    string
+	Message string
+}
+
+func (e ShortcodeError) String() string {
+	return fmt.Sprintf("offset %d [%s]: %s", e.Offset, e.Name, e.Message)
+}
+
+// nextShortcodeIndex returns the offset of the next [et_ or [/et_ from i, or -1.
+func nextShortcodeIndex(input string, i int) int {
+	for i < len(input) {
+		idx := strings.IndexByte(input[i:], '[')
+		if idx == -1 {
+			return -1
+		}
+		i += idx
+		if strings.HasPrefix(input[i:], "[et_") || strings.HasPrefix(input[i:], "[/et_") {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// closeAsSelfClosing turns the open nodes above stack[j] into self-closing
+// ones: the nodes parsed inside them become following children of stack[j].
+// Each open node is the last child of the one below it, so appending their
+// children in stack order keeps the document order.
+func closeAsSelfClosing(stack []*ShortcodeNode, j int) {
+	parent := stack[j]
+	for _, n := range stack[j+1:] {
+		for _, child := range n.Children {
+			child.Parent = parent
+		}
+		parent.Children = append(parent.Children, n.Children...)
+		n.Children = nil
+		n.SelfClosing = true
+		n.End = n.OpenEnd
+	}
+}
+
+// parseShortcodeDocument builds the shortcode tree of a Divi document in a
+// single pass. Openers still open when an enclosing closer (or the end of the
+// document) arrives are treated as self-closing, as Divi writes modules like
+// [et_pb_button] without closer; closers without opener become "stray" nodes.
+func parseShortcodeDocument(source string) *ShortcodeDocument {
+	root := &ShortcodeNode{Kind: "root", Start: 0, End: len(source), OpenEnd: 0, CloseStart: -1}
+	doc := &ShortcodeDocument{Source: source, Root: root}
+	stack := []*ShortcodeNode{root}
+
+	addText := func(from, to int) {
+		if to <= from {
+			return
+		}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, &ShortcodeNode{
+			Kind: "text", Text: source[from:to], Parent: parent,
+			Start: from, End: to, OpenEnd: from, CloseStart: -1,
+		})
+	}
+
+	i := 0
+	for i < len(source) {
+		idx := nextShortcodeIndex(source, i)
+		if idx == -1 {
+			addText(i, len(source))
+			break
+		}
+		addText(i, idx)
+
+		end := scanShortcodeTag(source, idx)
+		if end == -1 {
+			// Malformed, treat rest as text
+			doc.Errors = append(doc.Errors, ShortcodeError{Offset: idx, Message: "shortcode sin ']' de cierre"})
+			addText(idx, len(source))
+			break
+		}
+		tag := source[idx : end+1]
+		parent := stack[len(stack)-1]
+
+		if strings.HasPrefix(tag, "[/") {
+			name := strings.TrimSpace(tag[2 : len(tag)-1])
+			j := len(stack) - 1
+			for j > 0 && stack[j].Name != name {
+				j--
+			}
+			if j == 0 {
+				doc.Errors = append(doc.Errors, ShortcodeError{Offset: idx, Name: name, Message: "cierre sin apertura"})
+				parent.Children = append(parent.Children, &ShortcodeNode{
+					Kind: "stray", Name: name, Parent: parent,
+					Start: idx, End: end + 1, OpenEnd: end + 1, CloseStart: -1,
+				})
+			} else {
+				closeAsSelfClosing(stack, j)
+				node := stack[j]
+				node.CloseStart = idx
+				node.End = end + 1
+				stack = stack[:j]
+			}
+			i = end + 1
+			continue
+		}
+
+		name, attrs := parseShortcodeTag(tag)
+		node := &ShortcodeNode{
+			Kind: "shortcode", Name: name, Parent: parent,
+			Start: idx, End: end + 1, OpenEnd: end + 1, CloseStart: -1,
+		}
+		for _, a := range attrs {
+			raw := tag[a.Start:a.End]
+			node.Attrs = append(node.Attrs, ShortcodeAttribute{
+				Name: a.Name, Value: decodeAttrValue(raw), Raw: raw,
+				Start: idx + a.Start, End: idx + a.End,
+			})
+		}
+		parent.Children = append(parent.Children, node)
+
+		if strings.HasSuffix(tag, "/]") {
+			node.SelfClosing = true
+		} else {
+			stack = append(stack, node)
+		}
+		i = end + 1
+	}
+
+	closeAsSelfClosing(stack, 0)
+
+	return doc
+}
+
+// Render serializes the tree, including any replaced text or attribute values.
+func (d *ShortcodeDocument) Render() string {
+	var b strings.Builder
+	d.render(&b, d.Root)
+	return b.String()
+}
+
+func (d *ShortcodeDocument) render(b *strings.Builder, n *ShortcodeNode) {
+	switch n.Kind {
+	case "text":
+		b.WriteString(n.Text)
+		return
+	case "stray":
+		b.WriteString(d.Source[n.Start:n.End])
+		return
+	case "shortcode":
+		last := n.Start
+		for _, a := range n.Attrs {
+			b.WriteString(d.Source[last:a.Start])
+			b.WriteString(a.Raw)
+			last = a.End
+		}
+		b.WriteString(d.Source[last:n.OpenEnd])
+	}
+
+	for _, child := range n.Children {
+		d.render(b, child)
+	}
+
+	if n.Kind == "shortcode" && n.CloseStart >= 0 {
+		b.WriteString(d.Source[n.CloseStart:n.End])
+	}
+}
+
+// Tokens flattens the tree into the token stream used by the translation
+// sessions. Text and attribute tokens keep a reference to their node so
+// setTokenText writes translations back into the tree.
+func (d *ShortcodeDocument) Tokens() []Token {
+	var tokens []Token
+	d.appendTokens(&tokens, d.Root)
+	return tokens
+}
+
+func (d *ShortcodeDocument) appendTokens(tokens *[]Token, n *ShortcodeNode) {
+	switch n.Kind {
+	case "text":
+		*tokens = append(*tokens, Token{Kind: "text", Value: n.Text, node: n})
+		return
+	case "stray":
+		*tokens = append(*tokens, Token{Kind: "shortcode", Value: d.Source[n.Start:n.End]})
+		return
+	case "shortcode":
+		last := n.Start
+		for ai, a := range n.Attrs {
+			if !isTranslatableAttr(n.Name, a.Name) || strings.TrimSpace(a.Value) == "" {
+				continue
+			}
+			*tokens = append(*tokens, Token{Kind: "shortcode", Value: d.Source[last:a.Start]})
+			*tokens = append(*tokens, Token{Kind: "attr", Value: a.Raw, Module: n.Name, Attr: a.Name, node: n, attr: ai})
+			last = a.End
+		}
+		*tokens = append(*tokens, Token{Kind: "shortcode", Value: d.Source[last:n.OpenEnd]})
+	}
+
+	for _, child := range n.Children {
+		d.appendTokens(tokens, child)
+	}
+
+	if n.Kind == "shortcode" && n.CloseStart >= 0 {
+		*tokens = append(*tokens, Token{Kind: "shortcode", Value: d.Source[n.CloseStart:n.End]})
+	}
+}
+
+// Walk visits every node depth-first; returning false skips the node's children.
+func (n *ShortcodeNode) Walk(fn func(*ShortcodeNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Children {
+		child.Walk(fn)
+	}
+}
+
+// FindAll returns every shortcode node with the given name, in document order.
+func (d *ShortcodeDocument) FindAll(name string) []*ShortcodeNode {
+	var found []*ShortcodeNode
+	d.Root.Walk(func(n *ShortcodeNode) bool {
+		if n.Kind == "shortcode" && n.Name == name {
+			found = append(found, n)
+		}
+		return true
+	})
+	return found
+}
+
+// Attr returns the decoded value of an attribute and whether it is present.
+func (n *ShortcodeNode) Attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Path identifies a node by its position among same-named siblings, e.g.
+// "et_pb_section[0]/et_pb_row[1]/et_pb_column[0]/et_pb_text[0]".
+func (n *ShortcodeNode) Path() string {
+	var parts []string
+	for cur := n; cur != nil && cur.Kind != "root"; cur = cur.Parent {
+		name := cur.Name
+		if cur.Kind == "text" {
+			name = "#text"
+		}
+		pos := 0
+		if cur.Parent != nil {
+			for _, sib := range cur.Parent.Children {
+				if sib == cur {
+					break
+				}
+				if sib.Kind == cur.Kind && sib.Name == cur.Name {
+					pos++
+				}
+			}
+		}
+		parts = append([]string{fmt.Sprintf("%s[%d]", name, pos)}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
+
+// InnerText returns the source between the opening and closing tags.
+func (d *ShortcodeDocument) InnerText(n *ShortcodeNode) string {
+	if n.Kind != "shortcode" || n.CloseStart < 0 {
+		return ""
+	}
+	return d.Source[n.OpenEnd:n.CloseStart]
+}
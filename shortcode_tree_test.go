@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShortcodeDocumentRoundTrip(t *testing.T) {
+	for _, path := range []string{"test/Ejemplo_pagina_divi.txt", "test/Ejemplo_pagina_divi.ca.txt"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := parseShortcodeDocument(string(data))
+		if got := doc.Render(); got != string(data) {
+			t.Errorf("%s: Render() differs from the source", path)
+		}
+		if len(doc.Errors) != 0 {
+			t.Errorf("%s: unexpected errors %v", path, doc.Errors)
+		}
+		var b strings.Builder
+		for _, tok := range doc.Tokens() {
+			b.WriteString(tok.Value)
+		}
+		if b.String() != string(data) {
+			t.Errorf("%s: concatenated tokens differ from the source", path)
+		}
+	}
+}
+
+func TestShortcodeDocumentMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		errors int
+	}{
+		{"empty", "", 0},
+		{"text only", "Hola [mundo] sin shortcodes", 0},
+		{"unclosed at end", `[et_pb_section][et_pb_text]Hola`, 0},
+		{"stray closer", `Hola[/et_pb_text] mundo`, 1},
+		{"crossed closers", `[et_pb_row][et_pb_column]x[/et_pb_row][/et_pb_column]`, 1},
+		{"tag without bracket", `[et_pb_text]Hola[/et_pb_text][et_pb_button button_text="Ir"`, 1},
+		{"unterminated quote", `[et_pb_button button_text="Ir]Hola[/et_pb_button]`, 1},
+		{"self-closing slash", `[et_pb_divider /][et_pb_text]x[/et_pb_text]`, 0},
+		{"other shortcodes", `[et_pb_text][caption]x[/caption] [/et_pb_text`, 1},
+		{"multibyte", "[et_pb_text]Camión ñandú 日本語[/et_pb_text][/et_pb_text]", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseShortcodeDocument(tt.source)
+			if got := doc.Render(); got != tt.source {
+				t.Errorf("Render() = %q, want %q", got, tt.source)
+			}
+			if len(doc.Errors) != tt.errors {
+				t.Errorf("got %d errors %v, want %d", len(doc.Errors), doc.Errors, tt.errors)
+			}
+			assertParents(t, doc.Root)
+		})
+	}
+}
+
+// assertParents checks every child points to its parent
+func assertParents(t *testing.T, n *ShortcodeNode) {
+	t.Helper()
+	for _, child := range n.Children {
+		if child.Parent != n {
+			t.Errorf("node %s at %d: wrong parent", child.Name, child.Start)
+		}
+		assertParents(t, child)
+	}
+}
+
+func TestShortcodeDocumentImplicitSelfClosing(t *testing.T) {
+	source := `[et_pb_column][et_pb_button button_text="A"][/et_pb_column][et_pb_column][et_pb_button button_text="B"][/et_pb_button][/et_pb_column]`
+	doc := parseShortcodeDocument(source)
+	if len(doc.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", doc.Errors)
+	}
+	if got := doc.Render(); got != source {
+		t.Fatalf("Render() = %q", got)
+	}
+
+	columns := doc.FindAll("et_pb_column")
+	buttons := doc.FindAll("et_pb_button")
+	if len(columns) != 2 || len(buttons) != 2 {
+		t.Fatalf("got %d columns and %d buttons", len(columns), len(buttons))
+	}
+	if !buttons[0].SelfClosing || buttons[0].Parent != columns[0] || buttons[0].CloseStart != -1 {
+		t.Errorf("button A: self-closing=%v parent=%s", buttons[0].SelfClosing, buttons[0].Parent.Path())
+	}
+	if buttons[1].SelfClosing || buttons[1].Parent != columns[1] || buttons[1].CloseStart < 0 {
+		t.Errorf("button B: self-closing=%v parent=%s", buttons[1].SelfClosing, buttons[1].Parent.Path())
+	}
+	if columns[0].CloseStart < 0 || columns[1].CloseStart < 0 {
+		t.Error("columns should be closed")
+	}
+
+	// Text parsed inside an implicitly self-closed module belongs to its parent
+	doc = parseShortcodeDocument(`[et_pb_text][et_pb_button button_text="A"]Hola[/et_pb_text]`)
+	text := doc.FindAll("et_pb_text")[0]
+	if len(text.Children) != 2 || text.Children[1].Kind != "text" || text.Children[1].Text != "Hola" {
+		t.Errorf("children of et_pb_text: %+v", text.Children)
+	}
+	if v, _ := doc.FindAll("et_pb_button")[0].Attr("button_text"); v != "A" {
+		t.Errorf("button_text = %q", v)
+	}
+}
+
+func TestShortcodeDocumentTranslatedRender(t *testing.T) {
+	source := `[et_pb_section][et_pb_text]<p>Hola</p>[/et_pb_text][et_pb_button button_text="Ir" button_url="/x"][/et_pb_section]`
+	doc := parseShortcodeDocument(source)
+	tokens := doc.Tokens()
+	for i := range tokens {
+		switch {
+		case tokens[i].Kind == "text" && tokenText(tokens[i]) == "<p>Hola</p>":
+			setTokenText(&tokens[i], "<p>Hello</p>")
+		case tokens[i].Kind == "attr" && tokens[i].Attr == "button_text":
+			setTokenText(&tokens[i], `Go "now"`)
+		}
+	}
+	got := doc.Render()
+	if !strings.Contains(got, "<p>Hello</p>") || strings.Contains(got, "Hola") {
+		t.Errorf("text not replaced: %s", got)
+	}
+	if !strings.Contains(got, `button_url="/x"`) || strings.Contains(got, `button_text="Ir"`) {
+		t.Errorf("attribute not replaced: %s", got)
+	}
+	if parseShortcodeDocument(got).Render() != got {
+		t.Error("translated document does not round-trip")
+	}
+}
+
+// TestShortcodeDocumentManyUnclosed parses a document whose openers never
+// close; a rescan per opener would make it quadratic
+func TestShortcodeDocumentManyUnclosed(t *testing.T) {
+	source := strings.Repeat(`[et_pb_button button_text="Ir"]texto `, 50000)
+	doc := parseShortcodeDocument(source)
+	if doc.Render() != source {
+		t.Fatal("Render() differs from the source")
+	}
+	if n := len(doc.Root.Children); n != 100000 {
+		t.Errorf("root has %d children, want 100000", n)
+	}
+}
@@ -0,0 +1,64 @@
+-- Polylang taxonomies for testing translation links against a local
+-- MySQL/MariaDB. Load it after wordpress_wpml.sql, which creates the posts:
+--
+--   mysql -u root divi_test < test/fixtures/wordpress_wpml.sql
+--   mysql -u root divi_test < test/fixtures/wordpress_polylang.sql
+--
+-- The WPML table is dropped so the server detects Polylang.
+-- Post 10 (es) and 11 (en) form a group; post 20 (es) has no group yet.
+
+SET NAMES utf8mb4;
+
+DROP TABLE IF EXISTS wp_icl_translations;
+
+DROP TABLE IF EXISTS wp_terms;
+CREATE TABLE wp_terms (
+  term_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  name varchar(200) NOT NULL DEFAULT '',
+  slug varchar(200) NOT NULL DEFAULT '',
+  term_group bigint(10) NOT NULL DEFAULT 0,
+  PRIMARY KEY (term_id),
+  KEY slug (slug(191)),
+  KEY name (name(191))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS wp_term_taxonomy;
+CREATE TABLE wp_term_taxonomy (
+  term_taxonomy_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  term_id bigint(20) unsigned NOT NULL DEFAULT 0,
+  taxonomy varchar(32) NOT NULL DEFAULT '',
+  description longtext NOT NULL,
+  parent bigint(20) unsigned NOT NULL DEFAULT 0,
+  count bigint(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (term_taxonomy_id),
+  UNIQUE KEY term_id_taxonomy (term_id, taxonomy),
+  KEY taxonomy (taxonomy)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS wp_term_relationships;
+CREATE TABLE wp_term_relationships (
+  object_id bigint(20) unsigned NOT NULL DEFAULT 0,
+  term_taxonomy_id bigint(20) unsigned NOT NULL DEFAULT 0,
+  term_order int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (object_id, term_taxonomy_id),
+  KEY term_taxonomy_id (term_taxonomy_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO wp_terms (term_id, name, slug) VALUES
+  (1, 'Español', 'es'),
+  (2, 'English', 'en'),
+  (3, 'Français', 'fr'),
+  (4, 'pll_65a1b2c3d4e5f', 'pll_65a1b2c3d4e5f'),
+  (5, 'Sin categoria', 'sin-categoria');
+
+INSERT INTO wp_term_taxonomy (term_taxonomy_id, term_id, taxonomy, description, count) VALUES
+  (1, 1, 'language', 'a:3:{s:6:"locale";s:5:"es_ES";s:3:"rtl";i:0;s:9:"flag_code";s:2:"es";}', 2),
+  (2, 2, 'language', 'a:3:{s:6:"locale";s:5:"en_US";s:3:"rtl";i:0;s:9:"flag_code";s:2:"us";}', 1),
+  (3, 3, 'language', 'a:3:{s:6:"locale";s:5:"fr_FR";s:3:"rtl";i:0;s:9:"flag_code";s:2:"fr";}', 0),
+  (4, 4, 'post_translations', 'a:2:{s:2:"es";i:10;s:2:"en";i:11;}', 2),
+  (5, 5, 'category', '', 0);
+
+INSERT INTO wp_term_relationships (object_id, term_taxonomy_id) VALUES
+  (10, 1), (10, 4),
+  (11, 2), (11, 4),
+  (20, 1);
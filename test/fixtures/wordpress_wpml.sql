@@ -0,0 +1,119 @@
+-- Minimal WordPress + WPML schema for testing post copies and translation links
+-- against a local MySQL/MariaDB:
+--
+--   mysql -u root -e "CREATE DATABASE divi_test CHARACTER SET utf8mb4"
+--   mysql -u root divi_test < test/fixtures/wordpress_wpml.sql
+--
+-- Then point WP_MYSQL_DATABASE=divi_test (WP_TABLE_PREFIX=wp_).
+-- The tests in wpml_test.go load it themselves when WP_TEST_DSN is set:
+--
+--   WP_TEST_DSN="root@tcp(localhost:3306)/divi_test" go test -run WPML .
+-- Post 10 (es) has an English translation (11); post 20 (es) has none yet.
+
+SET NAMES utf8mb4;
+
+DROP TABLE IF EXISTS wp_posts;
+CREATE TABLE wp_posts (
+  ID bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  post_author bigint(20) unsigned NOT NULL DEFAULT 0,
+  post_date datetime NOT NULL DEFAULT '0000-00-00 00:00:00',
+  post_date_gmt datetime NOT NULL DEFAULT '0000-00-00 00:00:00',
+  post_content longtext NOT NULL,
+  post_title text NOT NULL,
+  post_excerpt text NOT NULL,
+  post_status varchar(20) NOT NULL DEFAULT 'publish',
+  comment_status varchar(20) NOT NULL DEFAULT 'open',
+  ping_status varchar(20) NOT NULL DEFAULT 'open',
+  post_password varchar(255) NOT NULL DEFAULT '',
+  post_name varchar(200) NOT NULL DEFAULT '',
+  to_ping text NOT NULL,
+  pinged text NOT NULL,
+  post_modified datetime NOT NULL DEFAULT '0000-00-00 00:00:00',
+  post_modified_gmt datetime NOT NULL DEFAULT '0000-00-00 00:00:00',
+  post_content_filtered longtext NOT NULL,
+  post_parent bigint(20) unsigned NOT NULL DEFAULT 0,
+  guid varchar(255) NOT NULL DEFAULT '',
+  menu_order int(11) NOT NULL DEFAULT 0,
+  post_type varchar(20) NOT NULL DEFAULT 'post',
+  post_mime_type varchar(100) NOT NULL DEFAULT '',
+  comment_count bigint(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (ID),
+  KEY post_name (post_name(191)),
+  KEY type_status_date (post_type, post_status, post_date, ID),
+  KEY post_parent (post_parent),
+  KEY post_author (post_author)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS wp_postmeta;
+CREATE TABLE wp_postmeta (
+  meta_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  post_id bigint(20) unsigned NOT NULL DEFAULT 0,
+  meta_key varchar(255) DEFAULT NULL,
+  meta_value longtext,
+  PRIMARY KEY (meta_id),
+  KEY post_id (post_id),
+  KEY meta_key (meta_key(191))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS wp_options;
+CREATE TABLE wp_options (
+  option_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  option_name varchar(191) NOT NULL DEFAULT '',
+  option_value longtext NOT NULL,
+  autoload varchar(20) NOT NULL DEFAULT 'yes',
+  PRIMARY KEY (option_id),
+  UNIQUE KEY option_name (option_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS wp_icl_translations;
+CREATE TABLE wp_icl_translations (
+  translation_id bigint(20) NOT NULL AUTO_INCREMENT,
+  element_type varchar(60) NOT NULL DEFAULT 'post_post',
+  element_id bigint(20) DEFAULT NULL,
+  trid bigint(20) NOT NULL,
+  language_code varchar(7) NOT NULL,
+  source_language_code varchar(7) DEFAULT NULL,
+  PRIMARY KEY (translation_id),
+  UNIQUE KEY trid_lang (trid, language_code),
+  UNIQUE KEY el_type_id (element_type, element_id),
+  KEY trid (trid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO wp_options (option_name, option_value) VALUES
+  ('home', 'https://example.test'),
+  ('siteurl', 'https://example.test');
+
+INSERT INTO wp_posts (ID, post_author, post_date, post_date_gmt, post_content, post_title, post_excerpt,
+  post_status, post_name, to_ping, pinged, post_modified, post_modified_gmt, post_content_filtered,
+  post_parent, guid, menu_order, post_type) VALUES
+  (10, 1, '2024-01-10 10:00:00', '2024-01-10 09:00:00',
+   '[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Bienvenidos a nuestra web</p>[/et_pb_text][/et_pb_column][/et_pb_row][/et_pb_section]',
+   'Inicio', 'Pagina de inicio', 'publish', 'inicio', '', '', '2024-01-10 10:00:00', '2024-01-10 09:00:00', '',
+   0, 'https://example.test/?page_id=10', 0, 'page'),
+  (11, 1, '2024-01-11 10:00:00', '2024-01-11 09:00:00',
+   '[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Welcome to our website</p>[/et_pb_text][/et_pb_column][/et_pb_row][/et_pb_section]',
+   'Home', 'Home page', 'publish', 'home', '', '', '2024-01-11 10:00:00', '2024-01-11 09:00:00', '',
+   0, 'https://example.test/?page_id=11', 0, 'page'),
+  (20, 2, '2024-02-01 10:00:00', '2024-02-01 09:00:00',
+   '[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Nuestros servicios</p>[/et_pb_text][et_pb_button button_text="Contactar" button_url="/contacto"][/et_pb_button][/et_pb_column][/et_pb_row][/et_pb_section]',
+   'Servicios', '', 'publish', 'servicios', '', '', '2024-02-01 10:00:00', '2024-02-01 09:00:00', '',
+   10, 'https://example.test/?page_id=20', 3, 'page');
+
+INSERT INTO wp_postmeta (post_id, meta_key, meta_value) VALUES
+  (10, '_et_pb_use_builder', 'on'),
+  (10, '_et_pb_page_layout', 'et_no_sidebar'),
+  (11, '_et_pb_use_builder', 'on'),
+  (11, '_et_pb_page_layout', 'et_no_sidebar'),
+  (20, '_et_pb_use_builder', 'on'),
+  (20, '_et_pb_page_layout', 'et_full_width_page'),
+  (20, '_et_pb_built_for_post_type', 'page'),
+  (20, '_et_builder_version', 'VB|Divi|4.24.0'),
+  (20, '_et_pb_static_css_file', 'on'),
+  (20, '_et_dynamic_cached_shortcodes', 'a:2:{i:0;s:13:"et_pb_section";i:1;s:12:"et_pb_button";}'),
+  (20, '_wp_page_template', 'default'),
+  (20, '_edit_lock', '1706778000:1');
+
+INSERT INTO wp_icl_translations (element_type, element_id, trid, language_code, source_language_code) VALUES
+  ('post_page', 10, 1, 'es', NULL),
+  ('post_page', 11, 1, 'en', 'es'),
+  ('post_page', 20, 2, 'es', NULL);
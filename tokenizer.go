@@ -1,69 +1,227 @@
 package main
 
 import (
+	"os"
 	"strings"
+	"sync"
 )
 
-// Token represents either a shortcode or text block.
+// Token represents either a shortcode, a text block or a translatable
+// shortcode attribute value.
 type Token struct {
-	Kind  string // "shortcode" or "text"
-	Value string
+	Kind   string // "shortcode", "text" or "attr"
+	Value  string
+	Module string // For "attr": shortcode that owns the attribute (et_pb_button, ...)
+	Attr   string // For "attr": attribute name (button_text, title, ...)
+
+	node *ShortcodeNode // Tree node backing a "text" or "attr" token
+	attr int            // For "attr": index in node.Attrs
 }
 
-// tokenize splits the input into shortcode tokens and text tokens.
-// Captures both opening [et_pb_*] and closing [/et_pb_*] shortcodes.
-func tokenize(input string) []Token {
-	var tokens []Token
-	i := 0
+// defaultTranslatableAttrs lists, per Divi module, the shortcode attributes
+// that hold visible text. A "*" module entry (via DIVI_TRANSLATABLE_ATTRS)
+// applies to every module.
+var defaultTranslatableAttrs = map[string][]string{
+	"et_pb_accordion_item":      {"title"},
+	"et_pb_blurb":               {"title", "alt", "image_alt"},
+	"et_pb_button":              {"button_text"},
+	"et_pb_circle_counter":      {"title"},
+	"et_pb_contact_field":       {"field_title"},
+	"et_pb_contact_form":        {"title", "submit_button_text", "success_message"},
+	"et_pb_countdown_timer":     {"title"},
+	"et_pb_cta":                 {"title", "button_text"},
+	"et_pb_fullwidth_header":    {"title", "subhead", "button_one_text", "button_two_text", "logo_alt_text", "image_alt_text"},
+	"et_pb_fullwidth_image":     {"alt", "title_text"},
+	"et_pb_fullwidth_slide":     {"heading", "button_text", "image_alt"},
+	"et_pb_image":               {"alt", "title_text"},
+	"et_pb_login":               {"title"},
+	"et_pb_number_counter":      {"title"},
+	"et_pb_pricing_table":       {"title", "subtitle", "button_text", "currency", "per"},
+	"et_pb_search":              {"placeholder", "button_text"},
+	"et_pb_signup":              {"title", "button_text", "success_message", "first_name_field", "last_name_field", "email_field"},
+	"et_pb_slide":               {"heading", "button_text", "image_alt"},
+	"et_pb_social_media_follow": {"follow_button_text"},
+	"et_pb_tab":                 {"title"},
+	"et_pb_team_member":         {"name", "position", "image_alt"},
+	"et_pb_testimonial":         {"author", "job_title", "company_name"},
+	"et_pb_toggle":              {"title"},
+	"et_pb_video_slider_item":   {"admin_title"},
+}
 
-	for i < len(input) {
-		// Find next shortcode - either [et_ or [/et_
-		openIdx := strings.Index(input[i:], "[et_")
-		closeIdx := strings.Index(input[i:], "[/et_")
+var (
+	translatableAttrsOnce sync.Once
+	translatableAttrsMap  map[string]map[string]bool
+)
 
-		// Determine which comes first
-		var idx int = -1
-		if openIdx >= 0 && closeIdx >= 0 {
-			if openIdx < closeIdx {
-				idx = openIdx
-			} else {
-				idx = closeIdx
+// translatableAttrs returns the attribute whitelist, merging the defaults with
+// DIVI_TRANSLATABLE_ATTRS (format: "et_pb_button=button_text,title;et_pb_x=heading").
+func translatableAttrs() map[string]map[string]bool {
+	translatableAttrsOnce.Do(func() {
+		translatableAttrsMap = make(map[string]map[string]bool)
+		add := func(module string, attrs []string) {
+			if translatableAttrsMap[module] == nil {
+				translatableAttrsMap[module] = make(map[string]bool)
+			}
+			for _, a := range attrs {
+				if a = strings.TrimSpace(a); a != "" {
+					translatableAttrsMap[module][a] = true
+				}
 			}
-		} else if openIdx >= 0 {
-			idx = openIdx
-		} else if closeIdx >= 0 {
-			idx = closeIdx
 		}
-
-		if idx == -1 {
-			// No more shortcodes, add remaining as text
-			if i < len(input) {
-				tokens = append(tokens, Token{Kind: "text", Value: input[i:]})
+		for module, attrs := range defaultTranslatableAttrs {
+			add(module, attrs)
+		}
+		for _, entry := range strings.Split(os.Getenv("DIVI_TRANSLATABLE_ATTRS"), ";") {
+			module, attrs, ok := strings.Cut(entry, "=")
+			if !ok || strings.TrimSpace(module) == "" {
+				continue
 			}
-			break
+			add(strings.TrimSpace(module), strings.Split(attrs, ","))
 		}
+	})
+	return translatableAttrsMap
+}
 
-		idx += i
+// isTranslatableAttr reports whether attr of the given module holds visible text.
+func isTranslatableAttr(module, attr string) bool {
+	whitelist := translatableAttrs()
+	return whitelist[module][attr] || whitelist["*"][attr]
+}
 
-		// Add text before shortcode
-		if idx > i {
-			tokens = append(tokens, Token{Kind: "text", Value: input[i:idx]})
+// shortcodeAttr describes one attribute inside an opening shortcode tag.
+// Start/End delimit the raw value (quotes included) relative to the tag.
+type shortcodeAttr struct {
+	Name       string
+	Start, End int
+}
+
+// scanShortcodeTag returns the index of the closing ']' of the tag starting
+// at input[start], ignoring brackets inside quoted attribute values.
+func scanShortcodeTag(input string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i > 0 && input[i-1] == '=':
+			quote = c
+		case c == ']':
+			return i
 		}
+	}
+	return -1
+}
+
+// parseShortcodeTag parses an opening tag like [et_pb_button button_text="Go"]
+// and returns the shortcode name and its attributes.
+func parseShortcodeTag(tag string) (string, []shortcodeAttr) {
+	body := strings.TrimSuffix(strings.TrimPrefix(tag, "["), "]")
+	body = strings.TrimSuffix(body, "/")
 
-		// Find closing bracket
-		end := strings.IndexByte(input[idx:], ']')
-		if end == -1 {
-			// Malformed, treat rest as text
-			tokens = append(tokens, Token{Kind: "text", Value: input[idx:]})
-			break
+	i := 0
+	for i < len(body) && !isShortcodeSpace(body[i]) {
+		i++
+	}
+	name := body[:i]
+
+	var attrs []shortcodeAttr
+	for i < len(body) {
+		for i < len(body) && isShortcodeSpace(body[i]) {
+			i++
+		}
+		nameStart := i
+		for i < len(body) && body[i] != '=' && !isShortcodeSpace(body[i]) {
+			i++
+		}
+		attrName := body[nameStart:i]
+		if i >= len(body) || body[i] != '=' {
+			// Positional/flag attribute without value
+			continue
+		}
+		i++ // skip '='
+		valStart := i
+		if i < len(body) && (body[i] == '"' || body[i] == '\'') {
+			quote := body[i]
+			end := strings.IndexByte(body[i+1:], quote)
+			if end == -1 {
+				i = len(body)
+			} else {
+				i += end + 2
+			}
+		} else {
+			for i < len(body) && !isShortcodeSpace(body[i]) {
+				i++
+			}
 		}
-		end += idx
+		// +1 accounts for the leading '[' removed from body
+		attrs = append(attrs, shortcodeAttr{Name: attrName, Start: valStart + 1, End: i + 1})
+	}
+	return name, attrs
+}
+
+func isShortcodeSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Divi stores quotes and brackets inside attribute values with these codes
+var (
+	attrDecoder = strings.NewReplacer("%22", `"`, "%91", "[", "%93", "]", "%92", `\`)
+	attrEncoder = strings.NewReplacer(`"`, "%22", "[", "%91", "]", "%93", `\`, "%92")
+)
 
-		tokens = append(tokens, Token{Kind: "shortcode", Value: input[idx : end+1]})
-		i = end + 1
+// decodeAttrValue converts a raw attribute value (with its quotes) into the
+// visible text shown to the translator.
+func decodeAttrValue(raw string) string {
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		raw = raw[1 : len(raw)-1]
 	}
+	return attrDecoder.Replace(raw)
+}
+
+// encodeAttrValue converts translated text back into a double-quoted raw value
+// using Divi's escaping, so it can be written inside the shortcode tag.
+func encodeAttrValue(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return `"` + attrEncoder.Replace(text) + `"`
+}
 
-	return tokens
+// tokenText returns the text a token contributes for translation.
+func tokenText(t Token) string {
+	if t.Kind == "attr" {
+		return decodeAttrValue(t.Value)
+	}
+	return t.Value
+}
+
+// setTokenText stores a translated text in the token, escaping attribute values.
+func setTokenText(t *Token, text string) {
+	if t.Kind == "attr" {
+		t.Value = encodeAttrValue(text)
+		if t.node != nil {
+			a := &t.node.Attrs[t.attr]
+			a.Raw = t.Value
+			a.Value = decodeAttrValue(t.Value)
+		}
+		return
+	}
+	t.Value = text
+	if t.node != nil {
+		t.node.Text = text
+	}
+}
+
+// isTranslatableToken reports whether a token must be sent for translation.
+func isTranslatableToken(t Token) bool {
+	return (t.Kind == "text" || t.Kind == "attr") && strings.TrimSpace(tokenText(t)) != ""
+}
+
+// tokenize splits the input into shortcode tokens, text tokens and
+// translatable attribute tokens by flattening the document's shortcode tree.
+func tokenize(input string) []Token {
+	return parseShortcodeDocument(input).Tokens()
 }
 
 // chunkTokens groups tokens ensuring the cumulative text length per chunk stays under limit.
@@ -73,7 +231,7 @@ func chunkTokens(tokens []Token, limit int) [][]Token {
 	var textLen int
 	for _, t := range tokens {
 		add := 0
-		if t.Kind == "text" {
+		if t.Kind == "text" || t.Kind == "attr" {
 			add = len(t.Value)
 		}
 		if textLen+add > limit && len(current) > 0 {
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const tmBucket = "segments"
+
+// unknownSourceLang is used in TM keys when the source language is not known
+const unknownSourceLang = "auto"
+
+// TranslationMemory stores previously translated segments in a local BoltDB file
+type TranslationMemory struct {
+	db    *bolt.DB
+	path  string
+	fuzzy tmFuzzyIndex // Trigram index for similar segments (built on first use)
+}
+
+// TMEntry is one stored segment translation
+type TMEntry struct {
+	Key        string    `json:"key"`
+	SourceLang string    `json:"sourceLang"`
+	TargetLang string    `json:"targetLang"`
+	SourceText string    `json:"sourceText"`
+	TargetText string    `json:"targetText"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	UseCount   int       `json:"useCount"`
+}
+
+// NewTranslationMemory opens (or creates) the translation memory database.
+// TM_DB_PATH overrides the default translation_memory.db next to the executable.
+func NewTranslationMemory() (*TranslationMemory, error) {
+	path := os.Getenv("TM_DB_PATH")
+	if path == "" {
+		exePath, _ := os.Executable()
+		path = filepath.Join(filepath.Dir(exePath), "translation_memory.db")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creando directorio de memoria de traduccion: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo memoria de traduccion %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(tmBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error inicializando memoria de traduccion: %v", err)
+	}
+
+	return &TranslationMemory{db: db, path: path}, nil
+}
+
+// Close closes the database file
+func (tm *TranslationMemory) Close() {
+	if tm.db != nil {
+		tm.db.Close()
+	}
+}
+
+// Path returns the database file location
+func (tm *TranslationMemory) Path() string {
+	return tm.path
+}
+
+// normalizeSegment trims the text so whitespace differences around a block
+// don't prevent a match
+func normalizeSegment(text string) string {
+	return strings.TrimSpace(text)
+}
+
+// tmKey builds the entry key: source lang, target lang and SHA-256 of the text
+func tmKey(sourceLang, targetLang, text string) string {
+	if sourceLang == "" {
+		sourceLang = unknownSourceLang
+	}
+	sum := sha256.Sum256([]byte(normalizeSegment(text)))
+	return fmt.Sprintf("%s|%s|%s", strings.ToLower(sourceLang), strings.ToLower(targetLang), hex.EncodeToString(sum[:]))
+}
+
+// Lookup returns the exact match for a segment, or nil
+func (tm *TranslationMemory) Lookup(sourceLang, targetLang, text string) (*TMEntry, error) {
+	var entry *TMEntry
+	err := tm.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(tmBucket)).Get([]byte(tmKey(sourceLang, targetLang, text)))
+		if data == nil {
+			return nil
+		}
+		entry = &TMEntry{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo memoria de traduccion: %v", err)
+	}
+	return entry, nil
+}
+
+// Get returns the entry stored under key, or nil
+func (tm *TranslationMemory) Get(key string) (*TMEntry, error) {
+	var entry *TMEntry
+	err := tm.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(tmBucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		entry = &TMEntry{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo memoria de traduccion: %v", err)
+	}
+	return entry, nil
+}
+
+// Put stores or updates a segment translation
+func (tm *TranslationMemory) Put(sourceLang, targetLang, sourceText, targetText string) error {
+	if sourceLang == "" {
+		sourceLang = unknownSourceLang
+	}
+	key := tmKey(sourceLang, targetLang, sourceText)
+	now := time.Now()
+
+	var stored TMEntry
+	err := tm.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tmBucket))
+		entry := TMEntry{
+			Key:        key,
+			SourceLang: strings.ToLower(sourceLang),
+			TargetLang: strings.ToLower(targetLang),
+			SourceText: normalizeSegment(sourceText),
+			CreatedAt:  now,
+		}
+		if data := bucket.Get([]byte(key)); data != nil {
+			json.Unmarshal(data, &entry)
+		}
+		entry.TargetText = normalizeSegment(targetText)
+		entry.UpdatedAt = now
+		stored = entry
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return err
+	}
+	tm.indexEntry(stored)
+	return nil
+}
+
+// Touch increments the use count of an entry after it was reused
+func (tm *TranslationMemory) Touch(key string) error {
+	return tm.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tmBucket))
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		var entry TMEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entry.UseCount++
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
+
+// UpdateTarget replaces the translation of an existing entry
+func (tm *TranslationMemory) UpdateTarget(key, targetText string) (*TMEntry, error) {
+	var entry *TMEntry
+	err := tm.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tmBucket))
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("entrada %s no encontrada", key)
+		}
+		entry = &TMEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return err
+		}
+		entry.TargetText = normalizeSegment(targetText)
+		entry.UpdatedAt = time.Now()
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	tm.indexEntry(*entry)
+	return entry, nil
+}
+
+// TMFilter selects entries for listing and purging. Empty fields match everything.
+type TMFilter struct {
+	Key        string
+	SourceLang string
+	TargetLang string
+	Contains   string    // Substring of source or target text (case-insensitive)
+	Before     time.Time // Only entries last updated before this time
+}
+
+func (f TMFilter) match(e *TMEntry) bool {
+	if f.Key != "" && e.Key != f.Key {
+		return false
+	}
+	if f.SourceLang != "" && !strings.EqualFold(e.SourceLang, f.SourceLang) {
+		return false
+	}
+	if f.TargetLang != "" && !strings.EqualFold(e.TargetLang, f.TargetLang) {
+		return false
+	}
+	if f.Contains != "" {
+		needle := strings.ToLower(f.Contains)
+		if !strings.Contains(strings.ToLower(e.SourceText), needle) && !strings.Contains(strings.ToLower(e.TargetText), needle) {
+			return false
+		}
+	}
+	if !f.Before.IsZero() && !e.UpdatedAt.Before(f.Before) {
+		return false
+	}
+	return true
+}
+
+// Find returns up to limit entries matching the filter, most recently updated first
+func (tm *TranslationMemory) Find(filter TMFilter, limit int) ([]TMEntry, error) {
+	var entries []TMEntry
+	err := tm.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(tmBucket)).ForEach(func(k, v []byte) error {
+			var e TMEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return nil // Skip corrupt entries
+			}
+			if filter.match(&e) {
+				entries = append(entries, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo memoria de traduccion: %v", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].UpdatedAt.After(entries[j].UpdatedAt) })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Purge deletes the entries matching the filter and returns how many were removed
+func (tm *TranslationMemory) Purge(filter TMFilter) (int, error) {
+	removed := 0
+	err := tm.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tmBucket))
+		var keys [][]byte
+		bucket.ForEach(func(k, v []byte) error {
+			var e TMEntry
+			if err := json.Unmarshal(v, &e); err == nil && filter.match(&e) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	tm.invalidateIndex()
+	if err != nil {
+		return removed, fmt.Errorf("error purgando memoria de traduccion: %v", err)
+	}
+	return removed, nil
+}
+
+// Count returns the number of stored segments
+func (tm *TranslationMemory) Count() int {
+	n := 0
+	tm.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte(tmBucket)).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// formatTMEntry renders an entry for tool responses
+func formatTMEntry(e TMEntry) string {
+	return fmt.Sprintf(`key: %s
+%s -> %s | usos: %d | actualizado: %s
+ORIGEN:  %s
+DESTINO: %s
+`, e.Key, e.SourceLang, e.TargetLang, e.UseCount, e.UpdatedAt.Format("2006-01-02 15:04"),
+		truncateForDisplay(e.SourceText, 300), truncateForDisplay(e.TargetText, 300))
+}
+
+// getTranslationMemory returns the translation memory, opening it if needed.
+// Set TM_ENABLED=false to disable it.
+func (s *MCPServer) getTranslationMemory() (*TranslationMemory, error) {
+	if s.parent != nil {
+		return s.parent.getTranslationMemory()
+	}
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.tm != nil {
+		return s.tm, nil
+	}
+	if strings.EqualFold(os.Getenv("TM_ENABLED"), "false") {
+		return nil, fmt.Errorf("memoria de traduccion desactivada (TM_ENABLED=false)")
+	}
+
+	tm, err := NewTranslationMemory()
+	if err != nil {
+		return nil, err
+	}
+	s.tm = tm
+	return s.tm, nil
+}
+
+// prefillFromTranslationMemory looks up every chunk in the translation memory
+// and returns the initial translations, which chunks were filled and how many.
+func (s *MCPServer) prefillFromTranslationMemory(tokens []Token, chunkIndices []int, sourceLang, targetLang string) ([]string, []bool, int) {
+	translations := make([]string, len(chunkIndices))
+	prefilled := make([]bool, len(chunkIndices))
+
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		s.log("Memoria de traduccion no disponible: %v", err)
+		return translations, prefilled, 0
+	}
+
+	hits := 0
+	for i, idx := range chunkIndices {
+		source := tokenText(tokens[idx])
+		entry, err := tm.Lookup(sourceLang, targetLang, source)
+		if err == nil && entry == nil && sourceLang != "" {
+			// Segments stored before the source language was known
+			entry, err = tm.Lookup(unknownSourceLang, targetLang, source)
+		}
+		if err != nil || entry == nil {
+			continue
+		}
+		translations[i] = restoreSurroundingWhitespace(source, entry.TargetText)
+		prefilled[i] = true
+		tm.Touch(entry.Key)
+		hits++
+	}
+	return translations, prefilled, hits
+}
+
+// restoreSurroundingWhitespace keeps the leading/trailing newlines of the
+// original chunk, which the memory stores trimmed
+func restoreSurroundingWhitespace(original, translated string) string {
+	if strings.HasPrefix(original, "\n") && !strings.HasPrefix(translated, "\n") {
+		translated = "\n" + translated
+	}
+	if strings.HasSuffix(original, "\n") && !strings.HasSuffix(translated, "\n") {
+		translated = translated + "\n"
+	}
+	return translated
+}
+
+// storeInTranslationMemory saves the translated chunks of a completed session.
+// Chunks saved with force=true despite fatal validation issues are left out:
+// prefilled chunks are not validated again, so they would be reused unchecked.
+func (s *MCPServer) storeInTranslationMemory(session *BulkTranslationSession) {
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		return
+	}
+
+	forced := make(map[int]bool)
+	for _, issue := range session.ValidationIssues {
+		if issue.Fatal && issue.Chunk > 0 {
+			forced[issue.Chunk-1] = true
+		}
+	}
+
+	stored := 0
+	for i, idx := range session.ChunkIndices {
+		if session.isPrefilled(i) || forced[i] || strings.TrimSpace(session.Translations[i]) == "" {
+			continue
+		}
+		if err := tm.Put(session.SourceLang, session.TargetLang, tokenText(session.Tokens[idx]), session.Translations[i]); err != nil {
+			s.log("Error guardando en memoria de traduccion: %v", err)
+			return
+		}
+		stored++
+	}
+	s.log("Memoria de traduccion: %d segmentos guardados (extractionId=%s)", stored, session.ExtractionID)
+}
+
+func (s *MCPServer) handleTMLookup(req JSONRPCRequest, params CallToolParams) {
+	text, _ := params.Arguments["text"].(string)
+	contains, _ := params.Arguments["contains"].(string)
+	sourceLang, _ := params.Arguments["sourceLang"].(string)
+	targetLang, _ := params.Arguments["targetLang"].(string)
+	limitFloat, _ := params.Arguments["limit"].(float64)
+	limit := int(limitFloat)
+	if limit <= 0 {
+		limit = 20
+	}
+
+	if text == "" && contains == "" && targetLang == "" {
+		s.writeToolText(req, "ERROR: indica text, contains o targetLang", true)
+		return
+	}
+
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("MEMORIA DE TRADUCCION\n=====================\n")
+	b.WriteString(fmt.Sprintf("Archivo: %s\nSegmentos totales: %d\n\n", tm.Path(), tm.Count()))
+
+	if text != "" {
+		// Exact lookup by hash, across target languages if none given
+		key := ""
+		if targetLang != "" {
+			key = tmKey(sourceLang, targetLang, text)
+		}
+		entries, err := tm.Find(TMFilter{Key: key, SourceLang: sourceLang, TargetLang: targetLang}, 0)
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		found := 0
+		for _, e := range entries {
+			if e.SourceText == normalizeSegment(text) {
+				b.WriteString(formatTMEntry(e))
+				b.WriteString("\n")
+				found++
+			}
+		}
+		b.WriteString(fmt.Sprintf("Coincidencias exactas: %d\n", found))
+
+		// Similar segments (only meaningful for a concrete language pair)
+		if targetLang != "" {
+			matches, err := tm.FuzzyLookup(sourceLang, targetLang, text, fuzzyThreshold(), limit)
+			if err != nil {
+				s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+				return
+			}
+			b.WriteString(fmt.Sprintf("\nCoincidencias parciales (umbral %.0f%%): %d\n\n", fuzzyThreshold()*100, len(matches)))
+			for _, m := range matches {
+				b.WriteString(fmt.Sprintf("[%.0f%%] %s\n", m.Score*100, formatTMEntry(m.Entry)))
+			}
+		}
+	} else {
+		entries, err := tm.Find(TMFilter{SourceLang: sourceLang, TargetLang: targetLang, Contains: contains}, limit)
+		if err != nil {
+			s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+			return
+		}
+		for _, e := range entries {
+			b.WriteString(formatTMEntry(e))
+			b.WriteString("\n")
+		}
+		b.WriteString(fmt.Sprintf("Entradas mostradas: %d (limite %d)\n", len(entries), limit))
+	}
+
+	s.writeToolText(req, b.String(), false)
+}
+
+func (s *MCPServer) handleTMEdit(req JSONRPCRequest, params CallToolParams) {
+	key, _ := params.Arguments["key"].(string)
+	targetText, _ := params.Arguments["targetText"].(string)
+
+	if key == "" || strings.TrimSpace(targetText) == "" {
+		s.writeToolText(req, "ERROR: key y targetText son obligatorios", true)
+		return
+	}
+
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	entry, err := tm.UpdateTarget(key, targetText)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR actualizando entrada: %v", err), true)
+		return
+	}
+
+	s.writeToolText(req, "ENTRADA ACTUALIZADA\n===================\n"+formatTMEntry(*entry), false)
+}
+
+func (s *MCPServer) handleTMPurge(req JSONRPCRequest, params CallToolParams) {
+	filter := TMFilter{}
+	filter.Key, _ = params.Arguments["key"].(string)
+	filter.SourceLang, _ = params.Arguments["sourceLang"].(string)
+	filter.TargetLang, _ = params.Arguments["targetLang"].(string)
+	filter.Contains, _ = params.Arguments["contains"].(string)
+	all, _ := params.Arguments["all"].(bool)
+	if days, ok := params.Arguments["olderThanDays"].(float64); ok && days > 0 {
+		filter.Before = time.Now().Add(-time.Duration(days*24) * time.Hour)
+	}
+
+	if !all && filter == (TMFilter{}) {
+		s.writeToolText(req, "ERROR: indica key, sourceLang, targetLang, contains u olderThanDays (o all=true para vaciar la memoria)", true)
+		return
+	}
+
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	removed, err := tm.Purge(filter)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	s.writeToolText(req, fmt.Sprintf(`MEMORIA DE TRADUCCION PURGADA
+=============================
+Entradas eliminadas: %d
+Entradas restantes: %d`, removed, tm.Count()), false)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultFuzzyThreshold is the minimum similarity shown as a suggestion
+const defaultFuzzyThreshold = 0.75
+
+// maxFuzzyCandidates limits how many trigram candidates get a full score
+const maxFuzzyCandidates = 20
+
+// TMMatch is a fuzzy translation memory hit for a chunk
+type TMMatch struct {
+	Entry TMEntry
+	Score float64 // 0..1 word-level similarity
+}
+
+// tmFuzzyIndex maps character trigrams to the keys of the segments containing them
+type tmFuzzyIndex struct {
+	mu       sync.RWMutex
+	built    bool
+	trigrams map[string]map[string]struct{} // trigram -> set of keys
+	entries  map[string]*TMEntry            // key -> entry
+	sizes    map[string]int                 // key -> number of trigrams
+}
+
+// fuzzyThreshold reads TM_FUZZY_THRESHOLD (0-1 or 0-100), defaulting to 75%
+func fuzzyThreshold() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("TM_FUZZY_THRESHOLD"), 64)
+	if err != nil || v <= 0 {
+		return defaultFuzzyThreshold
+	}
+	if v > 1 {
+		v = v / 100
+	}
+	return v
+}
+
+// segmentTrigrams returns the set of lowercase character trigrams of a text,
+// with runs of whitespace collapsed
+func segmentTrigrams(text string) map[string]struct{} {
+	runes := []rune(strings.ToLower(strings.Join(strings.Fields(text), " ")))
+	grams := make(map[string]struct{})
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = struct{}{}
+	}
+	return grams
+}
+
+// segmentWords splits a text into words and punctuation/tag tokens for scoring
+func segmentWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>'
+	})
+}
+
+// wordSimilarity returns 1 - (word edit distance / longest length)
+func wordSimilarity(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return 1 - float64(prev[len(b)])/float64(longest)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (idx *tmFuzzyIndex) add(e *TMEntry) {
+	idx.entries[e.Key] = e
+	grams := segmentTrigrams(e.SourceText)
+	idx.sizes[e.Key] = len(grams)
+	for g := range grams {
+		if idx.trigrams[g] == nil {
+			idx.trigrams[g] = make(map[string]struct{})
+		}
+		idx.trigrams[g][e.Key] = struct{}{}
+	}
+}
+
+// ensureIndex loads every stored segment into the trigram index on first use
+func (tm *TranslationMemory) ensureIndex() error {
+	tm.fuzzy.mu.Lock()
+	defer tm.fuzzy.mu.Unlock()
+	if tm.fuzzy.built {
+		return nil
+	}
+
+	tm.fuzzy.trigrams = make(map[string]map[string]struct{})
+	tm.fuzzy.entries = make(map[string]*TMEntry)
+	tm.fuzzy.sizes = make(map[string]int)
+	err := tm.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(tmBucket)).ForEach(func(k, v []byte) error {
+			e := &TMEntry{}
+			if err := json.Unmarshal(v, e); err == nil {
+				tm.fuzzy.add(e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	tm.fuzzy.built = true
+	return nil
+}
+
+// indexEntry adds or refreshes an entry in the index if it has been built
+func (tm *TranslationMemory) indexEntry(e TMEntry) {
+	tm.fuzzy.mu.Lock()
+	defer tm.fuzzy.mu.Unlock()
+	if tm.fuzzy.built {
+		tm.fuzzy.add(&e)
+	}
+}
+
+// invalidateIndex forces a rebuild on the next fuzzy lookup
+func (tm *TranslationMemory) invalidateIndex() {
+	tm.fuzzy.mu.Lock()
+	tm.fuzzy.built = false
+	tm.fuzzy.trigrams = nil
+	tm.fuzzy.entries = nil
+	tm.fuzzy.sizes = nil
+	tm.fuzzy.mu.Unlock()
+}
+
+// FuzzyLookup returns the best stored segments for the language pair whose
+// similarity with text is at least threshold, best first. Segments stored
+// with an unknown source language match any source language, as in the exact
+// lookup of prefillFromTranslationMemory; on equal score the known language wins.
+func (tm *TranslationMemory) FuzzyLookup(sourceLang, targetLang, text string, threshold float64, limit int) ([]TMMatch, error) {
+	if err := tm.ensureIndex(); err != nil {
+		return nil, err
+	}
+	if sourceLang == "" {
+		sourceLang = unknownSourceLang
+	}
+	normalized := normalizeSegment(text)
+	grams := segmentTrigrams(normalized)
+	if len(grams) == 0 {
+		return nil, nil
+	}
+
+	tm.fuzzy.mu.RLock()
+	defer tm.fuzzy.mu.RUnlock()
+
+	// Count shared trigrams per candidate in the same language pair
+	shared := make(map[string]int)
+	for g := range grams {
+		for key := range tm.fuzzy.trigrams[g] {
+			e := tm.fuzzy.entries[key]
+			if !strings.EqualFold(e.TargetLang, targetLang) {
+				continue
+			}
+			if !strings.EqualFold(e.SourceLang, sourceLang) && !strings.EqualFold(e.SourceLang, unknownSourceLang) {
+				continue
+			}
+			shared[key]++
+		}
+	}
+
+	// Rank by Dice coefficient over trigrams, then score the best candidates by words
+	type candidate struct {
+		key  string
+		dice float64
+	}
+	var candidates []candidate
+	for key, n := range shared {
+		dice := 2 * float64(n) / float64(len(grams)+tm.fuzzy.sizes[key])
+		if dice >= threshold*0.8 {
+			candidates = append(candidates, candidate{key, dice})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dice > candidates[j].dice })
+	if len(candidates) > maxFuzzyCandidates {
+		candidates = candidates[:maxFuzzyCandidates]
+	}
+
+	words := segmentWords(normalized)
+	var matches []TMMatch
+	for _, c := range candidates {
+		e := tm.fuzzy.entries[c.key]
+		if e.SourceText == normalized {
+			continue // Exact matches are reused directly, not suggested
+		}
+		score := wordSimilarity(words, segmentWords(e.SourceText))
+		if score >= threshold {
+			matches = append(matches, TMMatch{Entry: *e, Score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return strings.EqualFold(matches[i].Entry.SourceLang, sourceLang) && !strings.EqualFold(matches[j].Entry.SourceLang, sourceLang)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// suggestFromTranslationMemory stores the best fuzzy match of every chunk that
+// was not reused exactly, so the extraction prompt can show it as a hint
+func (s *MCPServer) suggestFromTranslationMemory(session *BulkTranslationSession) {
+	session.FuzzyMatches = make([]*TMMatch, session.TotalChunks)
+
+	tm, err := s.getTranslationMemory()
+	if err != nil {
+		return
+	}
+
+	threshold := fuzzyThreshold()
+	for i, idx := range session.ChunkIndices {
+		if session.isPrefilled(i) {
+			continue
+		}
+		matches, err := tm.FuzzyLookup(session.SourceLang, session.TargetLang, tokenText(session.Tokens[idx]), threshold, 1)
+		if err != nil {
+			s.log("Error en busqueda difusa de la memoria de traduccion: %v", err)
+			return
+		}
+		if len(matches) > 0 {
+			session.FuzzyMatches[i] = &matches[0]
+			session.FuzzyHits++
+		}
+	}
+}
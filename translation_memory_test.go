@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreInTranslationMemorySkipsForcedChunks(t *testing.T) {
+	t.Setenv("TM_ENABLED", "")
+	t.Setenv("TM_DB_PATH", filepath.Join(t.TempDir(), "tm.db"))
+	s := &MCPServer{stderr: io.Discard}
+	t.Cleanup(func() {
+		if s.tm != nil {
+			s.tm.Close()
+		}
+	})
+
+	source := `[et_pb_section][et_pb_text]<p>Bienvenidos a nuestra web</p>[/et_pb_text][et_pb_text]<p>Hola {{nombre}}, pide hoy tu presupuesto</p>[/et_pb_text][/et_pb_section]`
+	tokens := parseShortcodeDocument(source).Tokens()
+	chunkIndices, _ := translatableChunks(tokens, false, 0)
+	if len(chunkIndices) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunkIndices))
+	}
+
+	// The second chunk lost its placeholder and was saved with force=true
+	session := &BulkTranslationSession{
+		ExtractionID: "test",
+		SourceLang:   "es",
+		TargetLang:   "en",
+		Tokens:       tokens,
+		ChunkIndices: chunkIndices,
+		Translations: []string{"<p>Welcome to our website</p>", "<p>Hello, ask for your quote today</p>"},
+	}
+	report := &ValidationReport{}
+	for i, idx := range chunkIndices {
+		validateChunk(report, i+1, tokenText(tokens[idx]), session.Translations[i])
+	}
+	if !report.HasFatal() {
+		t.Fatal("the broken translation should have fatal issues")
+	}
+	session.ValidationIssues = report.Issues
+
+	s.storeInTranslationMemory(session)
+
+	translations, prefilled, hits := s.prefillFromTranslationMemory(tokens, chunkIndices, "es", "en")
+	if hits != 1 || !prefilled[0] || prefilled[1] {
+		t.Fatalf("prefilled = %v (%d hits), want only the first chunk", prefilled, hits)
+	}
+	if translations[0] != session.Translations[0] {
+		t.Errorf("first chunk = %q, want %q", translations[0], session.Translations[0])
+	}
+	if translations[1] != "" {
+		t.Errorf("forced broken chunk was reused: %q", translations[1])
+	}
+}
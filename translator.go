@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Machine translation providers
+const (
+	mtDeepL          = "deepl"
+	mtGoogle         = "google"
+	mtOpenAI         = "openai"
+	mtLibreTranslate = "libretranslate"
+)
+
+// defaultMTBatchSize is how many segments are sent per request (DeepL's limit)
+const defaultMTBatchSize = 50
+
+// defaultMTTimeout bounds each request to a translation API
+const defaultMTTimeout = 60 * time.Second
+
+// Translator translates text segments server-side. Segments may contain HTML,
+// which must be preserved. The result has one translation per input segment.
+type Translator interface {
+	Name() string
+	Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error)
+}
+
+// newTranslator builds the backend named by provider, or by MT_PROVIDER when
+// provider is empty
+func newTranslator(provider string) (Translator, error) {
+	if provider == "" {
+		provider = os.Getenv("MT_PROVIDER")
+	}
+	client := &http.Client{Timeout: mtTimeout()}
+
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case mtDeepL:
+		return newDeepLTranslator(client)
+	case mtGoogle:
+		return newGoogleTranslator(client)
+	case mtOpenAI:
+		return newOpenAITranslator(client)
+	case mtLibreTranslate:
+		return newLibreTranslator(client)
+	case "":
+		return nil, fmt.Errorf("no hay proveedor de traduccion automatica: configura MT_PROVIDER (deepl, google, openai, libretranslate)")
+	}
+	return nil, fmt.Errorf("proveedor de traduccion automatica no soportado: %s", provider)
+}
+
+func mtTimeout() time.Duration {
+	v := strings.TrimSpace(os.Getenv("MT_TIMEOUT"))
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	return defaultMTTimeout
+}
+
+func mtBatchSize() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MT_BATCH_SIZE"))); err == nil && n > 0 {
+		return n
+	}
+	return defaultMTBatchSize
+}
+
+// translateInBatches splits the segments into requests of MT_BATCH_SIZE
+func translateInBatches(ctx context.Context, tr Translator, texts []string, sourceLang, targetLang string) ([]string, error) {
+	size := mtBatchSize()
+	result := make([]string, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		translated, err := tr.Translate(ctx, texts[start:end], sourceLang, targetLang)
+		if err != nil {
+			return nil, err
+		}
+		if len(translated) != end-start {
+			return nil, fmt.Errorf("%s devolvio %d traducciones para %d segmentos", tr.Name(), len(translated), end-start)
+		}
+		result = append(result, translated...)
+	}
+	return result, nil
+}
+
+// postJSON sends a JSON request and decodes the JSON response into out
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return fmt.Errorf("error leyendo respuesta: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncateForDisplay(strings.TrimSpace(string(respBody)), 300))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("respuesta no valida: %v", err)
+	}
+	return nil
+}
+
+// slugAccents folds the accented letters of Western European languages
+var slugAccents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c", "ß", "ss", "œ", "oe", "æ", "ae", "l·l", "ll",
+)
+
+// slugify builds a WordPress-style slug from a translated title
+func slugify(title string) string {
+	title = slugAccents.Replace(strings.ToLower(title))
+	var b strings.Builder
+	dash := false
+	for _, r := range title {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// machineTranslatePart translates the pending chunks of the current part (and
+// the post metadata on the first part) and returns them in the marker format
+// of submit_bulk_translation
+func (s *MCPServer) machineTranslatePart(ctx context.Context, tr Translator, session *BulkTranslationSession) (string, int, error) {
+	partRange := session.PartRanges[session.CurrentPart]
+
+	var texts []string
+	var chunks []int
+	for i := partRange[0]; i < partRange[1]; i++ {
+		if session.isPrefilled(i) {
+			continue
+		}
+		texts = append(texts, strings.TrimSpace(tokenText(session.Tokens[session.ChunkIndices[i]])))
+		chunks = append(chunks, i)
+	}
+
+	withMeta := session.SourceType == "wordpress" && session.CurrentPart == 0
+	if withMeta {
+		texts = append(texts, session.OriginalTitle, session.OriginalExcerpt)
+		for _, f := range session.SEOMeta {
+			texts = append(texts, protectSEOVariables(f.Original))
+		}
+	}
+
+	// Empty segments are not sent: some APIs reject them
+	var send []string
+	var sendIdx []int
+	for i, t := range texts {
+		if strings.TrimSpace(t) != "" {
+			send = append(send, t)
+			sendIdx = append(sendIdx, i)
+		}
+	}
+	translated := make([]string, len(texts))
+	copy(translated, texts)
+	if len(send) > 0 {
+		out, err := translateInBatches(ctx, tr, send, session.SourceLang, session.TargetLang)
+		if err != nil {
+			return "", 0, fmt.Errorf("error de %s: %v", tr.Name(), err)
+		}
+		for j, i := range sendIdx {
+			translated[i] = out[j]
+		}
+	}
+
+	var b strings.Builder
+	if withMeta {
+		title := translated[len(chunks)]
+		slug := slugify(title)
+		if slug == "" {
+			slug = session.OriginalSlug
+		}
+		b.WriteString(fmt.Sprintf("{{POST_TITLE}}\n%s\n{{/POST_TITLE}}\n\n{{POST_SLUG}}\n%s\n{{/POST_SLUG}}\n\n{{POST_EXCERPT}}\n%s\n{{/POST_EXCERPT}}\n\n",
+			title, slug, translated[len(chunks)+1]))
+		for j, f := range session.SEOMeta {
+			openMarker, closeMarker := seoMetaMarkers(f.Key)
+			b.WriteString(fmt.Sprintf("%s\n%s\n%s\n\n", openMarker, unprotectSEOVariables(translated[len(chunks)+2+j]), closeMarker))
+		}
+	}
+	for j, i := range chunks {
+		b.WriteString(fmt.Sprintf("{{CHUNK_%03d}}\n%s\n{{/CHUNK_%03d}}\n\n", i+1, translated[j], i+1))
+	}
+	if b.Len() == 0 {
+		return "OK", 0, nil // Every chunk of the part came from the translation memory
+	}
+
+	chars := 0
+	for _, t := range send {
+		chars += len(t)
+	}
+	return b.String(), chars, nil
+}
+
+// machineTranslateSession translates every remaining part of a locked session
+// and feeds each one through submitBulkPart, which saves the document after
+// the last part. It stops at the first error or validation failure.
+func (s *MCPServer) machineTranslateSession(ctx context.Context, tr Translator, session *BulkTranslationSession, force bool) (string, bool) {
+	chars := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return "Traduccion automatica cancelada", true
+		}
+
+		part := session.CurrentPart + 1
+		text, n, err := s.machineTranslatePart(ctx, tr, session)
+		if err != nil {
+			return fmt.Sprintf("ERROR en la parte %d de %d: %v", part, session.Parts, err), true
+		}
+		chars += n
+
+		result, isError := s.submitBulkPart(ctx, session, text, force)
+		if strings.HasPrefix(result, "ERROR") {
+			// Parsing or saving failed, not the translation: forcing would not help
+			return fmt.Sprintf("TRADUCCION AUTOMATICA (%s) NO GUARDADA en la parte %d de %d:\n\n%s", tr.Name(), part, session.Parts, result), true
+		}
+		if isError {
+			return fmt.Sprintf("Parte %d de %d rechazada (extractionId %s sigue activa; corrige con submit_bulk_translation o reintenta con force=true):\n\n%s",
+				part, session.Parts, session.ExtractionID, result), true
+		}
+		s.notifyLog("info", "Traduccion automatica (%s) de %s: parte %d de %d recibida", tr.Name(), session.ExtractionID, part, session.Parts)
+		if session.CurrentPart >= session.Parts {
+			s.log("Traduccion automatica (%s) de %s: %d caracteres", tr.Name(), session.ExtractionID, chars)
+			return fmt.Sprintf("TRADUCCION AUTOMATICA (%s): %d caracteres enviados\n\n%s", tr.Name(), chars, result), false
+		}
+	}
+}
+
+func (s *MCPServer) handleMachineTranslate(req JSONRPCRequest, params CallToolParams) {
+	extractionID, _ := params.Arguments["extractionId"].(string)
+	jobID, _ := params.Arguments["jobId"].(string)
+	provider, _ := params.Arguments["provider"].(string)
+	force, _ := params.Arguments["force"].(bool)
+
+	if (extractionID == "") == (jobID == "") {
+		s.writeToolText(req, "ERROR: indica extractionId o jobId", true)
+		return
+	}
+
+	tr, err := newTranslator(provider)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+
+	if jobID != "" {
+		s.machineTranslateBatchJob(req, tr, jobID, force)
+		return
+	}
+
+	session := s.lockOwnExtraction(extractionID)
+	if session == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: extractionId '%s' no encontrado. Usa extract_divi_text o extract_wordpress_text primero.", extractionID), true)
+		return
+	}
+	defer session.mu.Unlock()
+
+	text, isError := s.machineTranslateSession(req.Context(), tr, session, force)
+	s.writeToolText(req, text, isError)
+}
+
+// machineTranslateBatchJob extracts and translates every remaining post of a
+// batch job. A post that fails is marked as failed and its extraction is kept,
+// so it can still be finished by hand; the job goes on with the next one.
+func (s *MCPServer) machineTranslateBatchJob(req JSONRPCRequest, tr Translator, jobID string, force bool) {
+	job := s.lookupBatchJob(jobID, false)
+	if job == nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: jobId '%s' no encontrado. Usa create_batch_job primero.", jobID), true)
+		return
+	}
+
+	ctx := req.Context()
+	var failures []string
+	for {
+		job.mu.Lock()
+		session, item, _, err := s.advanceBatchJob(ctx, job, false)
+		job.mu.Unlock()
+		if err != nil {
+			s.writeToolText(req, err.Error(), true)
+			return
+		}
+		if session == nil {
+			break
+		}
+
+		// submitBulkPart completes the batch item itself once the post is saved
+		text, isError := s.machineTranslateSession(ctx, tr, session, force)
+		session.mu.Unlock()
+		if !isError {
+			s.notifyBatchProgress(job, item, "guardado")
+			continue
+		}
+		if ctx.Err() != nil {
+			s.writeToolText(req, text, true)
+			return
+		}
+
+		job.mu.Lock()
+		item.Status = batchFailed
+		item.Message = "traduccion automatica: " + truncateForDisplay(text, 200)
+		job.UpdatedAt = time.Now()
+		s.persistBatchJob(job)
+		job.mu.Unlock()
+		s.notifyBatchProgress(job, item, "fallido")
+		failures = append(failures, fmt.Sprintf("- Post %d (extractionId %s): %s", item.PostID, item.ExtractionID, truncateForDisplay(text, 300)))
+	}
+
+	job.mu.Lock()
+	summary := job.summary()
+	job.mu.Unlock()
+
+	text := fmt.Sprintf("TRADUCCION AUTOMATICA DEL LOTE (%s)\n\n%s", tr.Name(), summary)
+	if len(failures) > 0 {
+		text += "\n\nFallos (las extracciones siguen activas para corregirlas a mano):\n" + strings.Join(failures, "\n")
+	}
+	s.writeToolText(req, text, false)
+}
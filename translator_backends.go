@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- DeepL ---
+
+// deeplTranslator uses the DeepL API v2 (DEEPL_API_KEY, DEEPL_API_URL)
+type deeplTranslator struct {
+	client *http.Client
+	url    string
+	key    string
+}
+
+func newDeepLTranslator(client *http.Client) (*deeplTranslator, error) {
+	key := os.Getenv("DEEPL_API_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("DEEPL_API_KEY no configurada")
+	}
+	url := os.Getenv("DEEPL_API_URL")
+	if url == "" {
+		// Free plan keys end in ":fx" and use their own host
+		url = "https://api.deepl.com"
+		if strings.HasSuffix(key, ":fx") {
+			url = "https://api-free.deepl.com"
+		}
+	}
+	return &deeplTranslator{client: client, url: strings.TrimSuffix(url, "/"), key: key}, nil
+}
+
+func (t *deeplTranslator) Name() string { return mtDeepL }
+
+// deeplTargetLang maps a language code to a DeepL target; EN and PT need a
+// regional variant
+func deeplTargetLang(lang string) string {
+	lang = strings.ToUpper(lang)
+	switch lang {
+	case "EN":
+		return "EN-GB"
+	case "PT":
+		return "PT-PT"
+	}
+	return lang
+}
+
+func (t *deeplTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	body := map[string]interface{}{
+		"text":         texts,
+		"target_lang":  deeplTargetLang(targetLang),
+		"tag_handling": "html",
+	}
+	if sourceLang != "" {
+		// Source languages have no regional variants
+		body["source_lang"] = strings.ToUpper(strings.SplitN(sourceLang, "-", 2)[0])
+	}
+
+	var resp struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	headers := map[string]string{"Authorization": "DeepL-Auth-Key " + t.key}
+	if err := postJSON(ctx, t.client, t.url+"/v2/translate", headers, body, &resp); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(resp.Translations))
+	for i, tr := range resp.Translations {
+		out[i] = tr.Text
+	}
+	return out, nil
+}
+
+// --- Google Cloud Translation v3 ---
+
+// googleTranslator uses Cloud Translation v3 translateText. It authenticates
+// with an OAuth access token (GOOGLE_ACCESS_TOKEN, e.g. from
+// "gcloud auth print-access-token").
+type googleTranslator struct {
+	client   *http.Client
+	url      string
+	project  string
+	location string
+	token    string
+}
+
+func newGoogleTranslator(client *http.Client) (*googleTranslator, error) {
+	t := &googleTranslator{
+		client:   client,
+		url:      os.Getenv("GOOGLE_TRANSLATE_URL"),
+		project:  os.Getenv("GOOGLE_PROJECT_ID"),
+		location: os.Getenv("GOOGLE_LOCATION"),
+		token:    os.Getenv("GOOGLE_ACCESS_TOKEN"),
+	}
+	if t.project == "" || t.token == "" {
+		return nil, fmt.Errorf("GOOGLE_PROJECT_ID y GOOGLE_ACCESS_TOKEN son obligatorios")
+	}
+	if t.url == "" {
+		t.url = "https://translation.googleapis.com"
+	}
+	t.url = strings.TrimSuffix(t.url, "/")
+	if t.location == "" {
+		t.location = "global"
+	}
+	return t, nil
+}
+
+func (t *googleTranslator) Name() string { return mtGoogle }
+
+func (t *googleTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	body := map[string]interface{}{
+		"contents":           texts,
+		"mimeType":           "text/html",
+		"targetLanguageCode": targetLang,
+	}
+	if sourceLang != "" {
+		body["sourceLanguageCode"] = sourceLang
+	}
+
+	var resp struct {
+		Translations []struct {
+			TranslatedText string `json:"translatedText"`
+		} `json:"translations"`
+	}
+	url := fmt.Sprintf("%s/v3/projects/%s/locations/%s:translateText", t.url, t.project, t.location)
+	headers := map[string]string{"Authorization": "Bearer " + t.token}
+	if err := postJSON(ctx, t.client, url, headers, body, &resp); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(resp.Translations))
+	for i, tr := range resp.Translations {
+		out[i] = tr.TranslatedText
+	}
+	return out, nil
+}
+
+// --- OpenAI-compatible chat completions ---
+
+// openAITranslator asks a chat model (OPENAI_API_URL, OPENAI_API_KEY,
+// OPENAI_MODEL) to translate a JSON array of segments. Any server with an
+// OpenAI-compatible /chat/completions endpoint works (vLLM, Ollama, etc.).
+type openAITranslator struct {
+	client *http.Client
+	url    string
+	key    string
+	model  string
+}
+
+func newOpenAITranslator(client *http.Client) (*openAITranslator, error) {
+	t := &openAITranslator{
+		client: client,
+		url:    os.Getenv("OPENAI_API_URL"),
+		key:    os.Getenv("OPENAI_API_KEY"),
+		model:  os.Getenv("OPENAI_MODEL"),
+	}
+	if t.url == "" {
+		t.url = "https://api.openai.com/v1"
+		if t.key == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY no configurada")
+		}
+	}
+	t.url = strings.TrimSuffix(t.url, "/")
+	if t.model == "" {
+		return nil, fmt.Errorf("OPENAI_MODEL no configurado")
+	}
+	return t, nil
+}
+
+func (t *openAITranslator) Name() string { return mtOpenAI }
+
+const openAISystemPrompt = `You are a professional website translator. You receive a JSON array of text segments from a WordPress page built with Divi.
+Translate each segment %s into the language with code "%s".
+Rules:
+- Reply ONLY with a JSON array of strings, with exactly %d elements, in the same order.
+- Keep HTML tags, attributes (class, style, href, src, id, data-*), entities and placeholders exactly as they are.
+- Translate visible text only. Do not add explanations.`
+
+func (t *openAITranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	from := "from its detected language"
+	if sourceLang != "" {
+		from = fmt.Sprintf("from the language with code \"%s\"", sourceLang)
+	}
+	// Without HTML escaping the model sees the tags as written (<b>, not \u003cb\u003e)
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(texts); err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"model":       t.model,
+		"temperature": 0,
+		"messages": []map[string]string{
+			{"role": "system", "content": fmt.Sprintf(openAISystemPrompt, from, targetLang, len(texts))},
+			{"role": "user", "content": strings.TrimSpace(input.String())},
+		},
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	headers := map[string]string{}
+	if t.key != "" {
+		headers["Authorization"] = "Bearer " + t.key
+	}
+	if err := postJSON(ctx, t.client, t.url+"/chat/completions", headers, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("respuesta sin contenido")
+	}
+
+	// Models sometimes wrap the array in a code fence
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var out []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &out); err != nil {
+		return nil, fmt.Errorf("el modelo no devolvio un array JSON: %s", truncateForDisplay(content, 200))
+	}
+	return out, nil
+}
+
+// --- LibreTranslate ---
+
+// libreTranslator uses a LibreTranslate server (LIBRETRANSLATE_URL,
+// LIBRETRANSLATE_API_KEY)
+type libreTranslator struct {
+	client *http.Client
+	url    string
+	key    string
+}
+
+func newLibreTranslator(client *http.Client) (*libreTranslator, error) {
+	url := os.Getenv("LIBRETRANSLATE_URL")
+	if url == "" {
+		return nil, fmt.Errorf("LIBRETRANSLATE_URL no configurada")
+	}
+	return &libreTranslator{client: client, url: strings.TrimSuffix(url, "/"), key: os.Getenv("LIBRETRANSLATE_API_KEY")}, nil
+}
+
+func (t *libreTranslator) Name() string { return mtLibreTranslate }
+
+func (t *libreTranslator) Translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, error) {
+	source := sourceLang
+	if source == "" {
+		source = "auto"
+	}
+	body := map[string]interface{}{
+		"q":      texts,
+		"source": source,
+		"target": targetLang,
+		"format": "html",
+	}
+	if t.key != "" {
+		body["api_key"] = t.key
+	}
+
+	// translatedText is an array when q is an array
+	var resp struct {
+		TranslatedText json.RawMessage `json:"translatedText"`
+	}
+	if err := postJSON(ctx, t.client, t.url+"/translate", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	var out []string
+	if err := json.Unmarshal(resp.TranslatedText, &out); err != nil {
+		var single string
+		if err := json.Unmarshal(resp.TranslatedText, &single); err != nil {
+			return nil, fmt.Errorf("respuesta no valida: %s", truncateForDisplay(string(resp.TranslatedText), 200))
+		}
+		out = []string{single}
+	}
+	return out, nil
+}
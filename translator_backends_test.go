@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mtRequest is a request received by a mock translation API
+type mtRequest struct {
+	Path    string
+	Headers http.Header
+	Body    map[string]interface{}
+}
+
+// mockMT starts a translation API mock answering with respond and records
+// every request it receives
+func mockMT(t *testing.T, respond func(req mtRequest) (int, interface{})) (*httptest.Server, func() []mtRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []mtRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		req := mtRequest{Path: r.URL.Path, Headers: r.Header.Clone()}
+		if err := json.Unmarshal(data, &req.Body); err != nil {
+			t.Errorf("request body is not JSON: %q", data)
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		status, body := respond(req)
+		w.WriteHeader(status)
+		if s, ok := body.(string); ok {
+			io.WriteString(w, s)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []mtRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]mtRequest(nil), requests...)
+	}
+}
+
+// bodyStrings returns a []string member of a decoded JSON body
+func bodyStrings(t *testing.T, body map[string]interface{}, key string) []string {
+	t.Helper()
+	items, ok := body[key].([]interface{})
+	if !ok {
+		t.Fatalf("%s is not an array: %v", key, body[key])
+	}
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i], _ = it.(string)
+	}
+	return out
+}
+
+func upperAll(texts []string) []string {
+	out := make([]string, len(texts))
+	for i, s := range texts {
+		out[i] = strings.ToUpper(s)
+	}
+	return out
+}
+
+func assertTranslations(t *testing.T, got []string, err error, want ...string) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("translations = %q, want %q", got, want)
+	}
+}
+
+func deeplResponse(texts []string) map[string]interface{} {
+	var tr []map[string]string
+	for _, s := range upperAll(texts) {
+		tr = append(tr, map[string]string{"text": s})
+	}
+	return map[string]interface{}{"translations": tr}
+}
+
+func TestDeepLTranslator(t *testing.T) {
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, deeplResponse(bodyStrings(t, req.Body, "text"))
+	})
+	t.Setenv("DEEPL_API_KEY", "secret")
+	t.Setenv("DEEPL_API_URL", srv.URL+"/")
+
+	tr, err := newTranslator(mtDeepL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tr.Translate(context.Background(), []string{"<p>hola</p>", "adios"}, "es-ES", "en")
+	assertTranslations(t, got, err, "<P>HOLA</P>", "ADIOS")
+
+	req := requests()[0]
+	if req.Path != "/v2/translate" {
+		t.Errorf("path = %s", req.Path)
+	}
+	if auth := req.Headers.Get("Authorization"); auth != "DeepL-Auth-Key secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if req.Body["target_lang"] != "EN-GB" || req.Body["source_lang"] != "ES" || req.Body["tag_handling"] != "html" {
+		t.Errorf("body = %v", req.Body)
+	}
+
+	// Without a source language DeepL detects it
+	tr.Translate(context.Background(), []string{"x"}, "", "ca")
+	if req := requests()[1]; req.Body["source_lang"] != nil || req.Body["target_lang"] != "CA" {
+		t.Errorf("body without source = %v", req.Body)
+	}
+}
+
+func TestDeepLFreeKeyHost(t *testing.T) {
+	t.Setenv("DEEPL_API_URL", "")
+	t.Setenv("DEEPL_API_KEY", "abc:fx")
+	tr, err := newDeepLTranslator(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.url != "https://api-free.deepl.com" {
+		t.Errorf("url = %s", tr.url)
+	}
+	t.Setenv("DEEPL_API_KEY", "")
+	if _, err := newDeepLTranslator(http.DefaultClient); err == nil {
+		t.Error("a missing key should be an error")
+	}
+}
+
+func TestGoogleTranslator(t *testing.T) {
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		var tr []map[string]string
+		for _, s := range upperAll(bodyStrings(t, req.Body, "contents")) {
+			tr = append(tr, map[string]string{"translatedText": s})
+		}
+		return 200, map[string]interface{}{"translations": tr}
+	})
+	t.Setenv("GOOGLE_TRANSLATE_URL", srv.URL)
+	t.Setenv("GOOGLE_PROJECT_ID", "proj")
+	t.Setenv("GOOGLE_LOCATION", "")
+	t.Setenv("GOOGLE_ACCESS_TOKEN", "tok")
+
+	tr, err := newTranslator(mtGoogle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tr.Translate(context.Background(), []string{"hola", "adios"}, "es", "fr")
+	assertTranslations(t, got, err, "HOLA", "ADIOS")
+
+	req := requests()[0]
+	if req.Path != "/v3/projects/proj/locations/global:translateText" {
+		t.Errorf("path = %s", req.Path)
+	}
+	if auth := req.Headers.Get("Authorization"); auth != "Bearer tok" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if req.Body["mimeType"] != "text/html" || req.Body["targetLanguageCode"] != "fr" || req.Body["sourceLanguageCode"] != "es" {
+		t.Errorf("body = %v", req.Body)
+	}
+
+	t.Setenv("GOOGLE_ACCESS_TOKEN", "")
+	if _, err := newTranslator(mtGoogle); err == nil {
+		t.Error("a missing token should be an error")
+	}
+}
+
+func TestOpenAITranslator(t *testing.T) {
+	reply := ""
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": reply}}},
+		}
+	})
+	t.Setenv("OPENAI_API_URL", srv.URL+"/v1")
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_MODEL", "local-model")
+
+	tr, err := newTranslator(mtOpenAI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Models often wrap the array in a code fence
+	reply = "```json\n[\"Bonjour\", \"<b>Salut</b>\"]\n```"
+	got, err := tr.Translate(context.Background(), []string{"Hola", "<b>Adios</b>"}, "es", "fr")
+	assertTranslations(t, got, err, "Bonjour", "<b>Salut</b>")
+
+	req := requests()[0]
+	if req.Path != "/v1/chat/completions" {
+		t.Errorf("path = %s", req.Path)
+	}
+	if auth := req.Headers.Get("Authorization"); auth != "" {
+		t.Errorf("local server without key sent Authorization %q", auth)
+	}
+	if req.Body["model"] != "local-model" {
+		t.Errorf("model = %v", req.Body["model"])
+	}
+	messages, _ := req.Body["messages"].([]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("messages = %v", req.Body["messages"])
+	}
+	system, _ := messages[0].(map[string]interface{})["content"].(string)
+	user, _ := messages[1].(map[string]interface{})["content"].(string)
+	if !strings.Contains(system, `"es"`) || !strings.Contains(system, `"fr"`) || !strings.Contains(system, "exactly 2 elements") {
+		t.Errorf("system prompt = %q", system)
+	}
+	if user != `["Hola","<b>Adios</b>"]` {
+		t.Errorf("user message = %q", user)
+	}
+
+	reply = "Lo siento, no puedo"
+	if _, err := tr.Translate(context.Background(), []string{"Hola"}, "es", "fr"); err == nil || !strings.Contains(err.Error(), "array JSON") {
+		t.Errorf("non-JSON reply: err = %v", err)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	tr, _ = newTranslator(mtOpenAI)
+	reply = `["x"]`
+	tr.Translate(context.Background(), []string{"x"}, "", "fr")
+	if auth := requests()[2].Headers.Get("Authorization"); auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestLibreTranslator(t *testing.T) {
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		if q, ok := req.Body["q"].(string); ok {
+			return 200, map[string]string{"translatedText": strings.ToUpper(q)}
+		}
+		return 200, map[string]interface{}{"translatedText": upperAll(bodyStrings(t, req.Body, "q"))}
+	})
+	t.Setenv("LIBRETRANSLATE_URL", srv.URL)
+	t.Setenv("LIBRETRANSLATE_API_KEY", "lt-key")
+
+	tr, err := newTranslator(mtLibreTranslate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tr.Translate(context.Background(), []string{"hola", "adios"}, "", "en")
+	assertTranslations(t, got, err, "HOLA", "ADIOS")
+
+	req := requests()[0]
+	if req.Path != "/translate" {
+		t.Errorf("path = %s", req.Path)
+	}
+	if req.Body["source"] != "auto" || req.Body["target"] != "en" || req.Body["format"] != "html" || req.Body["api_key"] != "lt-key" {
+		t.Errorf("body = %v", req.Body)
+	}
+	if auth := req.Headers.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestLibreTranslatorSingleStringResponse(t *testing.T) {
+	srv, _ := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, map[string]string{"translatedText": "HOLA"}
+	})
+	t.Setenv("LIBRETRANSLATE_URL", srv.URL)
+	tr, err := newTranslator(mtLibreTranslate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tr.Translate(context.Background(), []string{"hola"}, "es", "en")
+	assertTranslations(t, got, err, "HOLA")
+}
+
+// configureAllBackends points every backend at srv
+func configureAllBackends(t *testing.T, srv *httptest.Server) {
+	t.Setenv("DEEPL_API_KEY", "k")
+	t.Setenv("DEEPL_API_URL", srv.URL)
+	t.Setenv("GOOGLE_TRANSLATE_URL", srv.URL)
+	t.Setenv("GOOGLE_PROJECT_ID", "p")
+	t.Setenv("GOOGLE_ACCESS_TOKEN", "t")
+	t.Setenv("OPENAI_API_URL", srv.URL)
+	t.Setenv("OPENAI_MODEL", "m")
+	t.Setenv("LIBRETRANSLATE_URL", srv.URL)
+}
+
+func TestTranslatorHTTPErrors(t *testing.T) {
+	status := 0
+	srv, _ := mockMT(t, func(req mtRequest) (int, interface{}) {
+		if status == 200 {
+			return 200, "not json"
+		}
+		return status, `{"message": "quota exceeded"}`
+	})
+	configureAllBackends(t, srv)
+
+	for _, provider := range []string{mtDeepL, mtGoogle, mtOpenAI, mtLibreTranslate} {
+		tr, err := newTranslator(provider)
+		if err != nil {
+			t.Fatalf("%s: %v", provider, err)
+		}
+		for _, code := range []int{403, 429, 500} {
+			status = code
+			_, err := tr.Translate(context.Background(), []string{"hola"}, "es", "en")
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("HTTP %d", code)) || !strings.Contains(err.Error(), "quota exceeded") {
+				t.Errorf("%s HTTP %d: err = %v", provider, code, err)
+			}
+		}
+		status = 200
+		if _, err := tr.Translate(context.Background(), []string{"hola"}, "es", "en"); err == nil || !strings.Contains(err.Error(), "respuesta no valida") {
+			t.Errorf("%s invalid JSON: err = %v", provider, err)
+		}
+	}
+}
+
+func TestTranslatorCancelledContext(t *testing.T) {
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, deeplResponse(bodyStrings(t, req.Body, "text"))
+	})
+	configureAllBackends(t, srv)
+	tr, _ := newTranslator(mtDeepL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := translateInBatches(ctx, tr, []string{"a", "b"}, "es", "en"); err == nil {
+		t.Error("a cancelled context should be an error")
+	}
+	if n := len(requests()); n != 0 {
+		t.Errorf("%d requests sent after cancellation", n)
+	}
+}
+
+func TestTranslateInBatches(t *testing.T) {
+	srv, requests := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, deeplResponse(bodyStrings(t, req.Body, "text"))
+	})
+	configureAllBackends(t, srv)
+	t.Setenv("MT_BATCH_SIZE", "2")
+	tr, _ := newTranslator(mtDeepL)
+
+	got, err := translateInBatches(context.Background(), tr, []string{"a", "b", "c", "d", "e"}, "es", "en")
+	assertTranslations(t, got, err, "A", "B", "C", "D", "E")
+
+	var sizes []int
+	for _, req := range requests() {
+		sizes = append(sizes, len(bodyStrings(t, req.Body, "text")))
+	}
+	if fmt.Sprint(sizes) != "[2 2 1]" {
+		t.Errorf("batch sizes = %v, want [2 2 1]", sizes)
+	}
+}
+
+func TestTranslateInBatchesCountMismatch(t *testing.T) {
+	srv, _ := mockMT(t, func(req mtRequest) (int, interface{}) {
+		return 200, deeplResponse([]string{"solo uno"})
+	})
+	configureAllBackends(t, srv)
+	tr, _ := newTranslator(mtDeepL)
+
+	_, err := translateInBatches(context.Background(), tr, []string{"a", "b"}, "es", "en")
+	if err == nil || !strings.Contains(err.Error(), "devolvio 1 traducciones para 2 segmentos") {
+		t.Errorf("err = %v", err)
+	}
+}
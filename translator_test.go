@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upperTranslator is a Translator that upper-cases every text
+type upperTranslator struct{}
+
+func (upperTranslator) Name() string { return "upper" }
+
+func (upperTranslator) Translate(_ context.Context, texts []string, _, _ string) ([]string, error) {
+	out := make([]string, len(texts))
+	for i, t := range texts {
+		out[i] = strings.ToUpper(t)
+	}
+	return out, nil
+}
+
+func TestMachineTranslateSessionReportsSaveFailure(t *testing.T) {
+	t.Setenv("SESSION_STATE_DIR", t.TempDir())
+	t.Setenv("TM_ENABLED", "false")
+	s := &MCPServer{stderr: io.Discard}
+
+	output := filepath.Join(t.TempDir(), "missing", "out.txt")
+	session := newTestFileSession(t, s, `[et_pb_section][et_pb_text]<p>Hola mundo</p>[/et_pb_text][/et_pb_section]`, output)
+
+	session.mu.Lock()
+	result, isError := s.machineTranslateSession(context.Background(), upperTranslator{}, session, false)
+	session.mu.Unlock()
+	if !isError {
+		t.Fatalf("failed save reported as success:\n%s", result)
+	}
+	if !strings.Contains(result, "NO GUARDADA") || !strings.Contains(result, "ERROR guardando archivo") {
+		t.Errorf("unexpected result:\n%s", result)
+	}
+	if session.CurrentPart != session.Parts-1 {
+		t.Errorf("CurrentPart = %d, want %d", session.CurrentPart, session.Parts-1)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ValidationIssue is one problem found comparing a source chunk (or document)
+// with its translation. Chunk is 1-based; 0 means a document-level issue.
+type ValidationIssue struct {
+	Chunk   int
+	Check   string // "html", "shortcode", "url", "placeholder", "number", "skeleton"
+	Fatal   bool
+	Message string
+}
+
+// ValidationReport groups the issues of one validation run.
+type ValidationReport struct {
+	Issues []ValidationIssue
+}
+
+func (r *ValidationReport) add(chunk int, check string, fatal bool, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ValidationIssue{Chunk: chunk, Check: check, Fatal: fatal, Message: fmt.Sprintf(format, args...)})
+}
+
+// HasFatal reports whether any issue must block the save.
+func (r *ValidationReport) HasFatal() bool {
+	for _, issue := range r.Issues {
+		if issue.Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts returns the number of fatal issues and warnings.
+func (r *ValidationReport) Counts() (fatal, warnings int) {
+	for _, issue := range r.Issues {
+		if issue.Fatal {
+			fatal++
+		} else {
+			warnings++
+		}
+	}
+	return fatal, warnings
+}
+
+// String lists the issues one per line.
+func (r *ValidationReport) String() string {
+	var b strings.Builder
+	for _, issue := range r.Issues {
+		level := "AVISO"
+		if issue.Fatal {
+			level = "FATAL"
+		}
+		where := "DOCUMENTO"
+		if issue.Chunk > 0 {
+			where = fmt.Sprintf("CHUNK_%03d", issue.Chunk)
+		}
+		b.WriteString(fmt.Sprintf("- [%s] %s %s: %s\n", level, where, issue.Check, issue.Message))
+	}
+	return b.String()
+}
+
+var (
+	htmlTagPattern     = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)\b[^>]*?(/?)>`)
+	innerShortcodeExpr = regexp.MustCompile(`\[(/?)([a-zA-Z_][\w-]*)[^\]]*\]`)
+	urlPattern         = regexp.MustCompile(`(?i)(?:https?://|mailto:|tel:)[^\s"'<>\]\)]+`)
+	placeholderPattern = regexp.MustCompile(`\{\{[^{}]+\}\}|\{[a-zA-Z_][a-zA-Z0-9_]*\}`)
+	printfVerbPattern  = regexp.MustCompile(`%\d*\$?[sdf]`)
+	numberPattern      = regexp.MustCompile(`\d+(?:[.,\x{00a0} ]\d{3})*(?:[.,]\d+)?`)
+)
+
+// HTML void elements never have a closing tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// Block-level tags whose count must not change: losing one breaks the layout
+var structuralTags = map[string]bool{
+	"div": true, "section": true, "p": true, "ul": true, "ol": true, "li": true, "table": true,
+	"thead": true, "tbody": true, "tr": true, "td": true, "th": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "iframe": true, "script": true, "style": true,
+	"form": true, "blockquote": true,
+}
+
+// htmlTagSequence returns the tags of s in order ("div", "/div", ...).
+func htmlTagSequence(s string) []string {
+	var seq []string
+	for _, m := range htmlTagPattern.FindAllStringSubmatch(s, -1) {
+		name := strings.ToLower(m[2])
+		if m[1] == "/" {
+			seq = append(seq, "/"+name)
+		} else if m[3] == "/" || voidElements[name] {
+			continue
+		} else {
+			seq = append(seq, name)
+		}
+	}
+	return seq
+}
+
+// htmlTagBalance returns opened-minus-closed per tag name.
+func htmlTagBalance(seq []string) map[string]int {
+	balance := make(map[string]int)
+	for _, t := range seq {
+		if strings.HasPrefix(t, "/") {
+			balance[t[1:]]--
+		} else {
+			balance[t]++
+		}
+	}
+	return balance
+}
+
+func countStrings(items []string) map[string]int {
+	counts := make(map[string]int)
+	for _, it := range items {
+		counts[it]++
+	}
+	return counts
+}
+
+// missingFrom returns the items present in want more times than in got.
+func missingFrom(want, got map[string]int) []string {
+	var missing []string
+	for k, n := range want {
+		if got[k] < n {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func normalizeNumber(n string) string {
+	return strings.NewReplacer(".", "", ",", "", " ", "", " ", "").Replace(n)
+}
+
+// findPlaceholders returns the {{name}} and {name} markers and the printf
+// verbs (%s, %1$d) of s. A verb only counts in a printf context, not glued
+// to a number before or to a word after: "10%de descuento" and "100%s" are text.
+func findPlaceholders(s string) []string {
+	found := placeholderPattern.FindAllString(s, -1)
+	for _, loc := range printfVerbPattern.FindAllStringIndex(s, -1) {
+		before, _ := utf8.DecodeLastRuneInString(s[:loc[0]])
+		after, _ := utf8.DecodeRuneInString(s[loc[1]:])
+		if unicode.IsDigit(before) || unicode.IsLetter(after) || unicode.IsDigit(after) {
+			continue
+		}
+		found = append(found, s[loc[0]:loc[1]])
+	}
+	return found
+}
+
+// validateChunk compares one source chunk with its translation.
+func validateChunk(report *ValidationReport, chunk int, source, translated string) {
+	if strings.TrimSpace(translated) == "" {
+		report.add(chunk, "vacio", true, "la traduccion esta vacia")
+		return
+	}
+
+	// HTML tag balance and sequence
+	srcSeq, dstSeq := htmlTagSequence(source), htmlTagSequence(translated)
+	srcBalance, dstBalance := htmlTagBalance(srcSeq), htmlTagBalance(dstSeq)
+	for tag, n := range dstBalance {
+		if n != srcBalance[tag] {
+			report.add(chunk, "html", true, "etiqueta <%s> desbalanceada (origen %+d, traduccion %+d)", tag, srcBalance[tag], n)
+		}
+	}
+	for tag, n := range srcBalance {
+		if _, ok := dstBalance[tag]; !ok && n != 0 {
+			report.add(chunk, "html", true, "etiqueta <%s> desbalanceada (origen %+d, traduccion 0)", tag, n)
+		}
+	}
+	srcCounts, dstCounts := countStrings(srcSeq), countStrings(dstSeq)
+	for _, tag := range missingFrom(srcCounts, dstCounts) {
+		report.add(chunk, "html", structuralTags[tag], "falta <%s> (origen %d, traduccion %d)", tag, srcCounts[tag], dstCounts[tag])
+	}
+	for _, tag := range missingFrom(dstCounts, srcCounts) {
+		report.add(chunk, "html", structuralTags[tag], "etiqueta <%s> anadida (origen %d, traduccion %d)", tag, srcCounts[tag], dstCounts[tag])
+	}
+	if len(srcSeq) == len(dstSeq) && strings.Join(srcSeq, ",") != strings.Join(dstSeq, ",") {
+		report.add(chunk, "html", false, "el orden de las etiquetas HTML ha cambiado")
+	}
+
+	// Inner shortcodes ([caption], [embed], ...) and injected Divi shortcodes
+	shortcodeNames := func(s string) []string {
+		var names []string
+		for _, m := range innerShortcodeExpr.FindAllStringSubmatch(s, -1) {
+			names = append(names, m[1]+m[2])
+		}
+		return names
+	}
+	srcSC, dstSC := countStrings(shortcodeNames(source)), countStrings(shortcodeNames(translated))
+	for _, name := range missingFrom(srcSC, dstSC) {
+		report.add(chunk, "shortcode", true, "falta el shortcode [%s]", name)
+	}
+	for _, name := range missingFrom(dstSC, srcSC) {
+		report.add(chunk, "shortcode", true, "shortcode [%s] anadido", name)
+	}
+	if strings.Contains(translated, "[et_") && !strings.Contains(source, "[et_") {
+		report.add(chunk, "shortcode", true, "la traduccion contiene un shortcode Divi [et_ inyectado")
+	}
+
+	// URLs must survive untouched
+	dstURLs := countStrings(urlPattern.FindAllString(translated, -1))
+	for _, u := range missingFrom(countStrings(urlPattern.FindAllString(source, -1)), dstURLs) {
+		report.add(chunk, "url", false, "URL modificada o eliminada: %s", truncateForDisplay(u, 80))
+	}
+
+	// Placeholders and leaked chunk markers
+	srcPH, dstPH := countStrings(findPlaceholders(source)), countStrings(findPlaceholders(translated))
+	for _, ph := range missingFrom(srcPH, dstPH) {
+		report.add(chunk, "placeholder", true, "falta el marcador %s", ph)
+	}
+	for _, ph := range missingFrom(dstPH, srcPH) {
+		report.add(chunk, "placeholder", true, "marcador %s anadido", ph)
+	}
+
+	// Numbers (separators may change between locales)
+	var srcNums, dstNums []string
+	for _, n := range numberPattern.FindAllString(source, -1) {
+		srcNums = append(srcNums, normalizeNumber(n))
+	}
+	for _, n := range numberPattern.FindAllString(translated, -1) {
+		dstNums = append(dstNums, normalizeNumber(n))
+	}
+	for _, n := range missingFrom(countStrings(srcNums), countStrings(dstNums)) {
+		report.add(chunk, "number", false, "el numero %s no aparece en la traduccion", n)
+	}
+}
+
+// validateSessionPart validates the chunks of the session's current part.
+func validateSessionPart(session *BulkTranslationSession) *ValidationReport {
+	report := &ValidationReport{}
+	partRange := session.PartRanges[session.CurrentPart]
+	for i := partRange[0]; i < partRange[1]; i++ {
+		if session.isPrefilled(i) {
+			continue
+		}
+		source := tokenText(session.Tokens[session.ChunkIndices[i]])
+		validateChunk(report, i+1, source, session.Translations[i])
+	}
+	return report
+}
+
+// shortcodeSkeleton lists the shortcode structure of a document ignoring
+// attributes and text: one entry per node, prefixed with ">" per depth level.
+func shortcodeSkeleton(doc *ShortcodeDocument) []string {
+	var skeleton []string
+	var walk func(n *ShortcodeNode, depth int)
+	walk = func(n *ShortcodeNode, depth int) {
+		switch n.Kind {
+		case "shortcode":
+			entry := strings.Repeat(">", depth) + n.Name
+			if n.CloseStart < 0 {
+				entry += " (sin cierre)"
+			}
+			skeleton = append(skeleton, entry)
+		case "stray":
+			skeleton = append(skeleton, fmt.Sprintf("%s/%s", strings.Repeat(">", depth), n.Name))
+		}
+		for _, child := range n.Children {
+			walk(child, depth+1)
+		}
+	}
+	walk(doc.Root, 0)
+	return skeleton
+}
+
+// validateDocumentSkeleton compares the shortcode skeleton of the rebuilt
+// document with the original one.
+func validateDocumentSkeleton(original, rebuilt string) *ValidationReport {
+	report := &ValidationReport{}
+	srcDoc, dstDoc := parseShortcodeDocument(original), parseShortcodeDocument(rebuilt)
+	src, dst := shortcodeSkeleton(srcDoc), shortcodeSkeleton(dstDoc)
+
+	if len(dstDoc.Errors) > len(srcDoc.Errors) {
+		report.add(0, "skeleton", true, "el documento traducido tiene %d shortcodes desbalanceados (original: %d)", len(dstDoc.Errors), len(srcDoc.Errors))
+	}
+	for i := 0; i < len(src) || i < len(dst); i++ {
+		var a, b string
+		if i < len(src) {
+			a = src[i]
+		}
+		if i < len(dst) {
+			b = dst[i]
+		}
+		if a != b {
+			report.add(0, "skeleton", true, "estructura de shortcodes distinta en el nodo %d: original %q, traducido %q (total %d vs %d)", i+1, a, b, len(src), len(dst))
+			break
+		}
+	}
+	return report
+}
+
+// formatValidationFailure builds the response returned when a save is refused.
+func formatValidationFailure(session *BulkTranslationSession, report *ValidationReport, part int) string {
+	fatal, warnings := report.Counts()
+	return fmt.Sprintf(`VALIDACION FALLIDA - NO SE HA GUARDADO
+======================================
+extractionId: %s
+Parte: %d de %d
+Errores fatales: %d
+Advertencias: %d
+
+%s
+Corrige los bloques indicados y vuelve a enviar la parte %d con submit_bulk_translation,
+o repite la llamada con force=true para guardar igualmente.`,
+		session.ExtractionID, part, session.Parts, fatal, warnings, report.String(), part)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// issueKinds summarizes a report as sorted "check!" (fatal) and "check?" entries
+func issueKinds(report *ValidationReport) []string {
+	var kinds []string
+	for _, issue := range report.Issues {
+		kind := issue.Check + "?"
+		if issue.Fatal {
+			kind = issue.Check + "!"
+		}
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func TestFindPlaceholders(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hola {{nombre}}, tienes {count} mensajes", []string{"{{nombre}}", "{count}"}},
+		{"Hola %s, tienes %d mensajes", []string{"%s", "%d"}},
+		{"%1$s de %2$s", []string{"%1$s", "%2$s"}},
+		{"Total: %.2f", nil},
+		{"(%s)", []string{"%s"}},
+		{"%s%s", []string{"%s", "%s"}},
+		{"Hasta un 10%de descuento", nil},
+		{"Algodon 100%s", nil},
+		{"Un 100%seguro", nil},
+		{"Descuento del 20% en %s", []string{"%s"}},
+		{"Texto %sin marcador", nil},
+		{"Precio %d€", []string{"%d"}},
+		{"Sin marcadores {} ni { espacio }", nil},
+	}
+	for _, tt := range tests {
+		got := findPlaceholders(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findPlaceholders(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestValidateChunk(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		translated string
+		want       []string
+	}{
+		{"clean", "<p>Hola <strong>mundo</strong></p>", "<p>Hello <strong>world</strong></p>", nil},
+		{"empty", "<p>Hola</p>", "  \n", []string{"vacio!"}},
+		{"unbalanced inline tag", "<strong>Hola</strong> mundo", "<strong>Hello world", []string{"html!", "html?"}},
+		{"lost paragraph", "<p>Hola</p><p>Adios</p>", "<p>Hello bye</p>", []string{"html!", "html?"}},
+		{"added structural tag", "Hola", "<div>Hello</div>", []string{"html!", "html?"}},
+		{"tag order changed", "<strong>a</strong> <em>b</em>", "<em>b</em> <strong>a</strong>", []string{"html?"}},
+		{"inner shortcode lost", "[caption align=\"left\"]Foto[/caption] texto", "Photo text", []string{"shortcode!", "shortcode!"}},
+		{"divi shortcode injected", "Hola", "Hello [et_pb_text]", []string{"shortcode!", "shortcode!"}},
+		{"url changed", `<a href="https://ejemplo.com/es/">Ver</a>`, `<a href="https://example.com/en/">See</a>`, []string{"url?"}},
+		{"url kept", `Visita https://ejemplo.com/`, `Visit https://ejemplo.com/`, nil},
+		{"mustache placeholder lost", "Hola {{nombre}}", "Hello", []string{"placeholder!"}},
+		{"brace placeholder renamed", "{count} articulos", "{total} items", []string{"placeholder!", "placeholder!"}},
+		{"printf verbs kept", "Hola %s, tienes %d mensajes", "Hello %s, you have %d messages", nil},
+		{"verb lost", "%s de %s", "%s", []string{"placeholder!"}},
+		{"percent before a word", "Hasta un 10%de descuento", "Up to 10% off", nil},
+		{"percent glued to s", "Algodon 100%s", "100% cotton", nil},
+		{"chunk marker leaked", "Hola", "{{CHUNK_002}}Hello", []string{"placeholder!"}},
+		{"number with locale separators", "Cuesta 1.000,50 euros", "Costs 1,000.50 euros", nil},
+		{"number changed", "Cuesta 25 euros", "Costs 52 euros", []string{"number?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &ValidationReport{}
+			validateChunk(report, 3, tt.source, tt.translated)
+			if got := issueKinds(report); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issues = %q, want %q\n%s", got, tt.want, report.String())
+			}
+			for _, issue := range report.Issues {
+				if issue.Chunk != 3 {
+					t.Errorf("issue on chunk %d, want 3: %+v", issue.Chunk, issue)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDocumentSkeleton(t *testing.T) {
+	const original = `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hola</p>[/et_pb_text][et_pb_button button_text="Ir"][/et_pb_column][/et_pb_row][/et_pb_section]`
+	tests := []struct {
+		name    string
+		rebuilt string
+		want    []string
+		message string
+	}{
+		{"same structure", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hello</p>[/et_pb_text][et_pb_button button_text="Go"][/et_pb_column][/et_pb_row][/et_pb_section]`, nil, ""},
+		{"module lost", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_button button_text="Go"][/et_pb_column][/et_pb_row][/et_pb_section]`, []string{"skeleton!"}, "nodo 4"},
+		{"module added", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hello</p>[/et_pb_text][et_pb_button button_text="Go"][et_pb_divider /][/et_pb_column][/et_pb_row][/et_pb_section]`, []string{"skeleton!"}, "total 5 vs 6"},
+		{"closer lost", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hello</p>[et_pb_button button_text="Go"][/et_pb_column][/et_pb_row][/et_pb_section]`, []string{"skeleton!"}, "sin cierre"},
+		{"stray closer", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hello</p>[/et_pb_text][/et_pb_text][et_pb_button button_text="Go"][/et_pb_column][/et_pb_row][/et_pb_section]`, []string{"skeleton!", "skeleton!"}, "desbalanceados"},
+		{"nesting changed", `[et_pb_section][et_pb_row][et_pb_column type="4_4"][et_pb_text]<p>Hello</p>[/et_pb_text][/et_pb_column][et_pb_button button_text="Go"][/et_pb_row][/et_pb_section]`, []string{"skeleton!"}, "nodo 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := validateDocumentSkeleton(original, tt.rebuilt)
+			if got := issueKinds(report); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("issues = %q, want %q\n%s", got, tt.want, report.String())
+			}
+			if tt.message != "" && !strings.Contains(report.String(), tt.message) {
+				t.Errorf("report does not mention %q:\n%s", tt.message, report.String())
+			}
+			for _, issue := range report.Issues {
+				if issue.Chunk != 0 {
+					t.Errorf("document issue on chunk %d: %+v", issue.Chunk, issue)
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -16,17 +17,36 @@ type WordPressDB struct {
 	db          *sql.DB
 	tablePrefix string
 	backupDir   string
+
+	multilingual     string // Detected multilingual plugin (see Multilingual)
+	multilingualOnce sync.Once
+
+	saveHooks []namedPostSaveHook // Run after a post is saved (see AddPostSaveHook)
+	seoFields []SEOMetaField      // Postmeta translated with the post (see AddSEOMetaField)
 }
 
 // WordPressPost represents a WordPress post
 type WordPressPost struct {
-	ID          int64
-	PostTitle   string
-	PostName    string // slug
-	PostExcerpt string
-	PostContent string
-	PostStatus  string
-	PostType    string
+	ID              int64     `json:"id"`
+	PostTitle       string    `json:"title"`
+	PostName        string    `json:"name"` // slug
+	PostExcerpt     string    `json:"excerpt"`
+	PostContent     string    `json:"content"`
+	PostStatus      string    `json:"status"`
+	PostType        string    `json:"type"`
+	PostAuthor      int64     `json:"author"`
+	PostParent      int64     `json:"parent"`
+	MenuOrder       int       `json:"menuOrder"`
+	PostDate        time.Time `json:"date"`
+	PostDateGMT     time.Time `json:"dateGmt"`
+	PostModified    time.Time `json:"modified"`
+	PostModifiedGMT time.Time `json:"modifiedGmt"`
+}
+
+// PostMeta is a wp_postmeta row
+type PostMeta struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 // NewWordPressDB creates a new WordPress database connection
@@ -69,11 +89,14 @@ func NewWordPressDB() (*WordPressDB, error) {
 		return nil, fmt.Errorf("error verificando conexión MySQL: %v", err)
 	}
 
-	return &WordPressDB{
+	wp := &WordPressDB{
 		db:          db,
 		tablePrefix: tablePrefix,
 		backupDir:   backupDir,
-	}, nil
+	}
+	wp.registerDefaultHooks()
+	wp.registerDefaultSEOFields()
+	return wp, nil
 }
 
 // Close closes the database connection
@@ -85,14 +108,22 @@ func (wp *WordPressDB) Close() {
 
 // GetPost retrieves a WordPress post by ID
 func (wp *WordPressDB) GetPost(postID int64) (*WordPressPost, error) {
+	return wp.queryPost(wp.db, postID, "")
+}
+
+// queryPost reads a post with q; suffix is appended to the query (e.g. a
+// locking clause inside a transaction)
+func (wp *WordPressDB) queryPost(q rowQuerier, postID int64, suffix string) (*WordPressPost, error) {
 	query := fmt.Sprintf(`
-		SELECT ID, post_title, post_name, post_excerpt, post_content, post_status, post_type
+		SELECT ID, post_title, post_name, post_excerpt, post_content, post_status, post_type,
+		       post_author, post_parent, menu_order,
+		       post_date, post_date_gmt, post_modified, post_modified_gmt
 		FROM %sposts
-		WHERE ID = ?`,
-		wp.tablePrefix)
+		WHERE ID = ?%s`,
+		wp.tablePrefix, suffix)
 
 	post := &WordPressPost{}
-	err := wp.db.QueryRow(query, postID).Scan(
+	err := q.QueryRow(query, postID).Scan(
 		&post.ID,
 		&post.PostTitle,
 		&post.PostName,
@@ -100,6 +131,13 @@ func (wp *WordPressDB) GetPost(postID int64) (*WordPressPost, error) {
 		&post.PostContent,
 		&post.PostStatus,
 		&post.PostType,
+		&post.PostAuthor,
+		&post.PostParent,
+		&post.MenuOrder,
+		&post.PostDate,
+		&post.PostDateGMT,
+		&post.PostModified,
+		&post.PostModifiedGMT,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -111,29 +149,182 @@ func (wp *WordPressDB) GetPost(postID int64) (*WordPressPost, error) {
 	return post, nil
 }
 
-// UpdatePostContent updates the post_content of a WordPress post
-func (wp *WordPressDB) UpdatePostContent(postID int64, newContent string) error {
+// PostQuery selects posts for batch operations. Empty fields are not filtered.
+type PostQuery struct {
+	PostType      string // Comma-separated list. Default: post and page
+	Status        string // Default: publish
+	Category      string // Category slug or term ID
+	DateFrom      string // post_date >= (YYYY-MM-DD)
+	DateTo        string // post_date <= (YYYY-MM-DD, inclusive)
+	ModifiedSince string // post_modified_gmt >= (YYYY-MM-DD [HH:MM:SS])
+	Limit         int
+}
+
+// FindPosts returns the posts matching the query (without content), ordered by ID
+func (wp *WordPressDB) FindPosts(q PostQuery) ([]WordPressPost, error) {
+	var where []string
+	var args []interface{}
+
+	if q.PostType != "" {
+		types := strings.Split(q.PostType, ",")
+		placeholders := make([]string, len(types))
+		for i, t := range types {
+			placeholders[i] = "?"
+			args = append(args, strings.TrimSpace(t))
+		}
+		where = append(where, fmt.Sprintf("p.post_type IN (%s)", strings.Join(placeholders, ", ")))
+	} else {
+		where = append(where, "p.post_type IN ('post', 'page')")
+	}
+
+	status := q.Status
+	if status == "" {
+		status = "publish"
+	}
+	if status != "any" {
+		where = append(where, "p.post_status = ?")
+		args = append(args, status)
+	}
+
+	if q.DateFrom != "" {
+		where = append(where, "p.post_date >= ?")
+		args = append(args, q.DateFrom)
+	}
+	if q.DateTo != "" {
+		where = append(where, "p.post_date < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, q.DateTo)
+	}
+	if q.ModifiedSince != "" {
+		where = append(where, "p.post_modified_gmt >= ?")
+		args = append(args, q.ModifiedSince)
+	}
+	if q.Category != "" {
+		where = append(where, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM %[1]sterm_relationships tr
+			JOIN %[1]sterm_taxonomy tt ON tt.term_taxonomy_id = tr.term_taxonomy_id
+			JOIN %[1]sterms t ON t.term_id = tt.term_id
+			WHERE tr.object_id = p.ID AND tt.taxonomy = 'category' AND (t.slug = ? OR t.term_id = ?))`,
+			wp.tablePrefix))
+		args = append(args, q.Category, q.Category)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT p.ID, p.post_title, p.post_name, p.post_status, p.post_type
+		FROM %sposts p
+		WHERE %s
+		ORDER BY p.ID`,
+		wp.tablePrefix, strings.Join(where, " AND "))
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := wp.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error buscando posts: %v", err)
+	}
+	defer rows.Close()
+
+	var posts []WordPressPost
+	for rows.Next() {
+		var post WordPressPost
+		if err := rows.Scan(&post.ID, &post.PostTitle, &post.PostName, &post.PostStatus, &post.PostType); err != nil {
+			return nil, fmt.Errorf("error leyendo posts: %v", err)
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// GetPostMeta returns every wp_postmeta row of a post, in insertion order
+func (wp *WordPressDB) GetPostMeta(postID int64) ([]PostMeta, error) {
+	query := fmt.Sprintf(`
+		SELECT meta_key, meta_value FROM %spostmeta
+		WHERE post_id = ?
+		ORDER BY meta_id`,
+		wp.tablePrefix)
+
+	rows, err := wp.db.Query(query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo postmeta: %v", err)
+	}
+	defer rows.Close()
+
+	var meta []PostMeta
+	for rows.Next() {
+		var key, value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("error leyendo postmeta: %v", err)
+		}
+		meta = append(meta, PostMeta{Key: key.String, Value: value.String})
+	}
+	return meta, rows.Err()
+}
+
+// UpdatePostContent updates the post_content of a WordPress post. The previous
+// state is kept as a WordPress revision; its ID is returned (0 if disabled).
+func (wp *WordPressDB) UpdatePostContent(postID int64, newContent string) (int64, error) {
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	revisionID, err := wp.insertRevision(tx, postID)
+	if err != nil {
+		return 0, err
+	}
+
 	query := fmt.Sprintf(`
 		UPDATE %sposts
 		SET post_content = ?, post_modified = NOW(), post_modified_gmt = UTC_TIMESTAMP()
 		WHERE ID = ?`,
 		wp.tablePrefix)
 
-	result, err := wp.db.Exec(query, newContent, postID)
+	result, err := tx.Exec(query, newContent, postID)
 	if err != nil {
-		return fmt.Errorf("error actualizando post: %v", err)
+		return 0, fmt.Errorf("error actualizando post: %v", err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("post ID %d no encontrado para actualizar", postID)
+		return 0, fmt.Errorf("post ID %d no encontrado para actualizar", postID)
 	}
 
-	return nil
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return revisionID, nil
+}
+
+// UpdatePostFull updates post_content, post_title, post_name (slug),
+// post_excerpt and the given postmeta. The previous state is kept as a
+// WordPress revision; its ID is returned (0 if disabled).
+func (wp *WordPressDB) UpdatePostFull(postID int64, title, slug, excerpt, content string, meta map[string]string) (int64, error) {
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	revisionID, err := wp.insertRevision(tx, postID)
+	if err != nil {
+		return 0, err
+	}
+	if err := wp.updatePostFields(tx, postID, title, slug, excerpt, content); err != nil {
+		return 0, err
+	}
+	if err := wp.updatePostMetaValues(tx, postID, meta); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return revisionID, nil
 }
 
-// UpdatePostFull updates post_content, post_title, post_name (slug), and post_excerpt
-func (wp *WordPressDB) UpdatePostFull(postID int64, title, slug, excerpt, content string) error {
+// updatePostFields writes title, slug, excerpt and content inside tx
+func (wp *WordPressDB) updatePostFields(tx *sql.Tx, postID int64, title, slug, excerpt, content string) error {
 	query := fmt.Sprintf(`
 		UPDATE %sposts
 		SET post_title = ?, post_name = ?, post_excerpt = ?, post_content = ?,
@@ -141,7 +332,7 @@ func (wp *WordPressDB) UpdatePostFull(postID int64, title, slug, excerpt, conten
 		WHERE ID = ?`,
 		wp.tablePrefix)
 
-	result, err := wp.db.Exec(query, title, slug, excerpt, content, postID)
+	result, err := tx.Exec(query, title, slug, excerpt, content, postID)
 	if err != nil {
 		return fmt.Errorf("error actualizando post: %v", err)
 	}
@@ -150,10 +341,239 @@ func (wp *WordPressDB) UpdatePostFull(postID int64, title, slug, excerpt, conten
 	if rows == 0 {
 		return fmt.Errorf("post ID %d no encontrado para actualizar", postID)
 	}
+	return nil
+}
+
+// revisionsEnabled reads WP_REVISIONS (default true), the counterpart of the
+// WP_POST_REVISIONS constant of wp-config.php
+func revisionsEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("WP_REVISIONS"))) {
+	case "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// insertRevision copies the current row of a post into a new revision, like
+// wp_save_post_revision: post_type 'revision', status 'inherit', parent the
+// post, name "<id>-revision-v1", and author and dates of the saved state. It
+// runs inside the transaction of the update so both are written or neither.
+func (wp *WordPressDB) insertRevision(tx *sql.Tx, postID int64) (int64, error) {
+	if !revisionsEnabled() {
+		return 0, nil
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]sposts (
+			post_author, post_date, post_date_gmt, post_content, post_title, post_excerpt,
+			post_status, comment_status, ping_status, post_password, post_name,
+			to_ping, pinged, post_modified, post_modified_gmt, post_content_filtered,
+			post_parent, guid, menu_order, post_type, post_mime_type, comment_count)
+		SELECT
+			post_author, post_modified, post_modified_gmt, post_content, post_title, post_excerpt,
+			'inherit', 'closed', 'closed', '', CONCAT(ID, '-revision-v1'),
+			'', '', post_modified, post_modified_gmt, '',
+			ID, '', 0, 'revision', '', 0
+		FROM %[1]sposts WHERE ID = ? AND post_type != 'revision'`,
+		wp.tablePrefix)
+	result, err := tx.Exec(query, postID)
+	if err != nil {
+		return 0, fmt.Errorf("error creando revision: %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, fmt.Errorf("post ID %d no encontrado para actualizar", postID)
+	}
+	revisionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo ID de la revision: %v", err)
+	}
+
+	if err := wp.setGUID(tx, revisionID); err != nil {
+		return 0, err
+	}
+	return revisionID, nil
+}
 
+// setGUID gives a new post the guid WordPress uses for drafts; WordPress only
+// needs it to be unique
+func (wp *WordPressDB) setGUID(tx *sql.Tx, postID int64) error {
+	var home string
+	query := fmt.Sprintf(`SELECT option_value FROM %soptions WHERE option_name = 'home'`, wp.tablePrefix)
+	if err := tx.QueryRow(query).Scan(&home); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error leyendo opcion home: %v", err)
+	}
+	query = fmt.Sprintf(`UPDATE %sposts SET guid = ? WHERE ID = ?`, wp.tablePrefix)
+	if _, err := tx.Exec(query, fmt.Sprintf("%s/?p=%d", strings.TrimRight(home, "/"), postID), postID); err != nil {
+		return fmt.Errorf("error actualizando guid: %v", err)
+	}
 	return nil
 }
 
+// PostVersion identifies the state of a post when it was read for translation
+type PostVersion struct {
+	ModifiedGMT   time.Time
+	ContentSHA256 string
+}
+
+// VersionOf returns the version of a post as read from the database
+func VersionOf(post *WordPressPost) PostVersion {
+	return PostVersion{ModifiedGMT: post.PostModifiedGMT, ContentSHA256: contentChecksum(post.PostContent)}
+}
+
+// PostConflictError is returned by UpdatePostFullIfUnchanged when the post was
+// modified after it was read. Current is the post as it is now.
+type PostConflictError struct {
+	Current *WordPressPost
+}
+
+func (e *PostConflictError) Error() string {
+	return fmt.Sprintf("el post %d ha cambiado desde la extraccion (modificado %s GMT)",
+		e.Current.ID, e.Current.PostModifiedGMT.Format("2006-01-02 15:04:05"))
+}
+
+// UpdatePostFullIfUnchanged is UpdatePostFull with a compare-and-swap: the row
+// is locked and only updated if its post_modified_gmt and content checksum
+// still match expected. Otherwise it returns a *PostConflictError.
+func (wp *WordPressDB) UpdatePostFullIfUnchanged(postID int64, expected PostVersion, title, slug, excerpt, content string, meta map[string]string) (int64, error) {
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	current, err := wp.queryPost(tx, postID, " FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+	if !current.PostModifiedGMT.Equal(expected.ModifiedGMT) || contentChecksum(current.PostContent) != expected.ContentSHA256 {
+		return 0, &PostConflictError{Current: current}
+	}
+
+	revisionID, err := wp.insertRevision(tx, postID)
+	if err != nil {
+		return 0, err
+	}
+	if err := wp.updatePostFields(tx, postID, title, slug, excerpt, content); err != nil {
+		return 0, err
+	}
+	if err := wp.updatePostMetaValues(tx, postID, meta); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return revisionID, nil
+}
+
+// copyExcludedMeta lists postmeta keys that describe the editing state of the
+// source post and must not be cloned into a translated copy
+var copyExcludedMeta = []string{"_edit_lock", "_edit_last", "_wp_old_slug", "_wp_old_date"}
+
+// CreateTranslatedCopy inserts a new post cloned from sourceID (type, parent,
+// menu order, author, comment settings and all postmeta, Divi builder and CSS
+// cache keys included) with the given title, slug, excerpt and content; meta
+// overrides the copied postmeta.
+// The copy is created with the given status ("draft" if empty) and a slug made
+// unique among posts of the same type and parent. Returns the new post ID.
+func (wp *WordPressDB) CreateTranslatedCopy(sourceID int64, title, slug, excerpt, content, status string, meta map[string]string) (int64, error) {
+	if status == "" {
+		status = "draft"
+	}
+
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	var postType string
+	var postParent int64
+	query := fmt.Sprintf(`SELECT post_type, post_parent FROM %sposts WHERE ID = ?`, wp.tablePrefix)
+	if err := tx.QueryRow(query, sourceID).Scan(&postType, &postParent); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("post ID %d no encontrado", sourceID)
+		}
+		return 0, fmt.Errorf("error leyendo post: %v", err)
+	}
+
+	if slug != "" {
+		slug, err = wp.uniqueSlug(tx, slug, postType, postParent)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	query = fmt.Sprintf(`
+		INSERT INTO %[1]sposts (
+			post_author, post_date, post_date_gmt, post_content, post_title, post_excerpt,
+			post_status, comment_status, ping_status, post_password, post_name,
+			to_ping, pinged, post_modified, post_modified_gmt, post_content_filtered,
+			post_parent, guid, menu_order, post_type, post_mime_type, comment_count)
+		SELECT
+			post_author, NOW(), UTC_TIMESTAMP(), ?, ?, ?,
+			?, comment_status, ping_status, post_password, ?,
+			'', '', NOW(), UTC_TIMESTAMP(), '',
+			post_parent, '', menu_order, post_type, post_mime_type, 0
+		FROM %[1]sposts WHERE ID = ?`,
+		wp.tablePrefix)
+	result, err := tx.Exec(query, content, title, excerpt, status, slug, sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("error creando post: %v", err)
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo ID del nuevo post: %v", err)
+	}
+
+	if err := wp.setGUID(tx, newID); err != nil {
+		return 0, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(copyExcludedMeta)), ", ")
+	query = fmt.Sprintf(`
+		INSERT INTO %[1]spostmeta (post_id, meta_key, meta_value)
+		SELECT ?, meta_key, meta_value FROM %[1]spostmeta
+		WHERE post_id = ? AND meta_key NOT IN (%[2]s)
+		ORDER BY meta_id`,
+		wp.tablePrefix, placeholders)
+	args := []interface{}{newID, sourceID}
+	for _, key := range copyExcludedMeta {
+		args = append(args, key)
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return 0, fmt.Errorf("error copiando postmeta: %v", err)
+	}
+	if err := wp.updatePostMetaValues(tx, newID, meta); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return newID, nil
+}
+
+// uniqueSlug appends -2, -3... to slug until no other post of the same type
+// and parent uses it, like wp_unique_post_slug
+func (wp *WordPressDB) uniqueSlug(tx *sql.Tx, slug, postType string, postParent int64) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM %sposts
+		WHERE post_name = ? AND post_type = ? AND post_parent = ? AND post_status != 'trash'`,
+		wp.tablePrefix)
+	candidate := slug
+	for suffix := 2; ; suffix++ {
+		var count int
+		if err := tx.QueryRow(query, candidate, postType, postParent).Scan(&count); err != nil {
+			return "", fmt.Errorf("error comprobando slug: %v", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, suffix)
+	}
+}
+
 // SaveBackup saves the original content to a backup file
 func (wp *WordPressDB) SaveBackup(postID int64, content string, lang string) (string, error) {
 	// Create backup directory if it doesn't exist
@@ -161,54 +581,78 @@ func (wp *WordPressDB) SaveBackup(postID int64, content string, lang string) (st
 		return "", fmt.Errorf("error creando directorio de backup: %v", err)
 	}
 
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("post_%d_backup_%s_%s.txt", postID, lang, timestamp)
-	backupPath := filepath.Join(wp.backupDir, filename)
-
-	if err := os.WriteFile(backupPath, []byte(content), 0644); err != nil {
+	timestamp := time.Now().Format(backupTimestampLayout)
+	base := fmt.Sprintf("post_%d_backup_%s_%s", postID, lang, timestamp)
+	backupPath, err := writeNewBackup(wp.backupDir, base, ".txt", []byte(content))
+	if err != nil {
 		return "", fmt.Errorf("error guardando backup: %v", err)
 	}
 
 	return backupPath, nil
 }
 
-// SaveFullBackup saves all translatable fields to a backup file
-func (wp *WordPressDB) SaveFullBackup(post *WordPressPost, lang string) (string, error) {
+// SaveFullBackup saves the post, with all its fields and postmeta, to a JSON
+// backup file (see BackupFile). sourceLang and extractionID may be empty; a
+// known source language is also written in the file name ("es_to_en").
+func (wp *WordPressDB) SaveFullBackup(post *WordPressPost, sourceLang, lang, extractionID string) (string, error) {
 	// Create backup directory if it doesn't exist
 	if err := os.MkdirAll(wp.backupDir, 0755); err != nil {
 		return "", fmt.Errorf("error creando directorio de backup: %v", err)
 	}
 
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("post_%d_full_backup_%s_%s.txt", post.ID, lang, timestamp)
-	backupPath := filepath.Join(wp.backupDir, filename)
-
-	// Create backup content with all fields
-	backupContent := fmt.Sprintf(`=== WORDPRESS POST BACKUP ===
-Post ID: %d
-Date: %s
-Target Language: %s
-
-=== POST_TITLE ===
-%s
-
-=== POST_NAME (SLUG) ===
-%s
-
-=== POST_EXCERPT ===
-%s
+	meta, err := wp.GetPostMeta(post.ID)
+	if err != nil {
+		return "", err
+	}
 
-=== POST_CONTENT ===
-%s
-`, post.ID, timestamp, lang, post.PostTitle, post.PostName, post.PostExcerpt, post.PostContent)
+	now := time.Now()
+	langTag := lang
+	if sourceLang != "" {
+		langTag = sourceLang + "_to_" + lang
+	}
+	base := fmt.Sprintf("post_%d_full_backup_%s_%s", post.ID, sanitizeFilename(langTag), now.Format(backupTimestampLayout))
 
-	if err := os.WriteFile(backupPath, []byte(backupContent), 0644); err != nil {
+	data, err := newBackupFile(post, meta, sourceLang, lang, extractionID, wp.tablePrefix, now).encode()
+	if err != nil {
+		return "", fmt.Errorf("error generando backup: %v", err)
+	}
+	backupPath, err := writeNewBackup(wp.backupDir, base, ".json", data)
+	if err != nil {
 		return "", fmt.Errorf("error guardando backup: %v", err)
 	}
 
 	return backupPath, nil
 }
 
+// writeNewBackup writes a backup file named base+ext in dir. Names have
+// one-second resolution, so a backup of the same post made in the same
+// second gets a _2, _3... suffix instead of overwriting the previous one.
+func writeNewBackup(dir, base, ext string, data []byte) (string, error) {
+	for seq := 1; ; seq++ {
+		name := base + ext
+		if seq > 1 {
+			name = fmt.Sprintf("%s_%d%s", base, seq, ext)
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
 // TranslateAndUpdatePost handles the complete flow: read, backup, translate, update
 // This is designed to work with the existing translation session
 func (wp *WordPressDB) ReadPostForTranslation(postID int64, targetLang string) (*WordPressPost, string, error) {
@@ -219,7 +663,7 @@ func (wp *WordPressDB) ReadPostForTranslation(postID int64, targetLang string) (
 	}
 
 	// Save backup
-	backupPath, err := wp.SaveBackup(postID, post.PostContent, targetLang)
+	backupPath, err := wp.SaveFullBackup(post, "", targetLang, "")
 	if err != nil {
 		return nil, "", err
 	}
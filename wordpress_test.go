@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteNewBackupKeepsSameSecondBackups(t *testing.T) {
+	dir := t.TempDir()
+	base := "post_42_full_backup_en_20250301_103000"
+
+	var paths []string
+	for _, content := range []string{"primero", "segundo", "tercero"} {
+		path, err := writeNewBackup(dir, base, ".json", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.Base(path))
+	}
+
+	want := []string{base + ".json", base + "_2.json", base + "_3.json"}
+	for i, content := range []string{"primero", "segundo", "tercero"} {
+		if paths[i] != want[i] {
+			t.Errorf("backup %d written as %s, want %s", i+1, paths[i], want[i])
+		}
+		data, err := os.ReadFile(filepath.Join(dir, want[i]))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", want[i], data, err, content)
+		}
+		if _, ok := parseBackupName(want[i]); !ok {
+			t.Errorf("%s is not recognized as a backup", want[i])
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Multilingual plugins supported for linking translated posts
+const (
+	multilingualNone     = "none"
+	multilingualWPML     = "wpml"
+	multilingualPolylang = "polylang"
+)
+
+// PostTranslation is one language version of a post in a translation group
+type PostTranslation struct {
+	PostID     int64
+	Language   string
+	SourceLang string // Empty for the original
+	Title      string
+	Status     string
+}
+
+// Multilingual returns the plugin used to link translations: WP_MULTILINGUAL
+// (wpml, polylang, none) or, by default, whatever is installed in the database
+func (wp *WordPressDB) Multilingual() string {
+	wp.multilingualOnce.Do(func() {
+		mode := strings.ToLower(strings.TrimSpace(os.Getenv("WP_MULTILINGUAL")))
+		switch mode {
+		case multilingualWPML, multilingualPolylang, multilingualNone:
+			wp.multilingual = mode
+			return
+		}
+		wp.multilingual = multilingualNone
+		if wp.tableExists(wp.tablePrefix + "icl_translations") {
+			wp.multilingual = multilingualWPML
+		} else if wp.hasPolylangLanguages() {
+			wp.multilingual = multilingualPolylang
+		}
+	})
+	return wp.multilingual
+}
+
+// tableExists reports whether a table exists in the current database
+func (wp *WordPressDB) tableExists(name string) bool {
+	var count int
+	err := wp.db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = ?`, name).Scan(&count)
+	return err == nil && count > 0
+}
+
+// hasPolylangLanguages reports whether any Polylang language term exists
+func (wp *WordPressDB) hasPolylangLanguages() bool {
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %sterm_taxonomy WHERE taxonomy = ?`, wp.tablePrefix)
+	err := wp.db.QueryRow(query, pllLanguageTaxonomy).Scan(&count)
+	return err == nil && count > 0
+}
+
+// wpmlElement is a row of icl_translations
+type wpmlElement struct {
+	TranslationID int64
+	ElementType   string
+	Trid          int64
+	Language      string
+	SourceLang    sql.NullString
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// wpmlElementFor returns the icl_translations row of a post, or nil if the
+// post is not registered in WPML
+func (wp *WordPressDB) wpmlElementFor(q rowQuerier, postID int64) (*wpmlElement, error) {
+	query := fmt.Sprintf(`
+		SELECT translation_id, element_type, trid, language_code, source_language_code
+		FROM %sicl_translations
+		WHERE element_id = ? AND element_type LIKE 'post\_%%'`,
+		wp.tablePrefix)
+
+	e := &wpmlElement{}
+	err := q.QueryRow(query, postID).Scan(&e.TranslationID, &e.ElementType, &e.Trid, &e.Language, &e.SourceLang)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo icl_translations: %v", err)
+	}
+	return e, nil
+}
+
+// WPMLTranslations returns every post in the WPML translation group of postID,
+// the original first. It returns nil if the post is not registered in WPML.
+func (wp *WordPressDB) WPMLTranslations(postID int64) ([]PostTranslation, error) {
+	element, err := wp.wpmlElementFor(wp.db, postID)
+	if err != nil || element == nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT t.element_id, t.language_code, t.source_language_code, p.post_title, p.post_status
+		FROM %[1]sicl_translations t
+		JOIN %[1]sposts p ON p.ID = t.element_id
+		WHERE t.trid = ? AND t.element_type = ?
+		ORDER BY t.source_language_code IS NOT NULL, t.language_code`,
+		wp.tablePrefix)
+	rows, err := wp.db.Query(query, element.Trid, element.ElementType)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo traducciones WPML: %v", err)
+	}
+	defer rows.Close()
+
+	var translations []PostTranslation
+	for rows.Next() {
+		var t PostTranslation
+		var source sql.NullString
+		if err := rows.Scan(&t.PostID, &t.Language, &source, &t.Title, &t.Status); err != nil {
+			return nil, fmt.Errorf("error leyendo traducciones WPML: %v", err)
+		}
+		t.SourceLang = source.String
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// WPMLLinkTranslation registers translatedID as the lang version of sourceID in
+// icl_translations. If the source post is not registered yet it is added with
+// sourceLang as its language in a new translation group.
+func (wp *WordPressDB) WPMLLinkTranslation(sourceID, translatedID int64, lang, sourceLang string) error {
+	tx, err := wp.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error iniciando transaccion: %v", err)
+	}
+	defer tx.Rollback()
+
+	source, err := wp.wpmlElementFor(tx, sourceID)
+	if err != nil {
+		return err
+	}
+
+	if source == nil {
+		if sourceLang == "" {
+			return fmt.Errorf("el post %d no esta registrado en WPML y no se conoce su idioma", sourceID)
+		}
+		var postType string
+		query := fmt.Sprintf(`SELECT post_type FROM %sposts WHERE ID = ?`, wp.tablePrefix)
+		if err := tx.QueryRow(query, sourceID).Scan(&postType); err != nil {
+			return fmt.Errorf("error leyendo post %d: %v", sourceID, err)
+		}
+
+		var trid int64
+		query = fmt.Sprintf(`SELECT COALESCE(MAX(trid), 0) + 1 FROM %sicl_translations`, wp.tablePrefix)
+		if err := tx.QueryRow(query).Scan(&trid); err != nil {
+			return fmt.Errorf("error calculando trid: %v", err)
+		}
+
+		source = &wpmlElement{ElementType: "post_" + postType, Trid: trid, Language: sourceLang}
+		query = fmt.Sprintf(`
+			INSERT INTO %sicl_translations (element_type, element_id, trid, language_code, source_language_code)
+			VALUES (?, ?, ?, ?, NULL)`,
+			wp.tablePrefix)
+		if _, err := tx.Exec(query, source.ElementType, sourceID, source.Trid, source.Language); err != nil {
+			return fmt.Errorf("error registrando post original en WPML: %v", err)
+		}
+	}
+
+	if strings.EqualFold(source.Language, lang) {
+		return fmt.Errorf("el post %d ya esta en idioma '%s' en WPML", sourceID, lang)
+	}
+
+	// Another post already holding this language in the group would make WPML
+	// ambiguous: it must be updated instead of linking a duplicate
+	var existing int64
+	query := fmt.Sprintf(`
+		SELECT element_id FROM %sicl_translations
+		WHERE trid = ? AND element_type = ? AND language_code = ? AND element_id != ?`,
+		wp.tablePrefix)
+	err = tx.QueryRow(query, source.Trid, source.ElementType, lang, translatedID).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("el grupo WPML de %d ya tiene una traduccion '%s' (post %d)", sourceID, lang, existing)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("error leyendo icl_translations: %v", err)
+	}
+
+	translated, err := wp.wpmlElementFor(tx, translatedID)
+	if err != nil {
+		return err
+	}
+	if translated != nil {
+		query = fmt.Sprintf(`
+			UPDATE %sicl_translations
+			SET element_type = ?, trid = ?, language_code = ?, source_language_code = ?
+			WHERE translation_id = ?`,
+			wp.tablePrefix)
+		_, err = tx.Exec(query, source.ElementType, source.Trid, lang, source.Language, translated.TranslationID)
+	} else {
+		query = fmt.Sprintf(`
+			INSERT INTO %sicl_translations (element_type, element_id, trid, language_code, source_language_code)
+			VALUES (?, ?, ?, ?, ?)`,
+			wp.tablePrefix)
+		_, err = tx.Exec(query, source.ElementType, translatedID, source.Trid, lang, source.Language)
+	}
+	if err != nil {
+		return fmt.Errorf("error registrando traduccion en WPML: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error confirmando transaccion: %v", err)
+	}
+	return nil
+}
+
+// PostTranslations lists the translation group of a post using the active
+// multilingual plugin. It returns nil when there is no plugin or group.
+func (wp *WordPressDB) PostTranslations(postID int64) ([]PostTranslation, error) {
+	switch wp.Multilingual() {
+	case multilingualWPML:
+		return wp.WPMLTranslations(postID)
+	case multilingualPolylang:
+		return wp.PolylangTranslations(postID)
+	}
+	return nil, nil
+}
+
+// FindTranslation returns the post holding the lang version of postID, or 0
+func (wp *WordPressDB) FindTranslation(postID int64, lang string) (int64, error) {
+	translations, err := wp.PostTranslations(postID)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range translations {
+		if t.PostID != postID && strings.EqualFold(t.Language, lang) {
+			return t.PostID, nil
+		}
+	}
+	return 0, nil
+}
+
+// LinkTranslation registers translatedID as the lang version of sourceID in
+// the active multilingual plugin. It returns false if there is no plugin.
+func (wp *WordPressDB) LinkTranslation(sourceID, translatedID int64, lang, sourceLang string) (bool, error) {
+	switch wp.Multilingual() {
+	case multilingualWPML:
+		return true, wp.WPMLLinkTranslation(sourceID, translatedID, lang, sourceLang)
+	case multilingualPolylang:
+		return true, wp.PolylangLinkTranslation(sourceID, translatedID, lang, sourceLang)
+	}
+	return false, nil
+}
+
+func (s *MCPServer) handleListPostTranslations(req JSONRPCRequest, params CallToolParams) {
+	postIDFloat, _ := params.Arguments["postId"].(float64)
+	postID := int64(postIDFloat)
+	if postID == 0 {
+		s.writeToolText(req, "ERROR: postId es obligatorio", true)
+		return
+	}
+
+	wpDB, err := s.getWordPressDB()
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR conectando a WordPress: %v", err), true)
+		return
+	}
+
+	plugin := wpDB.Multilingual()
+	if plugin == multilingualNone {
+		s.writeToolText(req, "No se ha detectado ningun plugin multilingue (WPML o Polylang). Configura WP_MULTILINGUAL si es necesario.", true)
+		return
+	}
+
+	translations, err := wpDB.PostTranslations(postID)
+	if err != nil {
+		s.writeToolText(req, fmt.Sprintf("ERROR: %v", err), true)
+		return
+	}
+	if len(translations) == 0 {
+		s.writeToolText(req, fmt.Sprintf("El post %d no pertenece a ningun grupo de traducciones de %s.", postID, strings.ToUpper(plugin)), false)
+		return
+	}
+
+	sort.SliceStable(translations, func(i, j int) bool {
+		return translations[i].SourceLang == "" && translations[j].SourceLang != ""
+	})
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("TRADUCCIONES DEL POST %d (%s)\n==============================\n", postID, strings.ToUpper(plugin)))
+	for _, t := range translations {
+		// Polylang does not record which version is the original
+		role := ""
+		if t.SourceLang != "" {
+			role = ", traduccion de " + t.SourceLang
+		} else if plugin == multilingualWPML {
+			role = ", original"
+		}
+		marker := ""
+		if t.PostID == postID {
+			marker = " <-"
+		}
+		b.WriteString(fmt.Sprintf("- [%s] Post %d: %s (%s%s)%s\n", t.Language, t.PostID, truncateForDisplay(t.Title, 60), t.Status, role, marker))
+	}
+	s.writeToolText(req, b.String(), false)
+}
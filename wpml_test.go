@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+// openFixtureDB loads SQL fixtures, in order, into the database of
+// WP_TEST_DSN (e.g. "root@tcp(localhost:3306)/divi_test") and returns a
+// WordPressDB on it. The fixtures drop and recreate their tables, so use a
+// scratch database. Tests that need it are skipped when WP_TEST_DSN is not set.
+func openFixtureDB(t *testing.T, fixtures ...string) *WordPressDB {
+	t.Helper()
+	dsn := os.Getenv("WP_TEST_DSN")
+	if dsn == "" {
+		t.Skip("WP_TEST_DSN no configurada")
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("mysql", dsn+sep+"multiStatements=true&parseTime=true&charset=utf8mb4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, fixture := range fixtures {
+		schema, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The WordPress schema uses zero dates as column defaults
+		if _, err := db.Exec("SET SESSION sql_mode = '';\n" + string(schema)); err != nil {
+			t.Fatalf("cargando %s: %v", fixture, err)
+		}
+	}
+
+	wp := &WordPressDB{db: db, tablePrefix: "wp_", backupDir: t.TempDir()}
+	wp.registerDefaultSEOFields()
+	return wp
+}
+
+func TestWPMLExistingTranslation(t *testing.T) {
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql")
+
+	if got := wp.Multilingual(); got != multilingualWPML {
+		t.Fatalf("Multilingual() = %q, want %q", got, multilingualWPML)
+	}
+
+	translations, err := wp.WPMLTranslations(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 2 {
+		t.Fatalf("got %d translations, want 2: %+v", len(translations), translations)
+	}
+	if translations[0].PostID != 10 || translations[0].Language != "es" || translations[0].SourceLang != "" {
+		t.Errorf("original = %+v, want post 10 in es", translations[0])
+	}
+	if translations[1].PostID != 11 || translations[1].Language != "en" || translations[1].SourceLang != "es" {
+		t.Errorf("translation = %+v, want post 11 in en from es", translations[1])
+	}
+
+	id, err := wp.FindTranslation(10, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 11 {
+		t.Errorf("FindTranslation(10, en) = %d, want 11", id)
+	}
+	if id, _ := wp.FindTranslation(10, "fr"); id != 0 {
+		t.Errorf("FindTranslation(10, fr) = %d, want 0", id)
+	}
+}
+
+func TestWPMLLinkNewTranslation(t *testing.T) {
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql")
+
+	newID, err := wp.CreateTranslatedCopy(20, "Services", "services", "", "[et_pb_section][/et_pb_section]", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linked, err := wp.LinkTranslation(20, newID, "en", "es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !linked {
+		t.Fatal("LinkTranslation did not use WPML")
+	}
+
+	id, err := wp.FindTranslation(20, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != newID {
+		t.Errorf("FindTranslation(20, en) = %d, want %d", id, newID)
+	}
+
+	translations, err := wp.WPMLTranslations(newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 2 || translations[0].PostID != 20 || translations[1].SourceLang != "es" {
+		t.Errorf("unexpected group: %+v", translations)
+	}
+
+	// Linking the same post again only rewrites its own row
+	if err := wp.WPMLLinkTranslation(20, newID, "en", "es"); err != nil {
+		t.Errorf("relinking the same translation: %v", err)
+	}
+}
+
+func TestWPMLLinkUnregisteredSource(t *testing.T) {
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql")
+
+	if _, err := wp.db.Exec(`DELETE FROM wp_icl_translations WHERE element_id = 20`); err != nil {
+		t.Fatal(err)
+	}
+	newID, err := wp.CreateTranslatedCopy(20, "Services", "services", "", "", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wp.WPMLLinkTranslation(20, newID, "en", ""); err == nil {
+		t.Error("linking a source of unknown language should fail")
+	}
+	if err := wp.WPMLLinkTranslation(20, newID, "en", "es"); err != nil {
+		t.Fatal(err)
+	}
+	translations, err := wp.WPMLTranslations(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(translations) != 2 || translations[0].Language != "es" || translations[1].PostID != newID {
+		t.Errorf("unexpected group: %+v", translations)
+	}
+}
+
+func TestWPMLLinkDuplicateLanguage(t *testing.T) {
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql")
+
+	newID, err := wp.CreateTranslatedCopy(10, "Home", "home", "", "", "draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Post 11 already is the English version of post 10
+	err = wp.WPMLLinkTranslation(10, newID, "en", "es")
+	if err == nil || !strings.Contains(err.Error(), "ya tiene una traduccion 'en' (post 11)") {
+		t.Errorf("duplicate language: got %v", err)
+	}
+	if err := wp.WPMLLinkTranslation(10, newID, "es", "es"); err == nil {
+		t.Error("linking in the language of the source should fail")
+	}
+
+	// Nothing was registered for the copy
+	if translations, _ := wp.WPMLTranslations(newID); translations != nil {
+		t.Errorf("copy was linked: %+v", translations)
+	}
+}
+
+func TestWPMLRemapGlobalModules(t *testing.T) {
+	t.Setenv("WP_MULTILINGUAL", "")
+	wp := openFixtureDB(t, "test/fixtures/wordpress_wpml.sql")
+
+	content := `[et_pb_section global_module="10"][/et_pb_section][et_pb_section global_module="20"][/et_pb_section][et_pb_section global_module="10"][/et_pb_section][et_pb_section global_module="30"][/et_pb_section]`
+	got, remapped, missing, err := wp.remapGlobalModules(content, "en", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[et_pb_section global_module="11"][/et_pb_section][et_pb_section global_module="20"][/et_pb_section][et_pb_section global_module="11"][/et_pb_section][et_pb_section global_module="30"][/et_pb_section]`
+	if got != want {
+		t.Errorf("content = %s\nwant %s", got, want)
+	}
+	if len(remapped) != 1 || remapped[10] != 11 {
+		t.Errorf("remapped = %v, want map[10:11]", remapped)
+	}
+	if len(missing) != 1 || missing[0] != 20 {
+		t.Errorf("missing = %v, want [20]", missing)
+	}
+}